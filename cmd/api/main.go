@@ -7,6 +7,8 @@ import (
 
 	"github.com/b-j-roberts/foc-engine/internal/config"
 	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/b-j-roberts/foc-engine/internal/registry"
 	"github.com/b-j-roberts/foc-engine/routes"
 )
 
@@ -17,7 +19,12 @@ func main() {
 		mongo.InitMongoDB()
 	}
 
-	routes.StartServer(config.Conf.Api.Host, config.Conf.Api.Port)
+	// Serves the stored events, the registry isn't indexing
+	focRegistry := registry.NewRegistry(registry.RegistryOptions{
+		Provider: provider.Default(),
+		Config:   config.Conf.Indexer,
+	})
+	routes.StartServer(config.Conf.Api.Host, config.Conf.Api.Port, focRegistry)
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -15,18 +16,39 @@ import (
 func main() {
 	config.InitConfig()
 
-	err := provider.InitProvider(registry.ProcessStarknetEventData, true)
+	// Connected before the indexer starts, the backfilled events are stored into Mongo
+	if mongo.ShouldConnectMongo() {
+		mongo.InitMongoDB()
+		if err := registry.CreateEventIndexes(context.Background()); err != nil {
+			fmt.Println("Error creating event indexes:", err)
+		}
+	}
+
+	starknetProvider := provider.NewRpcProvider(config.GetRpcEndpoints())
+	starknetProvider.RpcHost = config.Conf.Rpc.Host
+	focRegistry := registry.NewRegistry(registry.RegistryOptions{
+		Provider: starknetProvider,
+		Config:   config.Conf.Indexer,
+	})
+	err := provider.InitProvider(starknetProvider, provider.IndexerOptions{
+		Config:                   config.Conf.Indexer,
+		ProcessStarknetEventData: focRegistry.ProcessStarknetEventData,
+		// Restarts resume each contract from its last stored event instead of Indexer.StartAt
+		ContractResumeBlock: focRegistry.GetContractResumeBlock,
+		OnReorg:             focRegistry.ProcessReorg,
+	})
 	if err != nil {
 		fmt.Println("Error initializing provider:", err)
 		os.Exit(1)
 	}
-	defer provider.Close()
+	defer starknetProvider.Close()
 
 	if mongo.ShouldConnectMongo() {
-		mongo.InitMongoDB()
+		// Moves stored events to ACCEPTED_ON_L2 / ACCEPTED_ON_L1 as their blocks are accepted
+		focRegistry.StartFinalityUpdater()
 	}
 
-	routes.StartServer(config.Conf.Indexer.Host, config.Conf.Indexer.Port)
+	routes.StartServer(config.Conf.Indexer.Host, config.Conf.Indexer.Port, focRegistry)
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
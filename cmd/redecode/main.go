@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/b-j-roberts/foc-engine/internal/config"
+	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/b-j-roberts/foc-engine/internal/registry"
+)
+
+func main() {
+	// Define command-line flags
+	contract := flag.String("contract", "", "Only redecode events from this contract address")
+	eventType := flag.String("event-type", "", "Only redecode events of this type ( ex: pow_game::actions::BlockMined )")
+	fromBlock := flag.Int64("from-block", -1, "Only redecode events from this block number (-1 to disable)")
+	toBlock := flag.Int64("to-block", -1, "Only redecode events up to this block number (-1 to disable)")
+
+	flag.Parse()
+
+	filter := registry.RedecodeFilter{
+		ContractAddress: *contract,
+		EventType:       *eventType,
+	}
+	if *fromBlock >= 0 {
+		block := uint(*fromBlock)
+		filter.FromBlock = &block
+	}
+	if *toBlock >= 0 {
+		block := uint(*toBlock)
+		filter.ToBlock = &block
+	}
+
+	// Uses Rpc.Host from CONFIG_PATH to fetch abis & MONGO_URI for the events
+	config.InitConfig()
+	mongo.InitMongoDB()
+
+	fmt.Println("Redecoding events with configuration:")
+	fmt.Printf("  Contract: %s\n", *contract)
+	fmt.Printf("  Event Type: %s\n", *eventType)
+	fmt.Printf("  From Block: %d\n", *fromBlock)
+	fmt.Printf("  To Block: %d\n", *toBlock)
+	fmt.Println()
+
+	focRegistry := registry.NewRegistry(registry.RegistryOptions{
+		Provider: provider.Default(),
+		Config:   config.Conf.Indexer,
+	})
+	result, err := focRegistry.RedecodeEvents(context.Background(), filter)
+	if err != nil {
+		fmt.Println("Error redecoding events:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Matched: %d, Redecoded: %d, Skipped ( no raw felts ): %d, Failed: %d\n",
+		result.Matched, result.Redecoded, result.Skipped, result.Failed)
+	for _, resultErr := range result.Errors {
+		fmt.Println("  ", resultErr)
+	}
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/b-j-roberts/foc-engine/internal/config"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/b-j-roberts/foc-engine/internal/registry"
+)
+
+// readAbiFile reads an abi from a file containing either the abi itself or a
+// contract class with an "abi" field ( as an array or a json string )
+func readAbiFile(path string) ([]interface{}, error) {
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var contents interface{}
+	if err := json.Unmarshal(fileData, &contents); err != nil {
+		return nil, err
+	}
+	switch value := contents.(type) {
+	case []interface{}:
+		return value, nil
+	case map[string]interface{}:
+		switch abi := value["abi"].(type) {
+		case []interface{}:
+			return abi, nil
+		case string:
+			var abiEntries []interface{}
+			if err := json.Unmarshal([]byte(abi), &abiEntries); err != nil {
+				return nil, err
+			}
+			return abiEntries, nil
+		}
+	}
+	return nil, fmt.Errorf("no abi found in %s", path)
+}
+
+func main() {
+	// Define command-line flags
+	contract := flag.String("contract", "", "Contract address to fetch the abi of")
+	abiFile := flag.String("abi", "", "Abi or contract class json file, instead of --contract")
+	rpc := flag.String("rpc", "", "RPC host used with --contract ( default: Rpc.Host from CONFIG_PATH )")
+	format := flag.String("format", "json", "Output format (json, typescript)")
+	out := flag.String("out", "", "Output file ( default: stdout )")
+
+	flag.Parse()
+
+	// Validate flags
+	if (*contract == "") == (*abiFile == "") {
+		fmt.Println("Error: exactly one of --contract or --abi is required")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *format != "json" && *format != "typescript" {
+		fmt.Println("Error: --format must be 'json' or 'typescript'")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var abi []interface{}
+	title := *abiFile
+	if *abiFile != "" {
+		var err error
+		abi, err = readAbiFile(*abiFile)
+		if err != nil {
+			fmt.Println("Error reading abi file:", err)
+			os.Exit(1)
+		}
+	} else {
+		if *rpc != "" {
+			config.Conf = &config.Config{
+				Rpc: config.RpcConfig{Host: *rpc},
+			}
+		} else {
+			config.InitConfig()
+		}
+		contractClass, err := provider.GetStarknetClassAt(*contract)
+		if err != nil {
+			fmt.Println("Error getting contract class:", err)
+			os.Exit(1)
+		}
+		abi = contractClass.Abi
+		title = *contract
+	}
+
+	decoder := registry.NewContractDecoder(abi)
+	var output string
+	if *format == "typescript" {
+		output = decoder.GetEventTypescript(title)
+	} else {
+		schemaJson, err := json.MarshalIndent(decoder.GetEventJsonSchema(title), "", "  ")
+		if err != nil {
+			fmt.Println("Error marshalling schema to JSON:", err)
+			os.Exit(1)
+		}
+		output = string(schemaJson) + "\n"
+	}
+
+	if *out == "" {
+		fmt.Print(output)
+		return
+	}
+	if err := os.WriteFile(*out, []byte(output), 0644); err != nil {
+		fmt.Println("Error writing output file:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %d event types to %s\n", len(decoder.Events), *out)
+}
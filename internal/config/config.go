@@ -3,12 +3,19 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"gopkg.in/yaml.v3"
 )
 
+type RpcEndpointConfig struct {
+	Url   string `yaml:"Url"`
+	WsUrl string `yaml:"WsUrl,omitempty"` // Optional, the endpoint isn't used for subscriptions if empty
+}
+
 type RpcConfig struct {
-	Host string `yaml:"Host"`
+	Host      string              `yaml:"Host"`
+	Endpoints []RpcEndpointConfig `yaml:"Endpoints,omitempty"` // Optional, used instead of Host for failover
 }
 
 type ApiConfig struct {
@@ -25,6 +32,16 @@ type IndexerConfig struct {
 	Host    string `yaml:"Host"`
 	Port    int    `yaml:"Port"`
 	StartAt *int   `yaml:"StartAt,omitempty"` // Optional field, can be nil
+	// Optional, finality of subscribed events ( PRE_CONFIRMED or ACCEPTED_ON_L2, rpc v0.9+ )
+	FinalityStatus string `yaml:"FinalityStatus,omitempty"`
+	// Optional, auto ( default ), websocket or polling
+	Mode string `yaml:"Mode,omitempty"`
+	// Optional, seconds between polls in polling mode ( default 5 )
+	PollInterval int `yaml:"PollInterval,omitempty"`
+	// Optional, attach the sender, execution status & fee of each event's transaction, & its event_index when the rpc has none
+	EnrichReceipts bool `yaml:"EnrichReceipts,omitempty"`
+	// Optional, directory of the contract classes when Mongo isn't connected, relative to the config file
+	ClassStoreDir string `yaml:"ClassStoreDir,omitempty"`
 }
 
 type PaymasterConfig struct {
@@ -32,11 +49,17 @@ type PaymasterConfig struct {
 	ApiUrl     string `yaml:"ApiUrl"`
 }
 
+type DevnetConfig struct {
+	// Optional, url of the starknet-devnet control endpoints, the first rpc endpoint if empty
+	Url string `yaml:"Url,omitempty"`
+}
+
 type Config struct {
 	Rpc       RpcConfig       `yaml:"Rpc"`
 	Api       ApiConfig       `yaml:"Api"`
 	Indexer   IndexerConfig   `yaml:"Indexer"`
 	Paymaster PaymasterConfig `yaml:"Paymaster"`
+	Devnet    DevnetConfig    `yaml:"Devnet,omitempty"`
 	Modules   []string        `yaml:"Modules"`
 }
 
@@ -60,6 +83,10 @@ func InitConfig() {
 		fmt.Println("Error parsing config file: ", err)
 		os.Exit(1)
 	}
+
+	if Conf.Indexer.ClassStoreDir != "" && !filepath.IsAbs(Conf.Indexer.ClassStoreDir) {
+		Conf.Indexer.ClassStoreDir = filepath.Join(filepath.Dir(configPath), Conf.Indexer.ClassStoreDir)
+	}
 }
 
 // Modules enum
@@ -70,6 +97,8 @@ const (
 	ModuleAccounts  FocModule = "ACCOUNTS"
 	ModuleEvents    FocModule = "EVENTS"
 	ModuleRegistry  FocModule = "REGISTRY"
+	// Devnet control routes, only served when the rpc node is starknet-devnet
+	ModuleDevnet FocModule = "DEVNET"
 )
 
 func ModuleEnabled(module FocModule) bool {
@@ -136,3 +165,37 @@ func GetPaymasterApiKey() string {
     return ""
   }
 }
+
+// GetRpcEndpoints returns the configured rpc endpoints, or a single endpoint
+// for Rpc.Host if no endpoints are listed
+func GetRpcEndpoints() []RpcEndpointConfig {
+	if Conf == nil {
+		return []RpcEndpointConfig{}
+	}
+	if len(Conf.Rpc.Endpoints) > 0 {
+		return Conf.Rpc.Endpoints
+	}
+	wsUrl := "ws://" + Conf.Rpc.Host + "/ws"
+	if Conf.Api.Production {
+		wsUrl = "wss://" + Conf.Rpc.Host + "/ws"
+	}
+	return []RpcEndpointConfig{
+		{
+			Url:   Conf.Rpc.Host,
+			WsUrl: wsUrl,
+		},
+	}
+}
+
+// GetDevnetUrl returns the url of the starknet-devnet node, Devnet.Url if set or
+// the first rpc endpoint
+func GetDevnetUrl() string {
+	if Conf != nil && Conf.Devnet.Url != "" {
+		return Conf.Devnet.Url
+	}
+	endpoints := GetRpcEndpoints()
+	if len(endpoints) == 0 {
+		return ""
+	}
+	return endpoints[0].Url
+}
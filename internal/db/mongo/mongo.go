@@ -84,3 +84,27 @@ func GetFocEngineEventsCollection() *mongo.Collection {
 	}
 	return collection
 }
+
+func GetFocEngineDeadLettersCollection() *mongo.Collection {
+	collection := Mongo.Client.Database("foc_engine").Collection("dead_letters")
+	if collection == nil {
+		fmt.Println("Collection not found: foc_engine dead_letters")
+	}
+	return collection
+}
+
+func GetFocEngineClassesCollection() *mongo.Collection {
+	collection := Mongo.Client.Database("foc_engine").Collection("classes")
+	if collection == nil {
+		fmt.Println("Collection not found: foc_engine classes")
+	}
+	return collection
+}
+
+func GetFocEngineReorgsCollection() *mongo.Collection {
+	collection := Mongo.Client.Database("foc_engine").Collection("reorgs")
+	if collection == nil {
+		fmt.Println("Collection not found: foc_engine reorgs")
+	}
+	return collection
+}
@@ -0,0 +1,267 @@
+package devnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/b-j-roberts/foc-engine/internal/config"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+// Wraps the starknet-devnet control endpoints
+// See: https://0xspaceshard.github.io/starknet-devnet/docs/intro
+
+var ErrInvalidInput = errors.New("invalid input")
+
+// Fee token units accepted by /mint & /account_balance
+const (
+	UnitFri = "FRI"
+	UnitWei = "WEI"
+)
+
+var (
+	devnetClient *provider.RpcClient
+	// Set once a devnet answered /config, not cached on failure so the node can start later
+	isDevnet  bool
+	initMutex sync.Mutex
+)
+
+// GetDevnetClient returns the client of the devnet node, created on first use
+func GetDevnetClient() *provider.RpcClient {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+	if devnetClient == nil {
+		devnetClient = provider.NewRpcClient(config.GetDevnetUrl())
+		// Control calls ( ex: mint ) aren't idempotent
+		devnetClient.MaxRetries = 0
+	}
+	return devnetClient
+}
+
+// IsDevnet reports whether the node serves the devnet control endpoints
+func IsDevnet(ctx context.Context) bool {
+	initMutex.Lock()
+	known := isDevnet
+	initMutex.Unlock()
+	if known {
+		return true
+	}
+	devnetConfig, err := GetConfig(ctx)
+	if err != nil {
+		fmt.Println("Devnet not available:", err)
+		return false
+	}
+	// Other nodes may answer with a json-rpc error
+	var fields struct {
+		TotalAccounts *uint64 `json:"total_accounts"`
+	}
+	if err := json.Unmarshal(devnetConfig, &fields); err != nil || fields.TotalAccounts == nil {
+		fmt.Println("Devnet not available: invalid /config response")
+		return false
+	}
+	initMutex.Lock()
+	isDevnet = true
+	initMutex.Unlock()
+	return true
+}
+
+// GetConfig returns the config the devnet was started with
+func GetConfig(ctx context.Context) (json.RawMessage, error) {
+	var result json.RawMessage
+	if err := GetDevnetClient().GetJson(ctx, "/config", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func validateAddress(address string) error {
+	if !strings.HasPrefix(address, "0x") || len(address) < 3 || len(address) > 66 {
+		return fmt.Errorf("%w: address must be a 0x prefixed felt: %s", ErrInvalidInput, address)
+	}
+	if _, ok := new(big.Int).SetString(address[2:], 16); !ok {
+		return fmt.Errorf("%w: address must be a 0x prefixed felt: %s", ErrInvalidInput, address)
+	}
+	return nil
+}
+
+func validateUnit(unit string) error {
+	if unit != UnitFri && unit != UnitWei {
+		return fmt.Errorf("%w: unit must be %s or %s: %s", ErrInvalidInput, UnitFri, UnitWei, unit)
+	}
+	return nil
+}
+
+type MintResult struct {
+	NewBalance string `json:"new_balance"`
+	Unit       string `json:"unit"`
+	TxHash     string `json:"tx_hash"`
+}
+
+// Mint funds an account with amount of the unit's fee token
+func Mint(ctx context.Context, address string, amount *big.Int, unit string) (*MintResult, error) {
+	if err := validateAddress(address); err != nil {
+		return nil, err
+	}
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidInput)
+	}
+	if err := validateUnit(unit); err != nil {
+		return nil, err
+	}
+	requestBody := map[string]interface{}{
+		"address": address,
+		"amount":  amount,
+		"unit":    unit,
+	}
+	var result MintResult
+	if err := GetDevnetClient().PostJson(ctx, "/mint", requestBody, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type IncreaseTimeResult struct {
+	TimestampIncreasedBy uint64 `json:"timestamp_increased_by"`
+	BlockHash            string `json:"block_hash"`
+}
+
+// IncreaseTime moves the devnet time forward by seconds & creates a block with the new time
+func IncreaseTime(ctx context.Context, seconds uint64) (*IncreaseTimeResult, error) {
+	if seconds == 0 {
+		return nil, fmt.Errorf("%w: time must be positive", ErrInvalidInput)
+	}
+	var result IncreaseTimeResult
+	err := GetDevnetClient().PostJson(ctx, "/increase_time", map[string]interface{}{"time": seconds}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type SetTimeResult struct {
+	BlockTimestamp uint64 `json:"block_timestamp"`
+	// Empty if no block was generated
+	BlockHash string `json:"block_hash,omitempty"`
+}
+
+// SetTime sets the timestamp of the next block, generating it now if generateBlock
+func SetTime(ctx context.Context, timestamp uint64, generateBlock bool) (*SetTimeResult, error) {
+	if timestamp == 0 {
+		return nil, fmt.Errorf("%w: time must be positive", ErrInvalidInput)
+	}
+	requestBody := map[string]interface{}{
+		"time":           timestamp,
+		"generate_block": generateBlock,
+	}
+	var result SetTimeResult
+	if err := GetDevnetClient().PostJson(ctx, "/set_time", requestBody, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateBlock creates an empty block, returning its hash
+func CreateBlock(ctx context.Context) (string, error) {
+	var result struct {
+		BlockHash string `json:"block_hash"`
+	}
+	if err := GetDevnetClient().PostJson(ctx, "/create_block", map[string]interface{}{}, &result); err != nil {
+		return "", err
+	}
+	return result.BlockHash, nil
+}
+
+// GasPrices of the next blocks, nil prices are left unchanged
+type GasPrices struct {
+	GasPriceWei     *big.Int
+	GasPriceFri     *big.Int
+	DataGasPriceWei *big.Int
+	DataGasPriceFri *big.Int
+	L2GasPriceWei   *big.Int
+	L2GasPriceFri   *big.Int
+}
+
+// SetGasPrice sets the gas prices of the next blocks, applied now if generateBlock.
+// Returns the devnet's gas prices after the update.
+func SetGasPrice(ctx context.Context, prices GasPrices, generateBlock bool) (json.RawMessage, error) {
+	requestBody := map[string]interface{}{
+		"generate_block": generateBlock,
+	}
+	for name, price := range map[string]*big.Int{
+		"gas_price_wei":      prices.GasPriceWei,
+		"gas_price_fri":      prices.GasPriceFri,
+		"data_gas_price_wei": prices.DataGasPriceWei,
+		"data_gas_price_fri": prices.DataGasPriceFri,
+		"l2_gas_price_wei":   prices.L2GasPriceWei,
+		"l2_gas_price_fri":   prices.L2GasPriceFri,
+	} {
+		if price == nil {
+			continue
+		}
+		if price.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: %s must be positive", ErrInvalidInput, name)
+		}
+		requestBody[name] = price
+	}
+	if len(requestBody) == 1 {
+		return nil, fmt.Errorf("%w: no gas price set", ErrInvalidInput)
+	}
+	var result json.RawMessage
+	if err := GetDevnetClient().PostJson(ctx, "/set_gas_price", requestBody, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Dump saves the devnet state to path on the devnet host, or returns the dumped
+// state if path is empty ( requires devnet to run with --dump-on )
+func Dump(ctx context.Context, path string) (json.RawMessage, error) {
+	if path != "" {
+		return nil, GetDevnetClient().PostJson(ctx, "/dump", map[string]interface{}{"path": path}, nil)
+	}
+	var result json.RawMessage
+	if err := GetDevnetClient().PostJson(ctx, "/dump", map[string]interface{}{}, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Load restores the devnet state dumped to path on the devnet host
+func Load(ctx context.Context, path string) error {
+	if path == "" {
+		return fmt.Errorf("%w: missing path", ErrInvalidInput)
+	}
+	return GetDevnetClient().PostJson(ctx, "/load", map[string]interface{}{"path": path}, nil)
+}
+
+type AccountBalance struct {
+	Amount string `json:"amount"`
+	Unit   string `json:"unit"`
+}
+
+type PredeployedAccount struct {
+	Address        string `json:"address"`
+	PublicKey      string `json:"public_key"`
+	PrivateKey     string `json:"private_key"`
+	InitialBalance string `json:"initial_balance"`
+	// Set when requested with balances, Map: Token ( eth / strk ) -> balance
+	Balance map[string]AccountBalance `json:"balance,omitempty"`
+}
+
+// GetPredeployedAccounts returns the accounts predeployed & funded by the devnet
+func GetPredeployedAccounts(ctx context.Context, withBalance bool) ([]PredeployedAccount, error) {
+	path := "/predeployed_accounts"
+	if withBalance {
+		path += "?with_balance=true"
+	}
+	var result []PredeployedAccount
+	if err := GetDevnetClient().GetJson(ctx, path, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package fakenode
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+// Fixture is a recorded JSON-RPC call & its response
+type Fixture struct {
+	Method string             `json:"method"`
+	Params json.RawMessage    `json:"params,omitempty"`
+	Result json.RawMessage    `json:"result,omitempty"`
+	Error  *provider.RpcError `json:"error,omitempty"`
+}
+
+// fixtureKey identifies a call by method & params, params are re-marshalled so
+// whitespace & key order don't matter
+func fixtureKey(method string, params json.RawMessage) string {
+	var value interface{}
+	if len(params) == 0 || json.Unmarshal(params, &value) != nil {
+		return method + string(params)
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return method + string(params)
+	}
+	return method + string(canonical)
+}
+
+// LoadFixtures serves the calls recorded in a fixture file, before the scripted chain
+func (n *Node) LoadFixtures(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var fixtures []Fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return err
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, fixture := range fixtures {
+		n.fixtures[fixtureKey(fixture.Method, fixture.Params)] = fixture
+	}
+	return nil
+}
+
+// Recorder proxies JSON-RPC calls to a real node & records them as fixtures.
+// Only http calls are recorded, WebSocket subscriptions are scripted with Node.
+type Recorder struct {
+	server   *httptest.Server
+	upstream string
+
+	mutex    sync.Mutex
+	fixtures []Fixture
+}
+
+// NewRecorder starts a recording proxy to upstreamUrl
+func NewRecorder(upstreamUrl string) *Recorder {
+	recorder := &Recorder{
+		upstream: upstreamUrl,
+	}
+	recorder.server = httptest.NewServer(recorder)
+	return recorder
+}
+
+// Url returns the url to send calls to instead of the upstream node
+func (r *Recorder) Url() string {
+	return r.server.URL
+}
+
+func (r *Recorder) Close() {
+	r.server.Close()
+}
+
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := http.Post(r.upstream, "application/json", bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if res.StatusCode == http.StatusOK {
+		r.record(body, resBody)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(res.StatusCode)
+	w.Write(resBody)
+}
+
+type recordedResponse struct {
+	ID     json.RawMessage    `json:"id"`
+	Result json.RawMessage    `json:"result"`
+	Error  *provider.RpcError `json:"error"`
+}
+
+// record matches the responses to their requests by id, for single & batch calls
+func (r *Recorder) record(requestBody []byte, responseBody []byte) {
+	var requests []rpcRequest
+	var responses []recordedResponse
+	if bytes.HasPrefix(bytes.TrimSpace(requestBody), []byte("[")) {
+		if json.Unmarshal(requestBody, &requests) != nil || json.Unmarshal(responseBody, &responses) != nil {
+			return
+		}
+	} else {
+		var request rpcRequest
+		var response recordedResponse
+		if json.Unmarshal(requestBody, &request) != nil || json.Unmarshal(responseBody, &response) != nil {
+			return
+		}
+		requests = []rpcRequest{request}
+		responses = []recordedResponse{response}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, request := range requests {
+		for _, response := range responses {
+			if string(response.ID) != string(request.ID) {
+				continue
+			}
+			r.fixtures = append(r.fixtures, Fixture{
+				Method: request.Method,
+				Params: request.Params,
+				Result: response.Result,
+				Error:  response.Error,
+			})
+			break
+		}
+	}
+}
+
+// Save writes the recorded calls to a fixture file, loaded with Node.LoadFixtures
+func (r *Recorder) Save(path string) error {
+	r.mutex.Lock()
+	data, err := json.MarshalIndent(r.fixtures, "", "  ")
+	r.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,79 @@
+package fakenode_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/b-j-roberts/foc-engine/internal/fakenode"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+func TestRecorderFixtures(t *testing.T) {
+	upstream := fakenode.New()
+	defer upstream.Close()
+	upstream.AddBlock(fakenode.Event{FromAddress: "0xabc", Data: []string{"0x1"}})
+	upstream.AddBlocks(2)
+
+	recorder := fakenode.NewRecorder(upstream.Url())
+	defer recorder.Close()
+	client := provider.NewRpcClient(recorder.Url())
+	client.MaxRetries = 0
+	var blockNumber uint64
+	if err := client.Call(context.Background(), "starknet_blockNumber", []interface{}{}, &blockNumber); err != nil {
+		t.Fatal(err)
+	}
+	var page struct {
+		Events []emittedEvent `json:"events"`
+	}
+	header := &provider.RpcBatchCall{
+		Method: "starknet_getBlockWithTxHashes",
+		Params: []interface{}{map[string]interface{}{"block_number": 1}},
+		Result: &map[string]interface{}{},
+	}
+	events := &provider.RpcBatchCall{
+		Method: "starknet_getEvents",
+		Params: eventsFilter("0xabc", 0, blockNumber),
+		Result: &page,
+	}
+	if err := client.Batch(context.Background(), []*provider.RpcBatchCall{header, events}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recorded calls are served instead of the node's own chain
+	node := fakenode.New()
+	defer node.Close()
+	if err := node.LoadFixtures(path); err != nil {
+		t.Fatal(err)
+	}
+	client = provider.NewRpcClient(node.Url())
+	client.MaxRetries = 0
+	var replayedNumber uint64
+	if err := client.Call(context.Background(), "starknet_blockNumber", []interface{}{}, &replayedNumber); err != nil {
+		t.Fatal(err)
+	}
+	if replayedNumber != blockNumber || replayedNumber == node.Head().Number {
+		t.Errorf("replayed block number = %d, want the recorded %d", replayedNumber, blockNumber)
+	}
+	var replayed struct {
+		Events []emittedEvent `json:"events"`
+	}
+	if err := client.Call(context.Background(), "starknet_getEvents", eventsFilter("0xabc", 0, blockNumber), &replayed); err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed.Events) != 1 || replayed.Events[0].Data[0] != "0x1" {
+		t.Errorf("replayed events = %+v, want the recorded event", replayed.Events)
+	}
+	var block map[string]interface{}
+	params := []interface{}{map[string]interface{}{"block_number": 1}}
+	if err := client.Call(context.Background(), "starknet_getBlockWithTxHashes", params, &block); err != nil {
+		t.Fatal(err)
+	}
+	if upstreamBlock, _ := upstream.Block(1); block["block_hash"] != upstreamBlock.Hash {
+		t.Errorf("replayed block hash = %v, want %s", block["block_hash"], upstreamBlock.Hash)
+	}
+}
@@ -0,0 +1,265 @@
+// Package fakenode runs an in-process fake Starknet node, serving JSON-RPC over
+// http & WebSocket subscriptions from a scripted chain, for testing the provider,
+// registry & indexers without network access.
+//
+//	node := fakenode.New()
+//	defer node.Close()
+//	node.SetClass("0x123", classJson)
+//	node.DeployContract("0xabc", "0x123")
+//	node.AddBlock(fakenode.Event{FromAddress: "0xabc", Keys: []string{selector}})
+//
+// Point Rpc.Host ( or Rpc.Endpoints ) at node.Url() / node.WsUrl(), or use node.Provider().
+package fakenode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/NethermindEth/starknet.go/utils"
+	"github.com/b-j-roberts/foc-engine/internal/config"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/gorilla/websocket"
+)
+
+// Block statuses
+const (
+	StatusAcceptedOnL2 = "ACCEPTED_ON_L2"
+	StatusAcceptedOnL1 = "ACCEPTED_ON_L1"
+)
+
+// Timestamp of block 0, each block is 1 second after its parent
+const GenesisTimestamp = 1700000000
+
+// Event is an event emitted in a scripted block
+type Event struct {
+	FromAddress string
+	Keys        []string
+	Data        []string
+	// Generated if empty, events of a transaction must be consecutive
+	TransactionHash string
+	// Account of the transaction, DefaultSender if empty
+	Sender string
+}
+
+// Sender of transactions with no scripted sender
+const DefaultSender = "0x5e4de7"
+
+type Block struct {
+	Number     uint64
+	Hash       string
+	ParentHash string
+	Timestamp  uint64
+	Status     string
+	Events     []Event
+}
+
+// Node is a fake Starknet node serving a scripted chain
+type Node struct {
+	server *httptest.Server
+
+	mutex  sync.Mutex
+	blocks []*Block
+	// Incremented on each reorg, so replaced blocks get new hashes
+	fork    uint64
+	nextTx  uint64
+	classes map[string]json.RawMessage
+	// Map: Normalized address -> class hash
+	contracts map[string]string
+	// Map: Normalized address + selector -> starknet_call handler
+	calls map[string]CallHandler
+	// Map: Method -> errors returned by its next calls
+	failures map[string][]*provider.RpcError
+	// Map: Fixture key -> recorded response, see LoadFixtures
+	fixtures map[string]Fixture
+
+	wsMutex       sync.Mutex
+	conns         map[*wsConn]bool
+	subscriptions map[string]*subscription
+	nextSubId     uint64
+}
+
+// New starts a fake node with a genesis block
+func New() *Node {
+	node := &Node{
+		classes:       make(map[string]json.RawMessage),
+		contracts:     make(map[string]string),
+		calls:         make(map[string]CallHandler),
+		failures:      make(map[string][]*provider.RpcError),
+		fixtures:      make(map[string]Fixture),
+		conns:         make(map[*wsConn]bool),
+		subscriptions: make(map[string]*subscription),
+	}
+	node.blocks = []*Block{node.newBlock(0, "0x0")}
+	node.server = httptest.NewServer(node)
+	return node
+}
+
+func (n *Node) Close() {
+	n.DropConnections()
+	n.server.Close()
+}
+
+// Url returns the http JSON-RPC url of the node
+func (n *Node) Url() string {
+	return n.server.URL
+}
+
+// WsUrl returns the WebSocket url of the node
+func (n *Node) WsUrl() string {
+	return "ws" + strings.TrimPrefix(n.server.URL, "http") + "/ws"
+}
+
+// RpcEndpoint returns the endpoint config of the node
+func (n *Node) RpcEndpoint() config.RpcEndpointConfig {
+	return config.RpcEndpointConfig{
+		Url:   n.Url(),
+		WsUrl: n.WsUrl(),
+	}
+}
+
+// Provider returns an rpc provider of the node ( ex: for registry.RegistryOptions )
+func (n *Node) Provider() *provider.RpcProvider {
+	return provider.NewRpcProvider([]config.RpcEndpointConfig{n.RpcEndpoint()})
+}
+
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		n.serveWebSocket(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n.serveRpc(w, r)
+}
+
+func (n *Node) newBlock(number uint64, parentHash string) *Block {
+	return &Block{
+		Number:     number,
+		Hash:       fmt.Sprintf("0x%x%04x", number+1, n.fork),
+		ParentHash: parentHash,
+		Timestamp:  GenesisTimestamp + number,
+		Status:     StatusAcceptedOnL2,
+	}
+}
+
+// AddBlock appends a block with events to the chain & notifies the subscriptions
+func (n *Node) AddBlock(events ...Event) *Block {
+	n.mutex.Lock()
+	head := n.blocks[len(n.blocks)-1]
+	block := n.newBlock(head.Number+1, head.Hash)
+	for _, event := range events {
+		if event.TransactionHash == "" {
+			n.nextTx++
+			event.TransactionHash = fmt.Sprintf("0x7%x", n.nextTx)
+		}
+		block.Events = append(block.Events, event)
+	}
+	n.blocks = append(n.blocks, block)
+	n.mutex.Unlock()
+
+	n.notifyBlock(block)
+	return block
+}
+
+// AddBlocks appends count empty blocks
+func (n *Node) AddBlocks(count int) {
+	for i := 0; i < count; i++ {
+		n.AddBlock()
+	}
+}
+
+// Head returns the latest block
+func (n *Node) Head() *Block {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.blocks[len(n.blocks)-1]
+}
+
+// Block returns a block by number
+func (n *Node) Block(number uint64) (*Block, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if number >= uint64(len(n.blocks)) {
+		return nil, false
+	}
+	return n.blocks[number], true
+}
+
+// Reorg reverts the blocks from forkBlock onwards & notifies the subscriptions.
+// Blocks added afterwards replace them, with different hashes.
+func (n *Node) Reorg(forkBlock uint64) {
+	n.mutex.Lock()
+	if forkBlock == 0 || forkBlock >= uint64(len(n.blocks)) {
+		n.mutex.Unlock()
+		return
+	}
+	starting := n.blocks[forkBlock]
+	ending := n.blocks[len(n.blocks)-1]
+	n.blocks = n.blocks[:forkBlock]
+	n.fork++
+	n.mutex.Unlock()
+
+	n.notifyReorg(starting, ending)
+}
+
+// AcceptOnL1 moves the blocks up to blockNumber to ACCEPTED_ON_L1
+func (n *Node) AcceptOnL1(blockNumber uint64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, block := range n.blocks {
+		if block.Number <= blockNumber {
+			block.Status = StatusAcceptedOnL1
+		}
+	}
+}
+
+// SetClass serves class for classHash with starknet_getClass
+func (n *Node) SetClass(classHash string, class json.RawMessage) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.classes[normalize(classHash)] = class
+}
+
+// DeployContract deploys a contract of a class set with SetClass at address
+func (n *Node) DeployContract(address string, classHash string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.contracts[normalize(address)] = normalize(classHash)
+}
+
+// CallHandler returns the result felts of a starknet_call from its calldata
+type CallHandler func(calldata []string) ([]string, *provider.RpcError)
+
+// SetCall serves starknet_call of a contract's function with handler
+func (n *Node) SetCall(address string, function string, handler CallHandler) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.calls[callKey(address, utils.GetSelectorFromNameFelt(function).String())] = handler
+}
+
+func callKey(address string, selector string) string {
+	return normalize(address) + ":" + normalize(selector)
+}
+
+// FailNext makes the next call of method return err
+func (n *Node) FailNext(method string, err *provider.RpcError) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.failures[method] = append(n.failures[method], err)
+}
+
+// normalize returns a felt in lowercase with no leading zeros
+func normalize(felt string) string {
+	felt = strings.TrimPrefix(strings.ToLower(felt), "0x")
+	felt = strings.TrimLeft(felt, "0")
+	if felt == "" {
+		return "0x0"
+	}
+	return "0x" + felt
+}
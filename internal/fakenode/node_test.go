@@ -0,0 +1,137 @@
+package fakenode_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/fakenode"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/gorilla/websocket"
+)
+
+type emittedEvent struct {
+	FromAddress     string   `json:"from_address"`
+	Keys            []string `json:"keys"`
+	Data            []string `json:"data"`
+	BlockHash       string   `json:"block_hash"`
+	BlockNumber     uint64   `json:"block_number"`
+	TransactionHash string   `json:"transaction_hash"`
+}
+
+type notification struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Result json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func eventsFilter(address string, fromBlock uint64, toBlock uint64) []interface{} {
+	return []interface{}{map[string]interface{}{
+		"from_block": map[string]interface{}{"block_number": fromBlock},
+		"to_block":   map[string]interface{}{"block_number": toBlock},
+		"address":    address,
+		"chunk_size": 10,
+	}}
+}
+
+func TestNodeRpc(t *testing.T) {
+	node := fakenode.New()
+	defer node.Close()
+	first := node.AddBlock(fakenode.Event{FromAddress: "0xabc", Keys: []string{"0x1"}, Data: []string{"0x2"}})
+	node.AddBlock(fakenode.Event{FromAddress: "0xdef"})
+	client := provider.NewRpcClient(node.Url())
+	client.MaxRetries = 0
+
+	var blockNumber uint64
+	if err := client.Call(context.Background(), "starknet_blockNumber", []interface{}{}, &blockNumber); err != nil {
+		t.Fatal(err)
+	}
+	if blockNumber != node.Head().Number {
+		t.Errorf("block number = %d, want %d", blockNumber, node.Head().Number)
+	}
+
+	var page struct {
+		Events []emittedEvent `json:"events"`
+	}
+	if err := client.Call(context.Background(), "starknet_getEvents", eventsFilter("0x0abc", 0, blockNumber), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(page.Events))
+	}
+	if event := page.Events[0]; event.BlockHash != first.Hash || event.BlockNumber != first.Number || event.Data[0] != "0x2" {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Injected failures are returned once
+	node.FailNext("starknet_blockNumber", &provider.RpcError{Code: provider.RpcErrBlockNotFound, Message: "Block not found"})
+	if err := client.Call(context.Background(), "starknet_blockNumber", []interface{}{}, &blockNumber); !provider.IsRpcError(err, provider.RpcErrBlockNotFound) {
+		t.Errorf("injected failure error = %v", err)
+	}
+	if err := client.Call(context.Background(), "starknet_blockNumber", []interface{}{}, &blockNumber); err != nil {
+		t.Errorf("call after the failure: %v", err)
+	}
+}
+
+func TestNodeWebSocket(t *testing.T) {
+	node := fakenode.New()
+	defer node.Close()
+	past := node.AddBlock(fakenode.Event{FromAddress: "0xabc"})
+	node.AddBlock(fakenode.Event{FromAddress: "0xdef"})
+
+	conn, _, err := websocket.DefaultDialer.Dial(node.WsUrl(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() notification {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var message notification
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	err = conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "starknet_subscribeEvents",
+		"params": map[string]interface{}{
+			"from_address": "0xabc",
+			"block_id":     map[string]interface{}{"block_number": past.Number},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := read(); string(response.ID) != "1" {
+		t.Fatalf("subscription response = %+v", response)
+	}
+
+	// Past events are replayed, then new blocks notified
+	live := node.AddBlock(fakenode.Event{FromAddress: "0xabc"})
+	for _, block := range []*fakenode.Block{past, live} {
+		message := read()
+		var event emittedEvent
+		if err := json.Unmarshal(message.Params.Result, &event); err != nil {
+			t.Fatal(err)
+		}
+		if message.Method != "starknet_subscriptionEvents" || event.BlockHash != block.Hash {
+			t.Errorf("notification = %s %s, want the event of block %d", message.Method, message.Params.Result, block.Number)
+		}
+	}
+
+	// Reorged blocks are replaced with different hashes
+	node.Reorg(live.Number)
+	if message := read(); message.Method != "starknet_subscriptionReorg" {
+		t.Errorf("notification = %s, want starknet_subscriptionReorg", message.Method)
+	}
+	replacement := node.AddBlock()
+	if replacement.Number != live.Number || replacement.Hash == live.Hash {
+		t.Errorf("replacement block = %+v, reverted %+v", replacement, live)
+	}
+}
@@ -0,0 +1,488 @@
+package fakenode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+// Events per starknet_getEvents page when the request has no chunk_size
+const defaultChunkSize = 100
+
+type rpcRequest struct {
+	ID      json.RawMessage `json:"id"`
+	Jsonrpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	ID      json.RawMessage    `json:"id"`
+	Jsonrpc string             `json:"jsonrpc"`
+	Result  interface{}        `json:"result,omitempty"`
+	Error   *provider.RpcError `json:"error,omitempty"`
+}
+
+func (n *Node) serveRpc(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var requests []rpcRequest
+		if err := json.Unmarshal(body, &requests); err != nil {
+			json.NewEncoder(w).Encode(parseErrorResponse(err))
+			return
+		}
+		responses := make([]rpcResponse, 0, len(requests))
+		for _, request := range requests {
+			responses = append(responses, n.handle(request))
+		}
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	var request rpcRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		json.NewEncoder(w).Encode(parseErrorResponse(err))
+		return
+	}
+	json.NewEncoder(w).Encode(n.handle(request))
+}
+
+func parseErrorResponse(err error) rpcResponse {
+	return rpcResponse{
+		ID:      json.RawMessage("null"),
+		Jsonrpc: "2.0",
+		Error:   &provider.RpcError{Code: provider.RpcErrParseError, Message: err.Error()},
+	}
+}
+
+func (n *Node) handle(request rpcRequest) rpcResponse {
+	response := rpcResponse{
+		ID:      request.ID,
+		Jsonrpc: "2.0",
+	}
+	result, rpcErr := n.call(request.Method, request.Params)
+	if rpcErr != nil {
+		response.Error = rpcErr
+	} else {
+		response.Result = result
+	}
+	return response
+}
+
+// call returns the result of a call, from the injected failures, the loaded
+// fixtures or the scripted chain in that order
+func (n *Node) call(method string, params json.RawMessage) (interface{}, *provider.RpcError) {
+	n.mutex.Lock()
+	if failures := n.failures[method]; len(failures) > 0 {
+		n.failures[method] = failures[1:]
+		n.mutex.Unlock()
+		return nil, failures[0]
+	}
+	fixture, ok := n.fixtures[fixtureKey(method, params)]
+	n.mutex.Unlock()
+	if ok {
+		if fixture.Error != nil {
+			return nil, fixture.Error
+		}
+		return fixture.Result, nil
+	}
+
+	switch method {
+	case "starknet_chainId":
+		return "0x534e5f5345504f4c4941", nil
+	case "starknet_specVersion":
+		return "0.8.1", nil
+	case "starknet_blockNumber":
+		return n.Head().Number, nil
+	case "starknet_blockHashAndNumber":
+		head := n.Head()
+		return map[string]interface{}{
+			"block_hash":   head.Hash,
+			"block_number": head.Number,
+		}, nil
+	case "starknet_getBlockWithTxHashes":
+		return n.getBlockWithTxHashes(params)
+	case "starknet_getEvents":
+		return n.getEvents(params)
+	case "starknet_getTransactionByHash":
+		return n.getTransaction(params, false)
+	case "starknet_getTransactionReceipt":
+		return n.getTransaction(params, true)
+	case "starknet_call":
+		return n.callContract(params)
+	case "starknet_getClass":
+		return n.getClass(params)
+	case "starknet_getClassHashAt":
+		return n.getClassHashAt(params)
+	case "starknet_getClassAt":
+		classHash, rpcErr := n.getClassHashAt(params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return n.classByHash(classHash)
+	}
+	return nil, &provider.RpcError{Code: provider.RpcErrMethodNotFound, Message: "Method not found: " + method}
+}
+
+func invalidParams(err error) *provider.RpcError {
+	return &provider.RpcError{Code: provider.RpcErrInvalidParams, Message: "Invalid params", Data: err.Error()}
+}
+
+// param returns a named or positional param of a call
+func param(params json.RawMessage, name string, position int) (json.RawMessage, error) {
+	params = bytes.TrimSpace(params)
+	if len(params) > 0 && params[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); err != nil {
+			return nil, err
+		}
+		if position >= len(positional) {
+			return nil, fmt.Errorf("missing param %s", name)
+		}
+		return positional[position], nil
+	}
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(params, &named); err != nil {
+		return nil, err
+	}
+	value, ok := named[name]
+	if !ok {
+		return nil, fmt.Errorf("missing param %s", name)
+	}
+	return value, nil
+}
+
+func stringParam(params json.RawMessage, name string, position int) (string, error) {
+	raw, err := param(params, name, position)
+	if err != nil {
+		return "", err
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// resolveBlock returns the block of a block id ( "latest", {"block_number"} or {"block_hash"} )
+func (n *Node) resolveBlock(blockId json.RawMessage) (*Block, *provider.RpcError) {
+	blockNotFound := &provider.RpcError{Code: provider.RpcErrBlockNotFound, Message: "Block not found"}
+	var tag string
+	if err := json.Unmarshal(blockId, &tag); err == nil {
+		if tag == "latest" {
+			return n.Head(), nil
+		}
+		// No pending block, the chain only has accepted blocks
+		return nil, blockNotFound
+	}
+	var id struct {
+		BlockNumber *uint64 `json:"block_number"`
+		BlockHash   string  `json:"block_hash"`
+	}
+	if err := json.Unmarshal(blockId, &id); err != nil {
+		return nil, invalidParams(err)
+	}
+	if id.BlockNumber != nil {
+		block, ok := n.Block(*id.BlockNumber)
+		if !ok {
+			return nil, blockNotFound
+		}
+		return block, nil
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, block := range n.blocks {
+		if block.Hash == id.BlockHash {
+			return block, nil
+		}
+	}
+	return nil, blockNotFound
+}
+
+func (n *Node) getBlockWithTxHashes(params json.RawMessage) (interface{}, *provider.RpcError) {
+	blockId, err := param(params, "block_id", 0)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	block, rpcErr := n.resolveBlock(blockId)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	transactions := []string{}
+	for i, event := range block.Events {
+		if i == 0 || block.Events[i-1].TransactionHash != event.TransactionHash {
+			transactions = append(transactions, event.TransactionHash)
+		}
+	}
+	return map[string]interface{}{
+		"block_hash":        block.Hash,
+		"parent_hash":       block.ParentHash,
+		"block_number":      block.Number,
+		"timestamp":         block.Timestamp,
+		"status":            block.Status,
+		"sequencer_address": "0x1",
+		"transactions":      transactions,
+	}, nil
+}
+
+type eventsFilter struct {
+	FromBlock         json.RawMessage `json:"from_block"`
+	ToBlock           json.RawMessage `json:"to_block"`
+	Address           string          `json:"address"`
+	Keys              [][]string      `json:"keys"`
+	ChunkSize         int             `json:"chunk_size"`
+	ContinuationToken string          `json:"continuation_token"`
+}
+
+// emittedEvent returns the rpc representation of the index-th event of a block
+func emittedEvent(block *Block, index int) map[string]interface{} {
+	event := block.Events[index]
+	return map[string]interface{}{
+		"from_address":     event.FromAddress,
+		"keys":             nonNil(event.Keys),
+		"data":             nonNil(event.Data),
+		"block_hash":       block.Hash,
+		"block_number":     block.Number,
+		"transaction_hash": event.TransactionHash,
+	}
+}
+
+func nonNil(felts []string) []string {
+	if felts == nil {
+		return []string{}
+	}
+	return felts
+}
+
+// matchesEvent reports whether an event is emitted by address ( any if empty ) &
+// matches keys, where each position lists the accepted values ( any if empty )
+func matchesEvent(event Event, address string, keys [][]string) bool {
+	if address != "" && normalize(event.FromAddress) != normalize(address) {
+		return false
+	}
+	for i, accepted := range keys {
+		if len(accepted) == 0 {
+			continue
+		}
+		if i >= len(event.Keys) {
+			return false
+		}
+		found := false
+		for _, key := range accepted {
+			if normalize(key) == normalize(event.Keys[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) getEvents(params json.RawMessage) (interface{}, *provider.RpcError) {
+	rawFilter, err := param(params, "filter", 0)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	var filter eventsFilter
+	if err := json.Unmarshal(rawFilter, &filter); err != nil {
+		return nil, invalidParams(err)
+	}
+	fromBlock, toBlock := uint64(0), n.Head().Number
+	if len(filter.FromBlock) > 0 {
+		block, rpcErr := n.resolveBlock(filter.FromBlock)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		fromBlock = block.Number
+	}
+	if len(filter.ToBlock) > 0 {
+		block, rpcErr := n.resolveBlock(filter.ToBlock)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		toBlock = block.Number
+	}
+	chunkSize := filter.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	// Continuation tokens are the offset in the matching events
+	offset := 0
+	if filter.ContinuationToken != "" {
+		offset, err = strconv.Atoi(filter.ContinuationToken)
+		if err != nil || offset < 0 {
+			return nil, &provider.RpcError{Code: provider.RpcErrInvalidContinuationToken, Message: "Invalid continuation token"}
+		}
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	events := []map[string]interface{}{}
+	matched := 0
+	for _, block := range n.blocks {
+		if block.Number < fromBlock || block.Number > toBlock {
+			continue
+		}
+		for i, event := range block.Events {
+			if !matchesEvent(event, filter.Address, filter.Keys) {
+				continue
+			}
+			matched++
+			if matched <= offset {
+				continue
+			}
+			if len(events) == chunkSize {
+				return map[string]interface{}{
+					"events":             events,
+					"continuation_token": strconv.Itoa(offset + chunkSize),
+				}, nil
+			}
+			events = append(events, emittedEvent(block, i))
+		}
+	}
+	return map[string]interface{}{
+		"events": events,
+	}, nil
+}
+
+// getTransaction returns an INVOKE transaction, or its receipt, built from the events
+// emitted with its hash
+func (n *Node) getTransaction(params json.RawMessage, receipt bool) (interface{}, *provider.RpcError) {
+	transactionHash, err := stringParam(params, "transaction_hash", 0)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, block := range n.blocks {
+		var events []map[string]interface{}
+		sender := ""
+		for _, event := range block.Events {
+			if normalize(event.TransactionHash) != normalize(transactionHash) {
+				continue
+			}
+			if sender == "" {
+				sender = event.Sender
+			}
+			events = append(events, map[string]interface{}{
+				"from_address": event.FromAddress,
+				"keys":         nonNil(event.Keys),
+				"data":         nonNil(event.Data),
+			})
+		}
+		if events == nil {
+			continue
+		}
+		if !receipt {
+			if sender == "" {
+				sender = DefaultSender
+			}
+			return map[string]interface{}{
+				"transaction_hash": transactionHash,
+				"type":             "INVOKE",
+				"version":          "0x3",
+				"sender_address":   sender,
+				"nonce":            "0x0",
+				"calldata":         []string{},
+				"signature":        []string{},
+			}, nil
+		}
+		return map[string]interface{}{
+			"transaction_hash": transactionHash,
+			"type":             "INVOKE",
+			"execution_status": "SUCCEEDED",
+			"finality_status":  block.Status,
+			"actual_fee": map[string]interface{}{
+				"amount": "0x1",
+				"unit":   "FRI",
+			},
+			"block_hash":    block.Hash,
+			"block_number":  block.Number,
+			"events":        events,
+			"messages_sent": []interface{}{},
+			"execution_resources": map[string]interface{}{
+				"l1_gas":      0,
+				"l1_data_gas": 0,
+				"l2_gas":      0,
+			},
+		}, nil
+	}
+	return nil, &provider.RpcError{Code: provider.RpcErrTxnHashNotFound, Message: "Transaction hash not found"}
+}
+
+func (n *Node) callContract(params json.RawMessage) (interface{}, *provider.RpcError) {
+	rawRequest, err := param(params, "request", 0)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	var request struct {
+		ContractAddress    string   `json:"contract_address"`
+		EntryPointSelector string   `json:"entry_point_selector"`
+		Calldata           []string `json:"calldata"`
+	}
+	if err := json.Unmarshal(rawRequest, &request); err != nil {
+		return nil, invalidParams(err)
+	}
+	n.mutex.Lock()
+	handler, ok := n.calls[callKey(request.ContractAddress, request.EntryPointSelector)]
+	_, deployed := n.contracts[normalize(request.ContractAddress)]
+	n.mutex.Unlock()
+	if !ok {
+		if !deployed {
+			return nil, &provider.RpcError{Code: provider.RpcErrContractNotFound, Message: "Contract not found"}
+		}
+		return nil, &provider.RpcError{Code: provider.RpcErrContractError, Message: "Contract error", Data: "entry point not found"}
+	}
+	result, rpcErr := handler(request.Calldata)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return nonNil(result), nil
+}
+
+func (n *Node) classByHash(classHash string) (interface{}, *provider.RpcError) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	class, ok := n.classes[normalize(classHash)]
+	if !ok {
+		return nil, &provider.RpcError{Code: provider.RpcErrClassHashNotFound, Message: "Class hash not found"}
+	}
+	return class, nil
+}
+
+func (n *Node) getClass(params json.RawMessage) (interface{}, *provider.RpcError) {
+	classHash, err := stringParam(params, "class_hash", 1)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	return n.classByHash(classHash)
+}
+
+func (n *Node) getClassHashAt(params json.RawMessage) (string, *provider.RpcError) {
+	address, err := stringParam(params, "contract_address", 1)
+	if err != nil {
+		return "", invalidParams(err)
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	classHash, ok := n.contracts[normalize(address)]
+	if !ok {
+		return "", &provider.RpcError{Code: provider.RpcErrContractNotFound, Message: "Contract not found"}
+	}
+	return classHash, nil
+}
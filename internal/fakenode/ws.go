@@ -0,0 +1,264 @@
+package fakenode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/gorilla/websocket"
+)
+
+// Subscription kinds
+const (
+	subscriptionNewHeads = "newHeads"
+	subscriptionEvents   = "events"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type wsConn struct {
+	conn *websocket.Conn
+	// Serializes writes, notifications are sent from the scripting goroutine
+	writeMutex sync.Mutex
+}
+
+func (c *wsConn) write(message interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteJSON(message)
+}
+
+type subscription struct {
+	// Subscription ids are strings since rpc v0.8
+	id      string
+	kind    string
+	address string
+	conn    *wsConn
+}
+
+func (n *Node) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &wsConn{conn: conn}
+	n.wsMutex.Lock()
+	n.conns[c] = true
+	n.wsMutex.Unlock()
+	defer n.dropConnection(c)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var request rpcRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			c.write(parseErrorResponse(err))
+			continue
+		}
+		n.handleWebSocket(c, request)
+	}
+}
+
+func (n *Node) dropConnection(c *wsConn) {
+	n.wsMutex.Lock()
+	delete(n.conns, c)
+	for id, sub := range n.subscriptions {
+		if sub.conn == c {
+			delete(n.subscriptions, id)
+		}
+	}
+	n.wsMutex.Unlock()
+	c.conn.Close()
+}
+
+// DropConnections closes every WebSocket connection, as a node restart would
+func (n *Node) DropConnections() {
+	n.wsMutex.Lock()
+	conns := make([]*wsConn, 0, len(n.conns))
+	for c := range n.conns {
+		conns = append(conns, c)
+	}
+	n.wsMutex.Unlock()
+	for _, c := range conns {
+		c.conn.Close()
+	}
+}
+
+// Subscriptions returns the number of active subscriptions
+func (n *Node) Subscriptions() int {
+	n.wsMutex.Lock()
+	defer n.wsMutex.Unlock()
+	return len(n.subscriptions)
+}
+
+func (n *Node) handleWebSocket(c *wsConn, request rpcRequest) {
+	response := rpcResponse{
+		ID:      request.ID,
+		Jsonrpc: "2.0",
+	}
+	switch request.Method {
+	case "starknet_subscribeNewHeads":
+		response.Result = n.subscribe(c, subscriptionNewHeads, "")
+		c.write(response)
+	case "starknet_subscribeEvents":
+		n.subscribeEvents(c, request)
+	case "starknet_unsubscribe":
+		response.Result, response.Error = n.unsubscribe(request.Params)
+		c.write(response)
+	default:
+		// Plain calls are also served over the WebSocket
+		result, rpcErr := n.call(request.Method, request.Params)
+		if rpcErr != nil {
+			response.Error = rpcErr
+		} else {
+			response.Result = result
+		}
+		c.write(response)
+	}
+}
+
+func (n *Node) subscribe(c *wsConn, kind string, address string) string {
+	n.wsMutex.Lock()
+	defer n.wsMutex.Unlock()
+	n.nextSubId++
+	id := fmt.Sprint(n.nextSubId)
+	n.subscriptions[id] = &subscription{
+		id:      id,
+		kind:    kind,
+		address: address,
+		conn:    c,
+	}
+	return id
+}
+
+// subscribeEvents subscribes to the events of from_address ( all if empty ) & replays
+// the events from block_id to the head, as nodes do
+func (n *Node) subscribeEvents(c *wsConn, request rpcRequest) {
+	response := rpcResponse{
+		ID:      request.ID,
+		Jsonrpc: "2.0",
+	}
+	address, _ := stringParam(request.Params, "from_address", 0)
+	fromBlock := n.Head().Number + 1
+	if blockId, err := param(request.Params, "block_id", 2); err == nil {
+		block, rpcErr := n.resolveBlock(blockId)
+		if rpcErr != nil {
+			response.Error = rpcErr
+			c.write(response)
+			return
+		}
+		fromBlock = block.Number
+	}
+
+	// Subscribed under the chain lock, so no block is both replayed & notified
+	n.mutex.Lock()
+	id := n.subscribe(c, subscriptionEvents, address)
+	var past []map[string]interface{}
+	for _, block := range n.blocks {
+		if block.Number < fromBlock {
+			continue
+		}
+		for i, event := range block.Events {
+			if matchesEvent(event, address, nil) {
+				past = append(past, emittedEvent(block, i))
+			}
+		}
+	}
+	n.mutex.Unlock()
+
+	response.Result = id
+	c.write(response)
+	for _, event := range past {
+		c.write(notification("starknet_subscriptionEvents", id, event))
+	}
+}
+
+func (n *Node) unsubscribe(params json.RawMessage) (interface{}, *provider.RpcError) {
+	raw, err := param(params, "subscription_id", 0)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	// Accepts string & numeric ids
+	var id interface{}
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return nil, invalidParams(err)
+	}
+	key := fmt.Sprint(id)
+	n.wsMutex.Lock()
+	defer n.wsMutex.Unlock()
+	if _, ok := n.subscriptions[key]; !ok {
+		return nil, &provider.RpcError{Code: provider.RpcErrInvalidSubscriptionId, Message: "Invalid subscription id"}
+	}
+	delete(n.subscriptions, key)
+	return true, nil
+}
+
+func notification(method string, subscriptionId string, result interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params": map[string]interface{}{
+			"subscription_id": subscriptionId,
+			"result":          result,
+		},
+	}
+}
+
+// subscriptionsOf returns the active subscriptions of a kind
+func (n *Node) subscriptionsOf(kind string) []*subscription {
+	n.wsMutex.Lock()
+	defer n.wsMutex.Unlock()
+	var subs []*subscription
+	for _, sub := range n.subscriptions {
+		if sub.kind == kind {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func blockHeader(block *Block) map[string]interface{} {
+	return map[string]interface{}{
+		"block_hash":        block.Hash,
+		"parent_hash":       block.ParentHash,
+		"block_number":      block.Number,
+		"timestamp":         block.Timestamp,
+		"sequencer_address": "0x1",
+	}
+}
+
+// notifyBlock sends a new block's header & events to the subscriptions
+func (n *Node) notifyBlock(block *Block) {
+	for _, sub := range n.subscriptionsOf(subscriptionNewHeads) {
+		sub.conn.write(notification("starknet_subscriptionNewHeads", sub.id, blockHeader(block)))
+	}
+	for _, sub := range n.subscriptionsOf(subscriptionEvents) {
+		for i, event := range block.Events {
+			if matchesEvent(event, sub.address, nil) {
+				sub.conn.write(notification("starknet_subscriptionEvents", sub.id, emittedEvent(block, i)))
+			}
+		}
+	}
+}
+
+// notifyReorg sends the reverted block range to the subscriptions
+func (n *Node) notifyReorg(starting *Block, ending *Block) {
+	reorg := map[string]interface{}{
+		"starting_block_hash":   starting.Hash,
+		"starting_block_number": starting.Number,
+		"ending_block_hash":     ending.Hash,
+		"ending_block_number":   ending.Number,
+	}
+	for _, sub := range n.subscriptionsOf(subscriptionNewHeads) {
+		sub.conn.write(notification("starknet_subscriptionReorg", sub.id, reorg))
+	}
+	for _, sub := range n.subscriptionsOf(subscriptionEvents) {
+		sub.conn.write(notification("starknet_subscriptionReorg", sub.id, reorg))
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
 )
 
 // Config holds the configuration for the standalone indexer
@@ -40,6 +42,9 @@ type Indexer struct {
 	// Storage backend
 	storage *Storage
 	
+	// Shared Starknet JSON-RPC client
+	rpcClient *provider.RpcClient
+	
 	// State
 	currentBlock  uint64
 	running       bool
@@ -94,6 +99,7 @@ func New(config Config) (*Indexer, error) {
 	return &Indexer{
 		config:       config,
 		storage:      storage,
+		rpcClient:    provider.NewRpcClient(config.RPC),
 		currentBlock: startingBlock,
 		stopChan:     make(chan struct{}),
 	}, nil
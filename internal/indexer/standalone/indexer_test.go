@@ -0,0 +1,150 @@
+package standalone
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/starknet.go/utils"
+	"github.com/b-j-roberts/foc-engine/internal/fakenode"
+)
+
+const (
+	testContract = "0x4c1"
+	testOther    = "0x4c2"
+)
+
+// eventually fails the test if condition isn't true within a few seconds
+func eventually(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var testTransactions uint64
+
+// scoreEvent returns an event with a full length transaction hash, as nodes send
+func scoreEvent(fromAddress string, event string, score string) fakenode.Event {
+	testTransactions++
+	return fakenode.Event{
+		TransactionHash: fmt.Sprintf("0x%064x", testTransactions),
+		FromAddress:     fromAddress,
+		Keys:            []string{utils.GetSelectorFromNameFelt(event).String(), "0x1"},
+		Data:            []string{score},
+	}
+}
+
+func newTestIndexer(t *testing.T, node *fakenode.Node, dataDir string) *Indexer {
+	t.Helper()
+	idx, err := New(Config{
+		Contract: testContract,
+		Event:    "Scored",
+		OrderBy:  2,
+		Unique:   -1,
+		RPC:      node.Url(),
+		DataDir:  dataDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+// indexedScores returns the data of the stored events, ordered by score
+func indexedScores(t *testing.T, idx *Indexer) []string {
+	t.Helper()
+	events, _, err := idx.GetEvents(0, 100, "asc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := []string{}
+	for _, event := range events {
+		scores = append(scores, event.Data[0])
+	}
+	return scores
+}
+
+// Start serves the query api on the default mux, so it's only started by this test
+func TestIndexerWebSocket(t *testing.T) {
+	t.Setenv("INDEXER_PORT", "0")
+	node := fakenode.New()
+	defer node.Close()
+	node.AddBlock(scoreEvent(testContract, "Scored", "0x2"))
+	node.AddBlock(scoreEvent(testContract, "Joined", "0x5"), scoreEvent(testOther, "Scored", "0x6"))
+
+	idx := newTestIndexer(t, node, t.TempDir())
+	defer idx.Close()
+	go idx.Start()
+
+	eventually(t, "the past event", func() bool {
+		return idx.GetEventCount() == 1
+	})
+	node.AddBlock(scoreEvent(testContract, "Scored", "0x1"))
+	eventually(t, "the live event", func() bool {
+		return idx.GetEventCount() == 2
+	})
+
+	// Other events & contracts are filtered out
+	scores := indexedScores(t, idx)
+	if len(scores) != 2 || scores[0] != padHex("0x1") || scores[1] != padHex("0x2") {
+		t.Errorf("indexed scores = %v, want [0x1 0x2]", scores)
+	}
+	if current := idx.GetCurrentBlock(); current != node.Head().Number {
+		t.Errorf("current block = %d, want %d", current, node.Head().Number)
+	}
+}
+
+func TestIndexerPolling(t *testing.T) {
+	node := fakenode.New()
+	defer node.Close()
+	node.AddBlock(scoreEvent(testContract, "Scored", "0x2"))
+	node.AddBlock(scoreEvent(testContract, "Joined", "0x5"), scoreEvent(testOther, "Scored", "0x6"))
+	dataDir := t.TempDir()
+
+	idx := newTestIndexer(t, node, dataDir)
+	idx.running = true
+	idx.eventSelector = idx.computeEventSelector(idx.config.Event)
+	done := make(chan error)
+	go func() {
+		done <- idx.startPollingLoop()
+	}()
+
+	eventually(t, "the polled event", func() bool {
+		return idx.GetEventCount() == 1
+	})
+	head := node.AddBlock(scoreEvent(testContract, "Scored", "0x1"))
+	eventually(t, "the event of the new block", func() bool {
+		return idx.GetEventCount() == 2
+	})
+	eventually(t, "the last processed block", func() bool {
+		lastProcessed, err := idx.GetLastProcessedBlock()
+		return err == nil && lastProcessed == head.Number
+	})
+	scores := indexedScores(t, idx)
+	if len(scores) != 2 || scores[0] != padHex("0x1") || scores[1] != padHex("0x2") {
+		t.Errorf("indexed scores = %v, want [0x1 0x2]", scores)
+	}
+
+	idx.Stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restarts resume after the last processed block
+	restarted := newTestIndexer(t, node, dataDir)
+	defer restarted.storage.Close()
+	if current := restarted.GetCurrentBlock(); current != head.Number+1 {
+		t.Errorf("restarted from block %d, want %d", current, head.Number+1)
+	}
+	if count := restarted.GetEventCount(); count != 2 {
+		t.Errorf("restarted with %d events, want 2", count)
+	}
+}
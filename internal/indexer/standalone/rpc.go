@@ -1,11 +1,8 @@
 package standalone
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strings"
 	"time"
 
@@ -20,14 +17,6 @@ type StarknetRpcCall struct {
 	Params  interface{} `json:"params"`
 }
 
-// StarknetRpcResponse represents a JSON-RPC response from Starknet
-type StarknetRpcResponse struct {
-	Jsonrpc string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Result  interface{} `json:"result"`
-	Error   interface{} `json:"error"`
-}
-
 // EventFilter represents the filter for querying events
 type EventFilter struct {
 	FromBlock   *BlockID     `json:"from_block,omitempty"`
@@ -54,37 +43,18 @@ type Event struct {
 
 // EventsResult represents the result of get_events call
 type EventsResult struct {
-	Events []Event `json:"events"`
+	Events            []Event `json:"events"`
+	ContinuationToken string  `json:"continuation_token,omitempty"`
 }
 
 // getLatestBlockNumber gets the latest block number from the RPC
 func (idx *Indexer) getLatestBlockNumber() (uint64, error) {
-	call := StarknetRpcCall{
-		ID:      1,
-		Jsonrpc: "2.0",
-		Method:  "starknet_blockNumber",
-		Params:  []interface{}{},
-	}
-	
-	response, err := idx.makeRPCCall(call)
+	var blockNum uint64
+	err := idx.rpcClient.Call(context.Background(), "starknet_blockNumber", []interface{}{}, &blockNum)
 	if err != nil {
 		return 0, err
 	}
 	
-	// Parse the block number from response
-	// The result can be either a float64 or an int
-	var blockNum uint64
-	switch v := response.Result.(type) {
-	case float64:
-		blockNum = uint64(v)
-	case int:
-		blockNum = uint64(v)
-	case int64:
-		blockNum = uint64(v)
-	default:
-		return 0, fmt.Errorf("unexpected response type for block number: %T", response.Result)
-	}
-	
 	return blockNum, nil
 }
 
@@ -114,47 +84,13 @@ func (idx *Indexer) getEventsInRange(fromBlock, toBlock uint64, continuationToke
 		params["continuation_token"] = continuationToken
 	}
 	
-	call := StarknetRpcCall{
-		ID:      1,
-		Jsonrpc: "2.0",
-		Method:  "starknet_getEvents",
-		Params:  []interface{}{params},
-	}
-	
-	response, err := idx.makeRPCCall(call)
+	var result EventsResult
+	err := idx.rpcClient.Call(context.Background(), "starknet_getEvents", []interface{}{params}, &result)
 	if err != nil {
 		return nil, "", err
 	}
-	
-	// Parse the response result structure
-	resultMap, ok := response.Result.(map[string]interface{})
-	if !ok {
-		return nil, "", fmt.Errorf("unexpected response result format")
-	}
-	
-	// Extract events array
-	eventsInterface, ok := resultMap["events"]
-	if !ok {
-		return nil, "", fmt.Errorf("no events field in response")
-	}
-	
-	eventsJson, err := json.Marshal(eventsInterface)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to marshal events: %v", err)
-	}
-	
-	var events []Event
-	if err := json.Unmarshal(eventsJson, &events); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal events: %v", err)
-	}
-	
-	// Extract continuation token (if present)
-	var nextToken string
-	if token, ok := resultMap["continuation_token"]; ok {
-		if tokenStr, ok := token.(string); ok {
-			nextToken = tokenStr
-		}
-	}
+	events := result.Events
+	nextToken := result.ContinuationToken
 	
 	// Convert to EventData
 	var eventData []EventData
@@ -184,44 +120,6 @@ func (idx *Indexer) getEventsAtBlock(blockNumber uint64) ([]EventData, error) {
 	return events, err
 }
 
-// makeRPCCall makes a JSON-RPC call to the Starknet node
-func (idx *Indexer) makeRPCCall(call StarknetRpcCall) (*StarknetRpcResponse, error) {
-	callBytes, err := json.Marshal(call)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal RPC call: %v", err)
-	}
-	
-	// Convert WebSocket URLs to HTTP for RPC calls
-	rpcURL := idx.config.RPC
-	if strings.HasPrefix(rpcURL, "wss://") {
-		rpcURL = strings.Replace(rpcURL, "wss://", "https://", 1)
-	} else if strings.HasPrefix(rpcURL, "ws://") {
-		rpcURL = strings.Replace(rpcURL, "ws://", "http://", 1)
-	}
-	
-	resp, err := http.Post(rpcURL, "application/json", bytes.NewBuffer(callBytes))
-	if err != nil {
-		return nil, fmt.Errorf("failed to make RPC call: %v", err)
-	}
-	defer resp.Body.Close()
-	
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
-	}
-	
-	var response StarknetRpcResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
-	}
-	
-	if response.Error != nil {
-		return nil, fmt.Errorf("RPC error: %v", response.Error)
-	}
-	
-	return &response, nil
-}
-
 // normalizeAddress normalizes a Starknet address to 0x-prefixed 64-char hex
 func (idx *Indexer) normalizeAddress(address string) string {
 	// Remove 0x prefix if present
@@ -0,0 +1,335 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Events per starknet_getEvents page
+const BackfillChunkSize = 1000
+
+// backfillJob indexes the past events of a contract, then subscribes to its new events
+type backfillJob struct {
+	address   string
+	fromBlock uint
+	// WebSocket connection the job subscribes on, jobs of previous connections are dropped
+	generation uint64
+	// Starts from the subscription cursor when run instead of fromBlock, so the progress
+	// of an interrupted job is kept
+	resume bool
+}
+
+type EventsPage struct {
+	// Raw emitted events, processed like starknet_subscriptionEvents results
+	Events            []json.RawMessage `json:"events"`
+	ContinuationToken string            `json:"continuation_token,omitempty"`
+}
+
+// GetStarknetEvents returns a page of the events emitted by address in [fromBlock, toBlock]
+func GetStarknetEvents(ctx context.Context, address string, fromBlock uint, toBlock uint, continuationToken string) (*EventsPage, error) {
+	return Default().Events(ctx, address, fromBlock, toBlock, continuationToken)
+}
+
+func (p *RpcProvider) Events(ctx context.Context, address string, fromBlock uint, toBlock uint, continuationToken string) (*EventsPage, error) {
+	filter := map[string]interface{}{
+		"from_block": map[string]interface{}{
+			"block_number": fromBlock,
+		},
+		"to_block": map[string]interface{}{
+			"block_number": toBlock,
+		},
+		"address":    address,
+		"chunk_size": BackfillChunkSize,
+	}
+	if continuationToken != "" {
+		filter["continuation_token"] = continuationToken
+	}
+	var page EventsPage
+	err := p.Endpoints.Call(ctx, "starknet_getEvents", map[string]interface{}{"filter": filter}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (p *RpcProvider) processEventData(message []byte) {
+	p.processMutex.Lock()
+	defer p.processMutex.Unlock()
+	p.options.ProcessStarknetEventData(message)
+}
+
+// eventOccurrences numbers the identical events ( same contract, keys & data ) of a
+// transaction in starknet_getEvents order. Ranges start at a block, so every fetch
+// of a range numbers its events the same way.
+type eventOccurrences struct {
+	transactionHash string
+	// Map: Keys & data -> identical events seen in the transaction
+	seen map[string]uint
+}
+
+type occurrenceEvent struct {
+	TransactionHash string   `json:"transaction_hash"`
+	Keys            []string `json:"keys"`
+	Data            []string `json:"data"`
+}
+
+// next returns the number of identical events before event in its transaction
+func (o *eventOccurrences) next(event json.RawMessage) uint {
+	var emitted occurrenceEvent
+	if err := json.Unmarshal(event, &emitted); err != nil {
+		return 0
+	}
+	if emitted.TransactionHash != o.transactionHash || o.seen == nil {
+		o.transactionHash = emitted.TransactionHash
+		o.seen = make(map[string]uint)
+	}
+	key := strings.ToLower(strings.Join(emitted.Keys, ",") + "|" + strings.Join(emitted.Data, ","))
+	occurrence := o.seen[key]
+	o.seen[key] = occurrence + 1
+	return occurrence
+}
+
+// processEmittedEvent processes an event returned by starknet_getEvents as if it was
+// received from the events subscription, with its occurrence among the identical
+// events of its transaction ( see eventOccurrences )
+func (p *RpcProvider) processEmittedEvent(event json.RawMessage, occurrence uint) error {
+	message, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "starknet_subscriptionEvents",
+		"params": map[string]interface{}{
+			"subscription_id": 0,
+			"result":          event,
+			"occurrence":      occurrence,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.processEventData(message)
+	return nil
+}
+
+func (p *RpcProvider) enqueueBackfill(address string, fromBlock uint) {
+	p.wsMutex.Lock()
+	p.backfillJobs = append(p.backfillJobs, backfillJob{
+		address:    address,
+		fromBlock:  fromBlock,
+		generation: p.wsGeneration,
+	})
+	p.wsMutex.Unlock()
+	p.signalBackfill()
+}
+
+// enqueueResume queues a backfill of a contract from its cursor, unless one is already
+// queued on the current connection
+func (p *RpcProvider) enqueueResume(address string) {
+	p.wsMutex.Lock()
+	for _, job := range p.backfillJobs {
+		if job.generation == p.wsGeneration && normalizeAddress(job.address) == normalizeAddress(address) {
+			p.wsMutex.Unlock()
+			return
+		}
+	}
+	p.backfillJobs = append(p.backfillJobs, backfillJob{
+		address:    address,
+		generation: p.wsGeneration,
+		resume:     true,
+	})
+	p.wsMutex.Unlock()
+	p.signalBackfill()
+}
+
+func (p *RpcProvider) signalBackfill() {
+	select {
+	case p.backfillSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (p *RpcProvider) nextBackfill() (backfillJob, bool) {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if len(p.backfillJobs) == 0 {
+		return backfillJob{}, false
+	}
+	job := p.backfillJobs[0]
+	p.backfillJobs = p.backfillJobs[1:]
+	return job, true
+}
+
+func (p *RpcProvider) isCurrentGeneration(generation uint64) bool {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	return !p.closing && p.wsGeneration == generation
+}
+
+// runBackfills runs the queued backfills one at a time until the provider is closed
+func (p *RpcProvider) runBackfills() {
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.backfillSignal:
+		case <-p.closeChan:
+			return
+		}
+		for {
+			job, ok := p.nextBackfill()
+			if !ok {
+				break
+			}
+			if !p.isCurrentGeneration(job.generation) {
+				// Resubscribed by the reconnect
+				continue
+			}
+			if !p.isSubscribed(job.address) {
+				// Paused or removed
+				continue
+			}
+			if job.resume {
+				p.wsMutex.Lock()
+				job.fromBlock = p.subscriptionCursor(job.address)
+				p.wsMutex.Unlock()
+			}
+			if err := p.backfillAndSubscribe(job); err != nil {
+				fmt.Println("Error backfilling events for contract:", job.address, err)
+				// Fall back to the subscription replaying past events, as far back as the node allows
+				p.setBackfilledThrough(job.address, 0, false)
+				if err := p.sendSubscribeEvents(job.address, job.fromBlock); err != nil {
+					fmt.Println("Error subscribing to events for contract:", job.address, err)
+				}
+			}
+		}
+	}
+}
+
+// backfillAndSubscribe processes the events of the job's contract from its start block
+// to the current head with starknet_getEvents, then subscribes from the head. Nodes reject
+// subscriptions from future blocks, so the replayed events of backfilled blocks are skipped.
+func (p *RpcProvider) backfillAndSubscribe(job backfillJob) error {
+	head, err := p.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	// Resuming past the head, nothing to backfill
+	skipThrough := uint(head)
+	if uint64(job.fromBlock) > head {
+		skipThrough = job.fromBlock - 1
+	} else {
+		fmt.Printf("Backfilling events for contract %s from block %d to %d\n", job.address, job.fromBlock, head)
+		backfilled := 0
+		occurrences := &eventOccurrences{}
+		continuationToken := ""
+		for {
+			page, err := p.Events(context.Background(), job.address, job.fromBlock, uint(head), continuationToken)
+			if err != nil {
+				return err
+			}
+			for _, event := range page.Events {
+				if err := p.processEmittedEvent(event, occurrences.next(event)); err != nil {
+					return err
+				}
+				backfilled++
+			}
+			continuationToken = page.ContinuationToken
+			// Events are ordered by block, the blocks before the last event's are complete.
+			// Its block may continue on the next page.
+			if continuationToken != "" && len(page.Events) > 0 {
+				var last emittedEvent
+				if err := json.Unmarshal(page.Events[len(page.Events)-1], &last); err == nil && last.BlockNumber != nil && *last.BlockNumber > job.fromBlock {
+					p.setProcessedThrough(job.address, *last.BlockNumber-1)
+				}
+			}
+			if p.interrupted(job) {
+				return nil
+			}
+			if continuationToken == "" {
+				break
+			}
+		}
+		fmt.Printf("Backfilled %d events for contract %s\n", backfilled, job.address)
+	}
+	p.setProcessedThrough(job.address, skipThrough)
+	if p.interrupted(job) {
+		return nil
+	}
+	p.setBackfilledThrough(job.address, skipThrough, true)
+	return p.sendSubscribeEvents(job.address, uint(head))
+}
+
+// interrupted reports whether a backfill has to stop. Paused contracts restart from their
+// cursor once resumed, jobs of a previous connection are requeued from it.
+func (p *RpcProvider) interrupted(job backfillJob) bool {
+	if !p.isSubscribed(job.address) {
+		return true
+	}
+	if p.isCurrentGeneration(job.generation) {
+		return false
+	}
+	p.enqueueResume(job.address)
+	return true
+}
+
+// setBackfilledThrough sets ( or clears if !ok ) the last block of a contract whose
+// subscription events are skipped
+func (p *RpcProvider) setBackfilledThrough(address string, blockNumber uint, ok bool) {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if !ok {
+		delete(p.backfilledThrough, normalizeAddress(address))
+		return
+	}
+	p.backfilledThrough[normalizeAddress(address)] = blockNumber
+}
+
+type emittedEvent struct {
+	FromAddress string `json:"from_address"`
+	// Missing for pre-confirmed events
+	BlockNumber *uint `json:"block_number"`
+}
+
+type subscriptionEvent struct {
+	Params struct {
+		Result emittedEvent `json:"result"`
+	} `json:"params"`
+}
+
+// isBackfilledEvent reports whether a starknet_subscriptionEvents message replays an
+// event already processed by the backfill
+func (p *RpcProvider) isBackfilledEvent(message []byte) bool {
+	var event subscriptionEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		return false
+	}
+	return p.isBackfilled(event.Params.Result)
+}
+
+// isBackfilledEmittedEvent reports whether a starknet_getEvents event was already
+// processed by the backfill
+func (p *RpcProvider) isBackfilledEmittedEvent(message json.RawMessage) bool {
+	var event emittedEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		return false
+	}
+	return p.isBackfilled(event)
+}
+
+func (p *RpcProvider) isBackfilled(event emittedEvent) bool {
+	if event.BlockNumber == nil {
+		return false
+	}
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	blockNumber, ok := p.backfilledThrough[normalizeAddress(event.FromAddress)]
+	return ok && *event.BlockNumber <= blockNumber
+}
+
+// normalizeAddress formats an address without leading zeros, in lower case
+func normalizeAddress(address string) string {
+	address = strings.TrimLeft(strings.TrimPrefix(strings.ToLower(address), "0x"), "0")
+	if address == "" {
+		return "0x0"
+	}
+	return "0x" + address
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+)
+
+// ContractCall is a starknet_call of a contract function, Result & Err are set once called
+type ContractCall struct {
+	ContractAddress string
+	// Function selector, see utils.GetSelectorFromNameFelt
+	EntryPointSelector string
+	Calldata           []string
+
+	Result []string
+	Err    error
+}
+
+// BlockId returns the block_id param of a block number, or the latest block if nil
+func BlockId(blockNumber *uint) interface{} {
+	if blockNumber == nil {
+		return "latest"
+	}
+	return map[string]interface{}{
+		"block_number": *blockNumber,
+	}
+}
+
+// CallContracts runs calls with starknet_call at blockId, in a single batch when
+// there are several. Returns an error if the request failed, errors of each call
+// are set on its Err.
+func CallContracts(ctx context.Context, calls []*ContractCall, blockId interface{}) error {
+	return Default().CallContracts(ctx, calls, blockId)
+}
+
+func (p *RpcProvider) CallContracts(ctx context.Context, calls []*ContractCall, blockId interface{}) error {
+	batch := make([]*RpcBatchCall, len(calls))
+	for i, call := range calls {
+		call.Result = nil
+		if call.Calldata == nil {
+			call.Calldata = []string{}
+		}
+		batch[i] = &RpcBatchCall{
+			Method: "starknet_call",
+			Params: map[string]interface{}{
+				"request": map[string]interface{}{
+					"contract_address":     call.ContractAddress,
+					"entry_point_selector": call.EntryPointSelector,
+					"calldata":             call.Calldata,
+				},
+				"block_id": blockId,
+			},
+			Result: &call.Result,
+		}
+	}
+	if len(batch) == 1 {
+		calls[0].Err = p.Endpoints.Call(ctx, batch[0].Method, batch[0].Params, batch[0].Result)
+		return nil
+	}
+	if err := p.Endpoints.Batch(ctx, batch); err != nil {
+		return err
+	}
+	for i, call := range calls {
+		call.Err = batch[i].Err
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/config"
+)
+
+// Starknet & JSON-RPC error codes
+// See: https://github.com/starkware-libs/starknet-specs
+const (
+	RpcErrFailedToReceiveTxn        = 1
+	RpcErrContractNotFound          = 20
+	RpcErrBlockNotFound             = 24
+	RpcErrInvalidTxnIndex           = 27
+	RpcErrClassHashNotFound         = 28
+	RpcErrTxnHashNotFound           = 29
+	RpcErrPageSizeTooBig            = 31
+	RpcErrNoBlocks                  = 32
+	RpcErrInvalidContinuationToken  = 33
+	RpcErrTooManyKeysInFilter       = 34
+	RpcErrContractError             = 40
+	RpcErrTransactionExecutionError = 41
+	RpcErrUnexpectedError           = 63
+	RpcErrInvalidSubscriptionId     = 66
+	RpcErrTooManyAddressesInFilter  = 67
+	RpcErrTooManyBlocksBack         = 68
+	RpcErrParseError                = -32700
+	RpcErrInvalidRequest            = -32600
+	RpcErrMethodNotFound            = -32601
+	RpcErrInvalidParams             = -32602
+	RpcErrInternalError             = -32603
+)
+
+// RpcError is an error object returned by the node
+type RpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RpcError) Error() string {
+	if e.Data != nil {
+		return fmt.Sprintf("rpc error %d: %s ( %v )", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// IsRpcError reports whether err is an RpcError with the given code
+func IsRpcError(err error, code int) bool {
+	var rpcErr *RpcError
+	return errors.As(err, &rpcErr) && rpcErr.Code == code
+}
+
+// HttpStatusError is returned when the node responds with a non 200 status
+type HttpStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("http error %s: %s", e.Status, e.Body)
+}
+
+type rpcRequest struct {
+	ID      uint64      `json:"id"`
+	Jsonrpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID      uint64          `json:"id"`
+	Jsonrpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RpcError       `json:"error"`
+}
+
+// RpcBatchCall is a single call of a batch request
+// Result is unmarshalled into if set, Err is set if the call failed
+type RpcBatchCall struct {
+	Method string
+	Params interface{}
+	Result interface{}
+	Err    error
+}
+
+// RpcClient is a Starknet JSON-RPC client over http(s), retrying transient
+// errors ( network errors, 429 & 5xx responses ) with exponential backoff
+type RpcClient struct {
+	Url        string
+	HttpClient *http.Client
+	// Retries after the first attempt, 0 to disable
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	nextId atomic.Uint64
+}
+
+const (
+	DefaultRpcTimeout    = 30 * time.Second
+	DefaultRpcMaxRetries = 3
+	DefaultRpcMinBackoff = 250 * time.Millisecond
+	DefaultRpcMaxBackoff = 5 * time.Second
+)
+
+func NewRpcClient(url string) *RpcClient {
+	return &RpcClient{
+		Url: RpcUrl(url),
+		HttpClient: &http.Client{
+			Timeout: DefaultRpcTimeout,
+		},
+		MaxRetries: DefaultRpcMaxRetries,
+		MinBackoff: DefaultRpcMinBackoff,
+		MaxBackoff: DefaultRpcMaxBackoff,
+	}
+}
+
+// RpcUrl builds the http(s) url of a node from a host or url
+// Hosts without a scheme use https in production & http otherwise, ws(s) urls are
+// converted to their http(s) equivalent
+// Example: "localhost:5050" -> "http://localhost:5050", "wss://node/ws" -> "https://node/ws"
+func RpcUrl(host string) string {
+	switch {
+	case strings.HasPrefix(host, "http://"), strings.HasPrefix(host, "https://"):
+		return host
+	case strings.HasPrefix(host, "wss://"):
+		return "https://" + strings.TrimPrefix(host, "wss://")
+	case strings.HasPrefix(host, "ws://"):
+		return "http://" + strings.TrimPrefix(host, "ws://")
+	}
+	if config.Conf != nil && config.Conf.Api.Production {
+		return "https://" + host
+	}
+	return "http://" + host
+}
+
+// Call makes a JSON-RPC call, unmarshalling the call result into result if not nil
+func (c *RpcClient) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	request := rpcRequest{
+		ID:      c.nextId.Add(1),
+		Jsonrpc: "2.0",
+		Method:  method,
+		Params:  params,
+	}
+	var response rpcResponse
+	if err := c.PostJson(ctx, "", request, &response); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s: %w", method, response.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("%s: invalid result: %w", method, err)
+	}
+	return nil
+}
+
+// Batch sends calls as a single JSON-RPC batch request
+// Returns an error if the request failed, errors of each call are set on its Err
+func (c *RpcClient) Batch(ctx context.Context, calls []*RpcBatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	requests := make([]rpcRequest, len(calls))
+	callsById := make(map[uint64]*RpcBatchCall, len(calls))
+	for i, call := range calls {
+		requests[i] = rpcRequest{
+			ID:      c.nextId.Add(1),
+			Jsonrpc: "2.0",
+			Method:  call.Method,
+			Params:  call.Params,
+		}
+		callsById[requests[i].ID] = call
+		call.Err = nil
+	}
+	var responses []rpcResponse
+	if err := c.PostJson(ctx, "", requests, &responses); err != nil {
+		return fmt.Errorf("batch: %w", err)
+	}
+	// Responses may be in any order
+	for _, response := range responses {
+		call, ok := callsById[response.ID]
+		if !ok {
+			continue
+		}
+		delete(callsById, response.ID)
+		if response.Error != nil {
+			call.Err = fmt.Errorf("%s: %w", call.Method, response.Error)
+			continue
+		}
+		if call.Result != nil {
+			if err := json.Unmarshal(response.Result, call.Result); err != nil {
+				call.Err = fmt.Errorf("%s: invalid result: %w", call.Method, err)
+			}
+		}
+	}
+	for _, call := range callsById {
+		call.Err = fmt.Errorf("%s: no response in batch", call.Method)
+	}
+	return nil
+}
+
+// PostJson posts body to the node url + path, retrying transient errors,
+// and unmarshals the response into result if not nil
+func (c *RpcClient) PostJson(ctx context.Context, path string, body interface{}, result interface{}) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.doJson(ctx, http.MethodPost, path, jsonData, result)
+}
+
+// GetJson gets the node url + path ( ex: devnet's /predeployed_accounts ), retrying
+// transient errors, and unmarshals the response into result if not nil
+func (c *RpcClient) GetJson(ctx context.Context, path string, result interface{}) error {
+	return c.doJson(ctx, http.MethodGet, path, nil, result)
+}
+
+func (c *RpcClient) doJson(ctx context.Context, method string, path string, jsonData []byte, result interface{}) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.backoff(attempt)):
+			}
+		}
+		responseBody, err := c.send(ctx, method, c.Url+path, jsonData)
+		if err == nil {
+			if result == nil {
+				return nil
+			}
+			if err := json.Unmarshal(responseBody, result); err != nil {
+				return fmt.Errorf("invalid response: %w", err)
+			}
+			return nil
+		}
+		lastErr = err
+		if !isTransientError(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr
+}
+
+func (c *RpcClient) send(ctx context.Context, method string, url string, jsonData []byte) ([]byte, error) {
+	var body io.Reader
+	if jsonData != nil {
+		body = bytes.NewReader(jsonData)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if jsonData != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(responseBody),
+		}
+	}
+	return responseBody, nil
+}
+
+// backoff returns the exponential delay before a retry, with jitter
+func (c *RpcClient) backoff(attempt int) time.Duration {
+	delay := c.MinBackoff << (attempt - 1)
+	if delay <= 0 || delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	// +/- 20% jitter, so clients don't retry in lockstep
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	if rand.Intn(2) == 0 {
+		return delay - jitter
+	}
+	return delay + jitter
+}
+
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,318 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/config"
+)
+
+// RpcCaller makes Starknet JSON-RPC calls, implemented by a single RpcClient or
+// an RpcEndpointPool failing over between endpoints
+type RpcCaller interface {
+	Call(ctx context.Context, method string, params interface{}, result interface{}) error
+	Batch(ctx context.Context, calls []*RpcBatchCall) error
+	PostJson(ctx context.Context, path string, body interface{}, result interface{}) error
+}
+
+const (
+	// Interval between head & latency probes of each endpoint
+	RpcHealthCheckInterval = 10 * time.Second
+	// Blocks an endpoint's head can lag the best head by & still be healthy
+	RpcMaxHeadLag = 5
+	// Error rate ( 0 - 1 ) above which an endpoint is unhealthy
+	RpcMaxErrorRate = 0.5
+	// Weight of the latest sample in latency & error rate moving averages
+	rpcStatsAlpha = 0.2
+)
+
+// RpcEndpoint is an rpc node & its observed health
+type RpcEndpoint struct {
+	Url    string
+	WsUrl  string
+	Client *RpcClient
+
+	mutex         sync.Mutex
+	latency       time.Duration
+	errorRate     float64
+	requests      uint64
+	errors        uint64
+	headBlock     uint64
+	headUpdatedAt time.Time
+	lastError     string
+	lastErrorAt   time.Time
+}
+
+type RpcEndpointStatus struct {
+	Url           string    `json:"url"`
+	WsUrl         string    `json:"ws_url,omitempty"`
+	Healthy       bool      `json:"healthy"`
+	Score         float64   `json:"score"`
+	LatencyMs     float64   `json:"latency_ms"`
+	ErrorRate     float64   `json:"error_rate"`
+	Requests      uint64    `json:"requests"`
+	Errors        uint64    `json:"errors"`
+	HeadBlock     uint64    `json:"head_block"`
+	HeadLag       uint64    `json:"head_lag"`
+	HeadUpdatedAt time.Time `json:"head_updated_at"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitempty"`
+	// Endpoint currently used for the WebSocket subscriptions
+	WebSocketActive bool `json:"websocket_active"`
+}
+
+// record updates the endpoint stats with the outcome of a request
+func (e *RpcEndpoint) record(latency time.Duration, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.requests++
+	failed := 0.0
+	if err != nil {
+		failed = 1.0
+		e.errors++
+		e.lastError = err.Error()
+		e.lastErrorAt = time.Now().UTC()
+	} else if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(rpcStatsAlpha*float64(latency) + (1-rpcStatsAlpha)*float64(e.latency))
+	}
+	e.errorRate = rpcStatsAlpha*failed + (1-rpcStatsAlpha)*e.errorRate
+}
+
+func (e *RpcEndpoint) recordHead(blockNumber uint64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if blockNumber >= e.headBlock {
+		e.headBlock = blockNumber
+	}
+	e.headUpdatedAt = time.Now().UTC()
+}
+
+// status returns the endpoint health relative to the best head of the pool
+// Lower scores are better, unhealthy endpoints always score after healthy ones
+func (e *RpcEndpoint) status(bestHead uint64) RpcEndpointStatus {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	headLag := uint64(0)
+	if bestHead > e.headBlock {
+		headLag = bestHead - e.headBlock
+	}
+	headFresh := !e.headUpdatedAt.IsZero() && time.Since(e.headUpdatedAt) < 3*RpcHealthCheckInterval
+	healthy := e.errorRate < RpcMaxErrorRate && headLag <= RpcMaxHeadLag && headFresh
+	latencyMs := float64(e.latency) / float64(time.Millisecond)
+	score := latencyMs*(1+4*e.errorRate) + float64(headLag)*250
+	if !healthy {
+		score += 1e6
+	}
+	return RpcEndpointStatus{
+		Url:           e.Url,
+		WsUrl:         e.WsUrl,
+		Healthy:       healthy,
+		Score:         score,
+		LatencyMs:     latencyMs,
+		ErrorRate:     e.errorRate,
+		Requests:      e.requests,
+		Errors:        e.errors,
+		HeadBlock:     e.headBlock,
+		HeadLag:       headLag,
+		HeadUpdatedAt: e.headUpdatedAt,
+		LastError:     e.lastError,
+		LastErrorAt:   e.lastErrorAt,
+	}
+}
+
+func (e *RpcEndpoint) getHeadBlock() uint64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.headBlock
+}
+
+// RpcEndpointPool routes calls to the healthiest endpoint, failing over to the
+// next endpoints when a call fails on transport or node errors
+type RpcEndpointPool struct {
+	Endpoints []*RpcEndpoint
+
+	healthOnce sync.Once
+	stopChan   chan struct{}
+	// Called after each round of health checks
+	onHealthCheck func()
+}
+
+func NewRpcEndpointPool(endpointConfigs []config.RpcEndpointConfig) *RpcEndpointPool {
+	pool := &RpcEndpointPool{
+		Endpoints: make([]*RpcEndpoint, 0, len(endpointConfigs)),
+		stopChan:  make(chan struct{}),
+	}
+	for _, endpointConfig := range endpointConfigs {
+		client := NewRpcClient(endpointConfig.Url)
+		if len(endpointConfigs) > 1 {
+			// Fail over to the next endpoint instead of retrying the same one
+			client.MaxRetries = 0
+		}
+		pool.Endpoints = append(pool.Endpoints, &RpcEndpoint{
+			Url:    client.Url,
+			WsUrl:  endpointConfig.WsUrl,
+			Client: client,
+		})
+	}
+	return pool
+}
+
+func (p *RpcEndpointPool) bestHead() uint64 {
+	bestHead := uint64(0)
+	for _, endpoint := range p.Endpoints {
+		if head := endpoint.getHeadBlock(); head > bestHead {
+			bestHead = head
+		}
+	}
+	return bestHead
+}
+
+// Ranked returns the endpoints from healthiest to least healthy
+func (p *RpcEndpointPool) Ranked() []*RpcEndpoint {
+	bestHead := p.bestHead()
+	scores := make(map[*RpcEndpoint]float64, len(p.Endpoints))
+	for _, endpoint := range p.Endpoints {
+		scores[endpoint] = endpoint.status(bestHead).Score
+	}
+	ranked := append([]*RpcEndpoint{}, p.Endpoints...)
+	// Stable, so configured order breaks ties
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] < scores[ranked[j]]
+	})
+	return ranked
+}
+
+// RankedWs returns the endpoints with a WebSocket url from healthiest to least healthy
+func (p *RpcEndpointPool) RankedWs() []*RpcEndpoint {
+	ranked := []*RpcEndpoint{}
+	for _, endpoint := range p.Ranked() {
+		if endpoint.WsUrl != "" {
+			ranked = append(ranked, endpoint)
+		}
+	}
+	return ranked
+}
+
+// IsHealthy reports whether an endpoint of the pool is currently healthy
+func (p *RpcEndpointPool) IsHealthy(endpoint *RpcEndpoint) bool {
+	return endpoint.status(p.bestHead()).Healthy
+}
+
+func (p *RpcEndpointPool) Status() []RpcEndpointStatus {
+	bestHead := p.bestHead()
+	statuses := make([]RpcEndpointStatus, 0, len(p.Endpoints))
+	for _, endpoint := range p.Endpoints {
+		statuses = append(statuses, endpoint.status(bestHead))
+	}
+	return statuses
+}
+
+// isEndpointError reports whether err is caused by the endpoint rather than
+// the request, ie. whether the request should be tried on another endpoint
+func isEndpointError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var rpcErr *RpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == RpcErrInternalError || rpcErr.Code == RpcErrUnexpectedError
+	}
+	return true
+}
+
+func (p *RpcEndpointPool) do(ctx context.Context, request func(*RpcClient) error) error {
+	if len(p.Endpoints) == 0 {
+		return fmt.Errorf("no rpc endpoints configured")
+	}
+	var lastErr error
+	for _, endpoint := range p.Ranked() {
+		start := time.Now()
+		err := request(endpoint.Client)
+		if isEndpointError(err) {
+			endpoint.record(time.Since(start), err)
+			lastErr = err
+			if ctx.Err() != nil {
+				return err
+			}
+			continue
+		}
+		endpoint.record(time.Since(start), nil)
+		return err
+	}
+	return lastErr
+}
+
+func (p *RpcEndpointPool) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	return p.do(ctx, func(client *RpcClient) error {
+		return client.Call(ctx, method, params, result)
+	})
+}
+
+func (p *RpcEndpointPool) Batch(ctx context.Context, calls []*RpcBatchCall) error {
+	return p.do(ctx, func(client *RpcClient) error {
+		return client.Batch(ctx, calls)
+	})
+}
+
+func (p *RpcEndpointPool) PostJson(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return p.do(ctx, func(client *RpcClient) error {
+		return client.PostJson(ctx, path, body, result)
+	})
+}
+
+// CheckHealth probes the head & latency of every endpoint
+func (p *RpcEndpointPool) CheckHealth() {
+	var wg sync.WaitGroup
+	for _, endpoint := range p.Endpoints {
+		wg.Add(1)
+		go func(endpoint *RpcEndpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), RpcHealthCheckInterval)
+			defer cancel()
+			var blockNumber uint64
+			start := time.Now()
+			err := endpoint.Client.Call(ctx, "starknet_blockNumber", []interface{}{}, &blockNumber)
+			endpoint.record(time.Since(start), err)
+			if err == nil {
+				endpoint.recordHead(blockNumber)
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+	if p.onHealthCheck != nil {
+		p.onHealthCheck()
+	}
+}
+
+// StartHealthChecks probes the endpoints now & every RpcHealthCheckInterval until Stop
+func (p *RpcEndpointPool) StartHealthChecks() {
+	p.healthOnce.Do(func() {
+		p.CheckHealth()
+		go func() {
+			ticker := time.NewTicker(RpcHealthCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					p.CheckHealth()
+				case <-p.stopChan:
+					return
+				}
+			}
+		}()
+	})
+}
+
+func (p *RpcEndpointPool) Stop() {
+	select {
+	case <-p.stopChan:
+	default:
+		close(p.stopChan)
+	}
+}
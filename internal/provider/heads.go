@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Blocks kept in the chain head window
+const HeadWindowSize = 256
+
+// Headers fetched for blocks outside of the window kept by the head tracker, so
+// backfilled events don't fetch the header of their block once per event
+const FetchedHeadersSize = 1024
+
+// BlockHeader is the part of a block header tracked by the engine
+type BlockHeader struct {
+	BlockHash   string `json:"block_hash"`
+	ParentHash  string `json:"parent_hash"`
+	BlockNumber uint   `json:"block_number"`
+	Timestamp   uint64 `json:"timestamp"`
+	// Only set on headers fetched from the rpc
+	Status string `json:"status,omitempty"`
+}
+
+// HeadTracker keeps a rolling window of the latest block headers received from
+// starknet_subscribeNewHeads ( or polled ), used to timestamp events & measure indexer lag
+type HeadTracker struct {
+	mutex sync.Mutex
+	size  int
+	// Map: BlockNumber -> BlockHeader
+	headers    map[uint]BlockHeader
+	head       *BlockHeader
+	receivedAt time.Time
+	// Map: BlockNumber -> element of fetchedOrder, headers fetched from the rpc for
+	// blocks outside of the window
+	fetched map[uint]*list.Element
+	// Fetched headers, most recently used first
+	fetchedOrder *list.List
+}
+
+func NewHeadTracker(size int) *HeadTracker {
+	return &HeadTracker{
+		size:         size,
+		headers:      make(map[uint]BlockHeader),
+		fetched:      make(map[uint]*list.Element),
+		fetchedOrder: list.New(),
+	}
+}
+
+// Add records a new head, evicting the oldest blocks past the window size
+func (t *HeadTracker) Add(header BlockHeader) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.headers[header.BlockNumber] = header
+	if t.head == nil || header.BlockNumber >= t.head.BlockNumber {
+		t.head = &header
+		t.receivedAt = time.Now().UTC()
+	}
+	for len(t.headers) > t.size {
+		oldest := header.BlockNumber
+		for blockNumber := range t.headers {
+			if blockNumber < oldest {
+				oldest = blockNumber
+			}
+		}
+		delete(t.headers, oldest)
+	}
+}
+
+// Rollback removes the headers from blockNumber onwards, after a reorg
+func (t *HeadTracker) Rollback(blockNumber uint) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for number := range t.headers {
+		if number >= blockNumber {
+			delete(t.headers, number)
+		}
+	}
+	for number, element := range t.fetched {
+		if number >= blockNumber {
+			t.fetchedOrder.Remove(element)
+			delete(t.fetched, number)
+		}
+	}
+	t.head = nil
+	for _, header := range t.headers {
+		if t.head == nil || header.BlockNumber > t.head.BlockNumber {
+			header := header
+			t.head = &header
+		}
+	}
+}
+
+// Head returns the latest header & when it was received, ok false if no heads were received yet
+func (t *HeadTracker) Head() (BlockHeader, time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.head == nil {
+		return BlockHeader{}, time.Time{}, false
+	}
+	return *t.head, t.receivedAt, true
+}
+
+// Get returns the header of a block in the window
+func (t *HeadTracker) Get(blockNumber uint) (BlockHeader, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	header, ok := t.headers[blockNumber]
+	return header, ok
+}
+
+// Window returns the headers in the window, from oldest to newest
+func (t *HeadTracker) Window() []BlockHeader {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	headers := make([]BlockHeader, 0, len(t.headers))
+	for _, header := range t.headers {
+		headers = append(headers, header)
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].BlockNumber < headers[j].BlockNumber
+	})
+	return headers
+}
+
+// GetBlockHeader returns the header of a block from the window, or from the provider
+// for blocks outside of it ( ex: events replayed from Indexer.StartAt ), keeping the
+// last FetchedHeadersSize fetched headers
+func (t *HeadTracker) GetBlockHeader(ctx context.Context, p Provider, blockNumber uint) (BlockHeader, error) {
+	if header, ok := t.Get(blockNumber); ok {
+		return header, nil
+	}
+	t.mutex.Lock()
+	if element, ok := t.fetched[blockNumber]; ok {
+		t.fetchedOrder.MoveToFront(element)
+		header := element.Value.(BlockHeader)
+		t.mutex.Unlock()
+		return header, nil
+	}
+	t.mutex.Unlock()
+
+	header, err := p.BlockHeader(ctx, blockNumber)
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.fetched[blockNumber]; !ok {
+		t.fetched[blockNumber] = t.fetchedOrder.PushFront(header)
+		if t.fetchedOrder.Len() > FetchedHeadersSize {
+			oldest := t.fetchedOrder.Back()
+			t.fetchedOrder.Remove(oldest)
+			delete(t.fetched, oldest.Value.(BlockHeader).BlockNumber)
+		}
+	}
+	return header, nil
+}
+
+// GetStarknetBlockHeader fetches the header of a block from the rpc
+func GetStarknetBlockHeader(blockNumber uint) (BlockHeader, error) {
+	return Default().BlockHeader(context.Background(), blockNumber)
+}
+
+// BlockHeader fetches the header of an accepted block
+func (p *RpcProvider) BlockHeader(ctx context.Context, blockNumber uint) (BlockHeader, error) {
+	var header BlockHeader
+	params := []interface{}{
+		map[string]interface{}{
+			"block_number": blockNumber,
+		},
+	}
+	err := p.Endpoints.Call(ctx, "starknet_getBlockWithTxHashes", params, &header)
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	if header.BlockHash == "" {
+		// Pending blocks have no hash or number yet
+		return BlockHeader{}, fmt.Errorf("block %d not accepted yet", blockNumber)
+	}
+	return header, nil
+}
+
+type newHeadsNotification struct {
+	Params struct {
+		Result BlockHeader `json:"result"`
+	} `json:"params"`
+}
+
+func (p *RpcProvider) processNewHead(message []byte) {
+	var notification newHeadsNotification
+	if err := json.Unmarshal(message, &notification); err != nil {
+		fmt.Println("Error unmarshalling new head:", err)
+		return
+	}
+	header := notification.Params.Result
+	if reorg, ok := p.detectReorg(header); ok {
+		p.handleReorg(reorg)
+	}
+	p.Heads.Add(header)
+	p.wsMutex.Lock()
+	endpoint := p.WebSocketEndpoint
+	p.wsMutex.Unlock()
+	if endpoint != nil {
+		endpoint.recordHead(uint64(notification.Params.Result.BlockNumber))
+	}
+}
@@ -0,0 +1,50 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/b-j-roberts/foc-engine/internal/fakenode"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+func TestHeadTrackerCachesFetchedHeaders(t *testing.T) {
+	node := fakenode.New()
+	defer node.Close()
+	node.AddBlocks(4)
+	p := node.Provider()
+	heads := provider.NewHeadTracker(2)
+	heads.Add(provider.BlockHeader{BlockNumber: 4, BlockHash: node.Head().Hash})
+
+	for _, blockNumber := range []uint{1, 2} {
+		header, err := heads.GetBlockHeader(context.Background(), p, blockNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := node.Block(uint64(blockNumber))
+		if header.BlockHash != block.Hash {
+			t.Errorf("block %d hash = %s, want %s", blockNumber, header.BlockHash, block.Hash)
+		}
+	}
+
+	// Fetched headers are served without calling the node
+	node.FailNext("starknet_getBlockWithTxHashes", &provider.RpcError{Code: provider.RpcErrBlockNotFound, Message: "Block not found"})
+	for _, blockNumber := range []uint{1, 2, 1} {
+		if _, err := heads.GetBlockHeader(context.Background(), p, blockNumber); err != nil {
+			t.Errorf("block %d header not cached: %v", blockNumber, err)
+		}
+	}
+	if _, err := heads.GetBlockHeader(context.Background(), p, 3); !provider.IsRpcError(err, provider.RpcErrBlockNotFound) {
+		t.Errorf("block 3 header error = %v, want the injected failure", err)
+	}
+
+	// Reverted blocks are fetched again
+	heads.Rollback(2)
+	node.FailNext("starknet_getBlockWithTxHashes", &provider.RpcError{Code: provider.RpcErrBlockNotFound, Message: "Block not found"})
+	if _, err := heads.GetBlockHeader(context.Background(), p, 2); !provider.IsRpcError(err, provider.RpcErrBlockNotFound) {
+		t.Errorf("reverted block header error = %v, want the injected failure", err)
+	}
+	if _, err := heads.GetBlockHeader(context.Background(), p, 1); err != nil {
+		t.Errorf("block 1 header not cached after rollback: %v", err)
+	}
+}
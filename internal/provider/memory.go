@@ -0,0 +1,515 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/starknet.go/utils"
+)
+
+// MemoryEvent is an event emitted in a MemoryProvider block
+type MemoryEvent struct {
+	FromAddress string
+	Keys        []string
+	Data        []string
+	// Generated if empty, events with the same hash share a transaction
+	TransactionHash string
+	// Account of the transaction, MemoryDefaultSender if empty
+	Sender string
+}
+
+// Sender of transactions with no sender set
+const MemoryDefaultSender = "0x5e4de7"
+
+// MemoryCallHandler returns the result of a contract function for its calldata
+type MemoryCallHandler func(calldata []string) ([]string, error)
+
+type memoryEvent struct {
+	MemoryEvent
+	blockNumber uint
+	// Index of the event in its transaction's receipt
+	eventIndex uint
+}
+
+// MemoryProvider is an in-memory Provider, scripted with AddBlock, SetClass & SetCall
+// ( ex: to run a registry without a node ). Once StartIndexer is called, subscribed events
+// are passed to ProcessStarknetEventData as starknet_subscriptionEvents messages.
+type MemoryProvider struct {
+	indexing bool
+	options  IndexerOptions
+	mutex    sync.Mutex
+	// Notifications waiting for delivery, delivered in order by a single caller without
+	// holding mutex, so events can be processed while subscribing ( ex: registrations )
+	deliverMutex sync.Mutex
+	delivering   bool
+	pending      [][]byte
+	headers      []BlockHeader
+	events       []memoryEvent
+	// Map: Transaction hash -> transaction & receipt
+	transactions map[string]*Transaction
+	receipts     map[string]*TransactionReceipt
+	// Map: Normalized address -> class hash
+	contracts map[string]string
+	classes   map[string]*ContractClass
+	// Map: Normalized address:selector -> handler
+	calls             map[string]MemoryCallHandler
+	subscriptionTable map[string]*EventSubscription
+	nextSubscription  int
+	nextTransaction   int
+}
+
+var _ Provider = (*MemoryProvider)(nil)
+
+// NewMemoryProvider creates a provider with a genesis block
+func NewMemoryProvider() *MemoryProvider {
+	p := &MemoryProvider{
+		transactions:      make(map[string]*Transaction),
+		receipts:          make(map[string]*TransactionReceipt),
+		contracts:         make(map[string]string),
+		classes:           make(map[string]*ContractClass),
+		calls:             make(map[string]MemoryCallHandler),
+		subscriptionTable: make(map[string]*EventSubscription),
+	}
+	p.AddBlock()
+	return p
+}
+
+// StartIndexer enables the subscriptions, delivering their events to options.ProcessStarknetEventData.
+// Subscriptions replay the events from their start block, like an RpcProvider's backfill.
+func (p *MemoryProvider) StartIndexer(options IndexerOptions) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.indexing {
+		return fmt.Errorf("provider already indexing")
+	}
+	p.indexing = true
+	p.options = options
+	return nil
+}
+
+// Indexing reports whether StartIndexer was called
+func (p *MemoryProvider) Indexing() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.indexing
+}
+
+// ChainHeads returns nil, every header is available from BlockHeader
+func (p *MemoryProvider) ChainHeads() *HeadTracker {
+	return nil
+}
+
+// RpcEndpoints returns nil, the provider has no rpc
+func (p *MemoryProvider) RpcEndpoints() *RpcEndpointPool {
+	return nil
+}
+
+// GetWebSocketStatus returns the subscribed contracts, the provider has no WebSocket
+func (p *MemoryProvider) GetWebSocketStatus() WebSocketStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	status := WebSocketStatus{
+		State:         WebSocketDisconnected,
+		Subscriptions: []string{},
+		Mode:          "memory",
+	}
+	for _, entry := range p.subscriptionTable {
+		if entry.Status != SubscriptionPaused {
+			status.Subscriptions = append(status.Subscriptions, entry.Address)
+		}
+	}
+	sort.Strings(status.Subscriptions)
+	return status
+}
+
+// AddBlock adds a block emitting events, delivered to the subscribed contracts
+func (p *MemoryProvider) AddBlock(events ...MemoryEvent) BlockHeader {
+	p.mutex.Lock()
+	number := uint(len(p.headers))
+	header := BlockHeader{
+		BlockHash:   fmt.Sprintf("0xb10c%x", number),
+		BlockNumber: number,
+		Timestamp:   uint64(time.Now().Unix()),
+		Status:      "ACCEPTED_ON_L2",
+	}
+	if number > 0 {
+		header.ParentHash = p.headers[number-1].BlockHash
+	} else {
+		header.ParentHash = "0x0"
+	}
+	p.headers = append(p.headers, header)
+
+	first := len(p.events)
+	for _, event := range events {
+		if event.TransactionHash == "" {
+			p.nextTransaction++
+			event.TransactionHash = fmt.Sprintf("0x7a%x", p.nextTransaction)
+		}
+		if event.Sender == "" {
+			event.Sender = MemoryDefaultSender
+		}
+		eventIndex := p.addTransaction(header, event)
+		p.events = append(p.events, memoryEvent{MemoryEvent: event, blockNumber: number, eventIndex: eventIndex})
+	}
+	messages := [][]byte{}
+	for _, event := range p.events[first:] {
+		if entry, ok := p.subscriptionTable[normalizeAddress(event.FromAddress)]; ok && entry.Status == SubscriptionActive {
+			messages = append(messages, p.subscriptionMessage(entry, event))
+		}
+	}
+	p.mutex.Unlock()
+
+	p.deliver(messages)
+	return header
+}
+
+// addTransaction adds an event to its transaction's receipt & returns its index there,
+// called with mutex held
+func (p *MemoryProvider) addTransaction(header BlockHeader, event MemoryEvent) uint {
+	receipt, ok := p.receipts[event.TransactionHash]
+	if !ok {
+		blockNumber := header.BlockNumber
+		p.transactions[event.TransactionHash] = &Transaction{
+			TransactionHash: event.TransactionHash,
+			Type:            "INVOKE",
+			Version:         "0x3",
+			SenderAddress:   event.Sender,
+		}
+		receipt = &TransactionReceipt{
+			TransactionHash: event.TransactionHash,
+			Type:            "INVOKE",
+			ExecutionStatus: "SUCCEEDED",
+			FinalityStatus:  "ACCEPTED_ON_L2",
+			ActualFee:       FeePayment{Amount: "0x1", Unit: "FRI"},
+			BlockHash:       header.BlockHash,
+			BlockNumber:     &blockNumber,
+			Events:          []ReceiptEvent{},
+		}
+		p.receipts[event.TransactionHash] = receipt
+	}
+	receipt.Events = append(receipt.Events, ReceiptEvent{
+		FromAddress: event.FromAddress,
+		Keys:        nonNilFelts(event.Keys),
+		Data:        nonNilFelts(event.Data),
+	})
+	return uint(len(receipt.Events) - 1)
+}
+
+func nonNilFelts(felts []string) []string {
+	if felts == nil {
+		return []string{}
+	}
+	return felts
+}
+
+// emittedEvent returns an event as returned by starknet_getEvents, with its event_index
+// since the provider knows it. Called with mutex held.
+func (p *MemoryProvider) emittedEvent(event memoryEvent) json.RawMessage {
+	emitted, _ := json.Marshal(map[string]interface{}{
+		"from_address":     event.FromAddress,
+		"keys":             nonNilFelts(event.Keys),
+		"data":             nonNilFelts(event.Data),
+		"block_hash":       p.headers[event.blockNumber].BlockHash,
+		"block_number":     event.blockNumber,
+		"transaction_hash": event.TransactionHash,
+		"event_index":      event.eventIndex,
+	})
+	return emitted
+}
+
+// subscriptionMessage counts an event on its subscription & returns its notification,
+// called with mutex held
+func (p *MemoryProvider) subscriptionMessage(entry *EventSubscription, event memoryEvent) []byte {
+	entry.Events++
+	blockNumber := event.blockNumber
+	entry.LastEventBlock = &blockNumber
+	message, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "starknet_subscriptionEvents",
+		"params": map[string]interface{}{
+			"subscription_id": entry.SubscriptionId,
+			"result":          p.emittedEvent(event),
+		},
+	})
+	return message
+}
+
+// deliver queues the notifications & delivers the queue, unless a caller is already
+// delivering it ( ex: processing an event which subscribes to a contract )
+func (p *MemoryProvider) deliver(messages [][]byte) {
+	p.mutex.Lock()
+	process := p.options.ProcessStarknetEventData
+	p.mutex.Unlock()
+	if process == nil {
+		return
+	}
+	p.deliverMutex.Lock()
+	p.pending = append(p.pending, messages...)
+	if p.delivering {
+		p.deliverMutex.Unlock()
+		return
+	}
+	p.delivering = true
+	for len(p.pending) > 0 {
+		message := p.pending[0]
+		p.pending = p.pending[1:]
+		p.deliverMutex.Unlock()
+		process(message)
+		p.deliverMutex.Lock()
+	}
+	p.delivering = false
+	p.deliverMutex.Unlock()
+}
+
+// SetClass declares a class
+func (p *MemoryProvider) SetClass(classHash string, class *ContractClass) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.classes[normalizeAddress(classHash)] = class
+}
+
+// DeployContract deploys a contract of a declared class at address
+func (p *MemoryProvider) DeployContract(address string, classHash string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.contracts[normalizeAddress(address)] = normalizeAddress(classHash)
+}
+
+// SetCall sets the handler of a contract function's calls
+func (p *MemoryProvider) SetCall(address string, function string, handler MemoryCallHandler) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	selector := utils.GetSelectorFromNameFelt(function).String()
+	p.calls[normalizeAddress(address)+":"+normalizeAddress(selector)] = handler
+}
+
+func (p *MemoryProvider) BlockNumber(ctx context.Context) (uint64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return uint64(len(p.headers) - 1), nil
+}
+
+func (p *MemoryProvider) BlockHeader(ctx context.Context, blockNumber uint) (BlockHeader, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if blockNumber >= uint(len(p.headers)) {
+		return BlockHeader{}, &RpcError{Code: RpcErrBlockNotFound, Message: "Block not found"}
+	}
+	return p.headers[blockNumber], nil
+}
+
+func (p *MemoryProvider) ClassHashAt(ctx context.Context, address string) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	classHash, ok := p.contracts[normalizeAddress(address)]
+	if !ok {
+		return "", &RpcError{Code: RpcErrContractNotFound, Message: "Contract not found"}
+	}
+	return classHash, nil
+}
+
+func (p *MemoryProvider) Class(ctx context.Context, classHash string) (*ContractClass, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	class, ok := p.classes[normalizeAddress(classHash)]
+	if !ok {
+		return nil, &RpcError{Code: RpcErrClassHashNotFound, Message: "Class hash not found"}
+	}
+	return class, nil
+}
+
+func (p *MemoryProvider) ClassAt(ctx context.Context, address string) (*ContractClass, error) {
+	classHash, err := p.ClassHashAt(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return p.Class(ctx, classHash)
+}
+
+// Events returns pages of BackfillChunkSize events, continuation tokens are offsets
+func (p *MemoryProvider) Events(ctx context.Context, address string, fromBlock uint, toBlock uint, continuationToken string) (*EventsPage, error) {
+	offset := 0
+	if continuationToken != "" {
+		var err error
+		offset, err = strconv.Atoi(continuationToken)
+		if err != nil || offset < 0 {
+			return nil, &RpcError{Code: RpcErrInvalidContinuationToken, Message: "Invalid continuation token"}
+		}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	page := &EventsPage{Events: []json.RawMessage{}}
+	matched := 0
+	for _, event := range p.events {
+		if event.blockNumber < fromBlock || event.blockNumber > toBlock {
+			continue
+		}
+		if address != "" && normalizeAddress(event.FromAddress) != normalizeAddress(address) {
+			continue
+		}
+		matched++
+		if matched <= offset {
+			continue
+		}
+		if len(page.Events) == BackfillChunkSize {
+			page.ContinuationToken = strconv.Itoa(offset + BackfillChunkSize)
+			break
+		}
+		page.Events = append(page.Events, p.emittedEvent(event))
+	}
+	return page, nil
+}
+
+// CallContracts runs the calls with their SetCall handlers, on the latest state
+func (p *MemoryProvider) CallContracts(ctx context.Context, calls []*ContractCall, blockId interface{}) error {
+	for _, call := range calls {
+		p.mutex.Lock()
+		_, deployed := p.contracts[normalizeAddress(call.ContractAddress)]
+		handler, ok := p.calls[normalizeAddress(call.ContractAddress)+":"+normalizeAddress(call.EntryPointSelector)]
+		p.mutex.Unlock()
+		call.Result = nil
+		call.Err = nil
+		switch {
+		case ok:
+			call.Result, call.Err = handler(call.Calldata)
+		case !deployed:
+			call.Err = &RpcError{Code: RpcErrContractNotFound, Message: "Contract not found"}
+		default:
+			call.Err = &RpcError{Code: RpcErrContractError, Message: "Contract error", Data: "Entry point not found"}
+		}
+	}
+	return nil
+}
+
+func (p *MemoryProvider) TransactionWithReceipt(ctx context.Context, transactionHash string) (*Transaction, *TransactionReceipt, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	transaction, ok := p.transactions[transactionHash]
+	if !ok {
+		return nil, nil, &RpcError{Code: RpcErrTxnHashNotFound, Message: "Transaction hash not found"}
+	}
+	transactionCopy := *transaction
+	receiptCopy := *p.receipts[transactionHash]
+	receiptCopy.Events = append([]ReceiptEvent{}, receiptCopy.Events...)
+	return &transactionCopy, &receiptCopy, nil
+}
+
+// subscribe replays a contract's events from fromBlock & activates its subscription,
+// returning the replayed notifications. Called with mutex held.
+func (p *MemoryProvider) subscribe(entry *EventSubscription, fromBlock uint) [][]byte {
+	p.nextSubscription++
+	entry.SubscriptionId = SubscriptionId(strconv.Itoa(p.nextSubscription))
+	entry.Status = SubscriptionActive
+	entry.FromBlock = fromBlock
+	entry.SubscribedAt = time.Now().UTC()
+	entry.ResumeBlock = 0
+	messages := [][]byte{}
+	for _, event := range p.events {
+		if event.blockNumber >= fromBlock && normalizeAddress(event.FromAddress) == normalizeAddress(entry.Address) {
+			messages = append(messages, p.subscriptionMessage(entry, event))
+		}
+	}
+	return messages
+}
+
+// SubscribeEvents replays a contract's events from its start block ( its resume block, or
+// Config.StartAt ), then delivers its new events
+func (p *MemoryProvider) SubscribeEvents(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
+	}
+	fromBlock := uint(0)
+	if startAt := p.options.Config.StartAt; startAt != nil && *startAt > 0 {
+		fromBlock = uint(*startAt)
+	}
+	if p.options.ContractResumeBlock != nil {
+		if blockNumber, ok := p.options.ContractResumeBlock(address); ok && blockNumber > fromBlock {
+			fromBlock = blockNumber
+		}
+	}
+	p.mutex.Lock()
+	if _, ok := p.subscriptionTable[normalizeAddress(address)]; ok {
+		p.mutex.Unlock()
+		return nil
+	}
+	entry := &EventSubscription{Address: address}
+	p.subscriptionTable[normalizeAddress(address)] = entry
+	messages := p.subscribe(entry, fromBlock)
+	p.mutex.Unlock()
+
+	p.deliver(messages)
+	return nil
+}
+
+func (p *MemoryProvider) PauseSubscription(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entry, ok := p.subscriptionTable[normalizeAddress(address)]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, address)
+	}
+	if entry.Status == SubscriptionPaused {
+		return nil
+	}
+	entry.Status = SubscriptionPaused
+	entry.SubscriptionId = ""
+	entry.PausedAt = time.Now().UTC()
+	entry.ResumeBlock = uint(len(p.headers))
+	return nil
+}
+
+// ResumeSubscription replays the events missed while paused, then delivers new events
+func (p *MemoryProvider) ResumeSubscription(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
+	}
+	p.mutex.Lock()
+	entry, ok := p.subscriptionTable[normalizeAddress(address)]
+	if !ok {
+		p.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, address)
+	}
+	if entry.Status != SubscriptionPaused {
+		p.mutex.Unlock()
+		return nil
+	}
+	messages := p.subscribe(entry, entry.ResumeBlock)
+	p.mutex.Unlock()
+
+	p.deliver(messages)
+	return nil
+}
+
+func (p *MemoryProvider) RemoveSubscription(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.subscriptionTable[normalizeAddress(address)]; !ok {
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, address)
+	}
+	delete(p.subscriptionTable, normalizeAddress(address))
+	return nil
+}
+
+func (p *MemoryProvider) GetSubscriptions() []EventSubscription {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	subscriptions := make([]EventSubscription, 0, len(p.subscriptionTable))
+	for _, entry := range p.subscriptionTable {
+		subscriptions = append(subscriptions, *entry)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Address < subscriptions[j].Address
+	})
+	return subscriptions
+}
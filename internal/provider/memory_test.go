@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/b-j-roberts/foc-engine/internal/config"
+)
+
+// memoryNotifications collects the events delivered by a MemoryProvider
+type memoryNotifications struct {
+	mutex  sync.Mutex
+	events []map[string]interface{}
+}
+
+func (n *memoryNotifications) process(message []byte) {
+	var notification struct {
+		Params struct {
+			Result map[string]interface{} `json:"result"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(message, &notification); err != nil {
+		panic(err)
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.events = append(n.events, notification.Params.Result)
+}
+
+func (n *memoryNotifications) blocks() []float64 {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	blocks := []float64{}
+	for _, event := range n.events {
+		blocks = append(blocks, event["block_number"].(float64))
+	}
+	return blocks
+}
+
+func TestMemoryProviderSubscriptions(t *testing.T) {
+	p := NewMemoryProvider()
+	p.AddBlock(MemoryEvent{FromAddress: "0xabc", Keys: []string{"0x1"}})
+	p.AddBlock(MemoryEvent{FromAddress: "0xdef", Keys: []string{"0x1"}})
+	if err := p.SubscribeEvents("0xabc"); !errors.Is(err, ErrNotIndexing) {
+		t.Fatalf("subscribe before StartIndexer error = %v, want %v", err, ErrNotIndexing)
+	}
+
+	notifications := &memoryNotifications{}
+	startAt := 1
+	err := p.StartIndexer(IndexerOptions{
+		Config:                   config.IndexerConfig{StartAt: &startAt},
+		ProcessStarknetEventData: notifications.process,
+		ContractResumeBlock: func(address string) (uint, bool) {
+			return 0, false
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replays the contract's events from StartAt
+	if err := p.SubscribeEvents("0x0abc"); err != nil {
+		t.Fatal(err)
+	}
+	p.AddBlock(MemoryEvent{FromAddress: "0xabc", Keys: []string{"0x2"}})
+	if blocks := notifications.blocks(); len(blocks) != 2 || blocks[0] != 1 || blocks[1] != 3 {
+		t.Fatalf("delivered blocks = %v, want [1 3]", blocks)
+	}
+
+	// Events emitted while paused are replayed on resume
+	if err := p.PauseSubscription("0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	p.AddBlock(MemoryEvent{FromAddress: "0xabc"})
+	if err := p.ResumeSubscription("0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := notifications.blocks(); len(blocks) != 3 || blocks[2] != 4 {
+		t.Errorf("delivered blocks = %v, want [1 3 4]", blocks)
+	}
+	if status := p.GetWebSocketStatus(); len(status.Subscriptions) != 1 {
+		t.Errorf("status subscriptions = %v, want 0xabc", status.Subscriptions)
+	}
+
+	if err := p.RemoveSubscription("0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveSubscription("0xabc"); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("remove twice error = %v, want %v", err, ErrSubscriptionNotFound)
+	}
+}
+
+func TestMemoryProviderEvents(t *testing.T) {
+	p := NewMemoryProvider()
+	events := make([]MemoryEvent, BackfillChunkSize+1)
+	for i := range events {
+		events[i] = MemoryEvent{FromAddress: "0xabc", TransactionHash: "0x7e"}
+	}
+	p.AddBlock(events...)
+	p.DeployContract("0xabc", "0xc1")
+	p.SetClass("0xc1", &ContractClass{Abi: []interface{}{}})
+
+	page, err := p.Events(context.Background(), "0xabc", 0, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Events) != BackfillChunkSize || page.ContinuationToken == "" {
+		t.Fatalf("first page = %d events, token %q", len(page.Events), page.ContinuationToken)
+	}
+	page, err = p.Events(context.Background(), "0xabc", 0, 1, page.ContinuationToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Events) != 1 || page.ContinuationToken != "" {
+		t.Fatalf("last page = %d events, token %q", len(page.Events), page.ContinuationToken)
+	}
+	// Events carry their index in the transaction's receipt
+	var last struct {
+		EventIndex uint `json:"event_index"`
+	}
+	if err := json.Unmarshal(page.Events[0], &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.EventIndex != BackfillChunkSize {
+		t.Errorf("last event index = %d, want %d", last.EventIndex, BackfillChunkSize)
+	}
+	_, receipt, err := p.TransactionWithReceipt(context.Background(), "0x7e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipt.Events) != BackfillChunkSize+1 {
+		t.Errorf("receipt has %d events, want %d", len(receipt.Events), BackfillChunkSize+1)
+	}
+
+	if _, err := p.ClassAt(context.Background(), "0x0abc"); err != nil {
+		t.Errorf("class of deployed contract: %v", err)
+	}
+	if _, err := p.ClassAt(context.Background(), "0xdef"); !IsRpcError(err, RpcErrContractNotFound) {
+		t.Errorf("class of undeployed contract error = %v", err)
+	}
+}
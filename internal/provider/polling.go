@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Indexer modes ( config Indexer.Mode )
+const (
+	// WebSocket subscriptions, falling back to polling if the WebSocket is unavailable
+	IndexerModeAuto      = "auto"
+	IndexerModeWebSocket = "websocket"
+	// starknet_getEvents polling, for rpcs without WebSocket support
+	IndexerModePolling = "polling"
+)
+
+const (
+	DefaultPollInterval = 5 * time.Second
+	// Failed reconnects before the auto mode falls back to polling
+	wsReconnectAttemptsBeforePolling = 5
+)
+
+func (p *RpcProvider) indexerMode() string {
+	mode := strings.ToLower(p.options.Config.Mode)
+	switch mode {
+	case IndexerModeWebSocket, IndexerModePolling:
+		return mode
+	case "", IndexerModeAuto:
+		return IndexerModeAuto
+	}
+	fmt.Println("Unknown indexer mode:", p.options.Config.Mode, "using", IndexerModeAuto)
+	return IndexerModeAuto
+}
+
+func (p *RpcProvider) pollInterval() time.Duration {
+	if p.options.Config.PollInterval > 0 {
+		return time.Duration(p.options.Config.PollInterval) * time.Second
+	}
+	return DefaultPollInterval
+}
+
+// IsPolling reports whether the provider polls for events instead of using the WebSocket
+func (p *RpcProvider) IsPolling() bool {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	return p.polling
+}
+
+// startPolling switches the provider to polling, the current subscriptions
+// are polled from their cursor
+func (p *RpcProvider) startPolling() {
+	p.wsMutex.Lock()
+	if p.polling || p.closing {
+		p.wsMutex.Unlock()
+		return
+	}
+	p.polling = true
+	p.wsState = WebSocketPolling
+	p.workers.Add(1)
+	// Pending backfills are covered by the poll cursors
+	p.backfillJobs = nil
+	p.wsGeneration++
+	for _, address := range p.Subscriptions {
+		p.pollCursors[address] = p.subscriptionCursor(address)
+		if entry, ok := p.subscriptionTable[normalizeAddress(address)]; ok {
+			entry.Status = SubscriptionActive
+			entry.SubscriptionId = ""
+		}
+	}
+	p.wsMutex.Unlock()
+
+	fmt.Println("Polling events every", p.pollInterval())
+	go p.pollEvents()
+}
+
+func (p *RpcProvider) pollEvents() {
+	defer p.workers.Done()
+	ticker := time.NewTicker(p.pollInterval())
+	defer ticker.Stop()
+	for {
+		p.pollEventsOnce()
+		select {
+		case <-ticker.C:
+		case <-p.closeChan:
+			return
+		}
+	}
+}
+
+// pollEventsOnce records the headers of the new blocks, checking each for a reorg, then
+// processes the events of every subscribed contract from its poll cursor up to the head
+func (p *RpcProvider) pollEventsOnce() {
+	head, err := p.BlockNumber(context.Background())
+	if err != nil {
+		fmt.Println("Error polling block number:", err)
+		return
+	}
+	p.pollBlockHeaders(uint(head))
+
+	p.wsMutex.Lock()
+	cursors := make(map[string]uint, len(p.pollCursors))
+	for address, cursor := range p.pollCursors {
+		cursors[address] = cursor
+	}
+	p.wsMutex.Unlock()
+
+	for address, cursor := range cursors {
+		if uint64(cursor) > head {
+			continue
+		}
+		if err := p.pollContractEvents(address, cursor, uint(head)); err != nil {
+			// Retried from the same cursor on the next poll
+			fmt.Println("Error polling events for contract:", address, err)
+			continue
+		}
+		p.wsMutex.Lock()
+		// Paused or removed while polling
+		if _, ok := p.pollCursors[address]; ok {
+			p.pollCursors[address] = uint(head) + 1
+		}
+		p.wsMutex.Unlock()
+	}
+}
+
+// pollBlockHeaders adds the headers from the last tracked head to head to the chain heads,
+// so every block's parent hash is checked like new heads of the WebSocket
+func (p *RpcProvider) pollBlockHeaders(head uint) {
+	fromBlock := head
+	if tracked, _, ok := p.Heads.Head(); ok && tracked.BlockNumber < head {
+		fromBlock = tracked.BlockNumber + 1
+	}
+	// Older blocks are out of the window
+	if head-fromBlock >= HeadWindowSize {
+		fromBlock = head - HeadWindowSize + 1
+	}
+	for blockNumber := fromBlock; blockNumber <= head; blockNumber++ {
+		header, err := p.BlockHeader(context.Background(), blockNumber)
+		if err != nil {
+			// Retried on the next poll
+			fmt.Println("Error polling block header:", blockNumber, err)
+			return
+		}
+		if reorg, ok := p.detectReorg(header); ok {
+			p.handleReorg(reorg)
+		}
+		p.Heads.Add(header)
+	}
+}
+
+func (p *RpcProvider) pollContractEvents(address string, fromBlock uint, toBlock uint) error {
+	occurrences := &eventOccurrences{}
+	continuationToken := ""
+	for {
+		page, err := p.Events(context.Background(), address, fromBlock, toBlock, continuationToken)
+		if err != nil {
+			return err
+		}
+		for _, event := range page.Events {
+			occurrence := occurrences.next(event)
+			// Processed by the backfill before falling back to polling
+			if p.isBackfilledEmittedEvent(event) {
+				continue
+			}
+			if err := p.processEmittedEvent(event, occurrence); err != nil {
+				return err
+			}
+		}
+		continuationToken = page.ContinuationToken
+		if continuationToken == "" {
+			return nil
+		}
+	}
+}
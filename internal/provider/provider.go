@@ -1,47 +1,256 @@
 package provider
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/b-j-roberts/foc-engine/internal/config"
 	"github.com/gorilla/websocket"
 )
 
-type Provider struct {
-	RpcHost       string
+// Provider is the node access used by the registry & routes, see RpcProvider & MemoryProvider
+type Provider interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	BlockHeader(ctx context.Context, blockNumber uint) (BlockHeader, error)
+	ClassHashAt(ctx context.Context, address string) (string, error)
+	Class(ctx context.Context, classHash string) (*ContractClass, error)
+	ClassAt(ctx context.Context, address string) (*ContractClass, error)
+	// Page of the events emitted by address in [fromBlock, toBlock]
+	Events(ctx context.Context, address string, fromBlock uint, toBlock uint, continuationToken string) (*EventsPage, error)
+	// Sets the Result or Err of each call, see ContractCall
+	CallContracts(ctx context.Context, calls []*ContractCall, blockId interface{}) error
+	TransactionWithReceipt(ctx context.Context, transactionHash string) (*Transaction, *TransactionReceipt, error)
+
+	SubscribeEvents(address string) error
+	PauseSubscription(address string) error
+	ResumeSubscription(address string) error
+	RemoveSubscription(address string) error
+	GetSubscriptions() []EventSubscription
+
+	// Starts delivering the events of the subscriptions, see IndexerOptions
+	StartIndexer(options IndexerOptions) error
+	// Whether the indexer runs, the subscription methods return ErrNotIndexing until then
+	Indexing() bool
+	// Chain heads tracked by the indexer, nil if the provider doesn't track them
+	ChainHeads() *HeadTracker
+	// Endpoints of the rpc, nil for providers without one ( ex: MemoryProvider )
+	RpcEndpoints() *RpcEndpointPool
+	GetWebSocketStatus() WebSocketStatus
+}
+
+// Returned by the subscription methods of an RpcProvider not running the indexer
+var ErrNotIndexing = errors.New("provider isn't running the WebSocket indexer")
+
+// IndexerOptions configures the indexer of an RpcProvider, see StartIndexer
+type IndexerOptions struct {
+	// Mode, start block & finality of the subscriptions
+	Config config.IndexerConfig
+	// Called with each starknet_subscriptionEvents message, one at a time
+	ProcessStarknetEventData func([]byte)
+	// Returns the block a contract's subscription starts from ( ex: the block of its last
+	// stored event, on restart ), ok false to use Config.StartAt
+	ContractResumeBlock func(address string) (blockNumber uint, ok bool)
+	// Called when blocks are reverted, before resubscribing from the resume block
+	OnReorg func(reorg ReorgData)
+}
+
+// RpcProvider is the Provider of a Starknet rpc, & its WebSocket indexer once started
+// with StartIndexer. Each provider tracks its own chain heads & subscriptions, so
+// providers of different networks can index in the same process.
+type RpcProvider struct {
+	RpcHost   string
+	Endpoints *RpcEndpointPool
+	// Rolling window of the latest block headers, used to timestamp events & detect reorgs
+	Heads *HeadTracker
+
 	WebSocketConn *websocket.Conn
+	// Endpoint the WebSocket is connected to
+	WebSocketEndpoint *RpcEndpoint
+	// Addresses subscribed to with SubscribeEvents, resubscribed on failover
+	Subscriptions []string
+
+	// Set by StartIndexer, before any indexer goroutine starts
+	indexing bool
+	options  IndexerOptions
+	// Serializes event processing between the WebSocket notifications, backfills & polling
+	processMutex sync.Mutex
+	// Last reorg handled, the node notifies a reorg once per subscription
+	reorgMutex  sync.Mutex
+	lastReorg   *ReorgData
+	lastReorgAt time.Time
+	// Guards the WebSocket fields & writes to the connection
+	wsMutex             sync.Mutex
+	wsState             WebSocketState
+	wsConnectedAt       time.Time
+	wsDisconnectedAt    time.Time
+	wsReconnectAttempts int
+	wsLastError         string
+	// Incremented on each new connection
+	wsGeneration   uint64
+	backfillJobs   []backfillJob
+	backfillSignal chan struct{}
+	// WebSocket notifications waiting to be processed, see enqueueNotification
+	notifications chan func()
+	// Map: Normalized address -> last backfilled block, skipped when the subscription replays it
+	backfilledThrough map[string]uint
+	// Polling mode, Map: Address -> next block to poll
+	polling     bool
+	pollCursors map[string]uint
+	// Map: Normalized address -> subscription table entry, see GetSubscriptions
+	subscriptionTable map[string]*EventSubscription
+	// Map: Subscription id -> normalized address, for the current connection
+	subscriptionIds     map[SubscriptionId]string
+	headsSubscriptionId SubscriptionId
+	// Map: Request id -> WebSocket call waiting for its response
+	pendingRequests map[int]pendingRequest
+	nextRequestId   int
+	closing         bool
+	closeChan       chan struct{}
+	// Goroutines processing events ( notifications, backfills & polling ), waited for by Close
+	workers sync.WaitGroup
 }
 
-var StarknetProvider *Provider
+// Provider of the indexer, set by InitProvider
+var StarknetProvider *RpcProvider
 
-func InitProvider(processStarknetEventData func([]byte), connectWs bool) error {
-	var conn *websocket.Conn
-	var err error
-	if connectWs {
-		conn, err = ConnectStarknetWebSocket(processStarknetEventData)
-		if err != nil {
-			fmt.Println("Error connecting to WebSocket:", err)
-			return err
+// NewRpcProvider creates a provider of the endpoints, for rpc calls until StartIndexer
+func NewRpcProvider(endpointConfigs []config.RpcEndpointConfig) *RpcProvider {
+	return newRpcProvider(NewRpcEndpointPool(endpointConfigs))
+}
+
+func newRpcProvider(endpoints *RpcEndpointPool) *RpcProvider {
+	return &RpcProvider{
+		Endpoints:         endpoints,
+		Heads:             NewHeadTracker(HeadWindowSize),
+		Subscriptions:     []string{},
+		wsState:           WebSocketDisconnected,
+		backfillSignal:    make(chan struct{}, 1),
+		notifications:     make(chan func(), NotificationQueueSize),
+		backfilledThrough: make(map[string]uint),
+		pollCursors:       make(map[string]uint),
+		subscriptionTable: make(map[string]*EventSubscription),
+		subscriptionIds:   make(map[SubscriptionId]string),
+		pendingRequests:   make(map[int]pendingRequest),
+		closeChan:         make(chan struct{}),
+	}
+}
+
+var (
+	defaultProvider     *RpcProvider
+	defaultProviderOnce sync.Once
+)
+
+// Default returns the provider started by InitProvider, or a provider of the configured
+// endpoints when it isn't initialized ( ex: api, cli tools )
+func Default() *RpcProvider {
+	if StarknetProvider != nil {
+		return StarknetProvider
+	}
+	defaultProviderOnce.Do(func() {
+		defaultProvider = NewRpcProvider(config.GetRpcEndpoints())
+		if len(defaultProvider.Endpoints.Endpoints) > 1 {
+			go defaultProvider.Endpoints.StartHealthChecks()
 		}
-	} else {
-		conn = nil
+	})
+	return defaultProvider
+}
+
+// Indexing reports whether the provider runs the WebSocket indexer & its subscriptions
+func (p *RpcProvider) Indexing() bool {
+	if p == nil {
+		return false
 	}
-	// Create a new Provider instance
-	StarknetProvider = &Provider{
-		RpcHost:       config.Conf.Rpc.Host,
-		WebSocketConn: conn,
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	return p.indexing
+}
+
+// ChainHeads returns the heads tracked by the indexer
+func (p *RpcProvider) ChainHeads() *HeadTracker {
+	return p.Heads
+}
+
+// RpcEndpoints returns the endpoints of the provider, see RpcEndpointPool.Ranked
+func (p *RpcProvider) RpcEndpoints() *RpcEndpointPool {
+	return p.Endpoints
+}
+
+// InitProvider starts the indexer on the provider & makes it the Default provider
+func InitProvider(p *RpcProvider, options IndexerOptions) error {
+	StarknetProvider = p
+	return p.StartIndexer(options)
+}
+
+// StartIndexer connects the WebSocket ( or starts polling, see IndexerOptions.Config.Mode ),
+// the subscriptions are then added with SubscribeEvents
+func (p *RpcProvider) StartIndexer(options IndexerOptions) error {
+	p.wsMutex.Lock()
+	if p.indexing {
+		p.wsMutex.Unlock()
+		return fmt.Errorf("provider already indexing")
 	}
+	p.indexing = true
+	p.options = options
+	p.wsMutex.Unlock()
+	p.Endpoints.onHealthCheck = p.checkWebSocketHealth
+	p.Endpoints.StartHealthChecks()
 
+	p.workers.Add(1)
+	go p.runNotifications()
+	mode := p.indexerMode()
+	if mode == IndexerModePolling {
+		p.startPolling()
+		return nil
+	}
+	_, err := p.ConnectStarknetWebSocket()
+	if err != nil {
+		fmt.Println("Error connecting to WebSocket:", err)
+		if mode == IndexerModeWebSocket {
+			return err
+		}
+		fmt.Println("Falling back to polling")
+		p.startPolling()
+		return nil
+	}
+	p.workers.Add(1)
+	go p.runBackfills()
 	return nil
 }
 
-func Close() {
-	if StarknetProvider != nil && StarknetProvider.WebSocketConn != nil {
-		err := StarknetProvider.WebSocketConn.Close()
+// Close stops the health checks & the indexer, closing the WebSocket connection, then waits
+// for the events being processed
+func (p *RpcProvider) Close() {
+	p.Endpoints.Stop()
+	p.wsMutex.Lock()
+	if !p.closing {
+		p.closing = true
+		p.wsState = WebSocketClosed
+		close(p.closeChan)
+	}
+	if p.WebSocketConn != nil {
+		err := p.WebSocketConn.Close()
 		if err != nil {
 			fmt.Println("Error closing WebSocket connection:", err)
 		} else {
 			fmt.Println("WebSocket connection closed")
 		}
 	}
+	p.wsMutex.Unlock()
+	// Processing takes wsMutex
+	p.workers.Wait()
 }
+
+// GetWebSocketUrl returns the url of the current WebSocket connection, empty if disconnected
+func (p *RpcProvider) GetWebSocketUrl() string {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.WebSocketConn == nil || p.WebSocketEndpoint == nil {
+		return ""
+	}
+	return p.WebSocketEndpoint.WsUrl
+}
+
+var _ Provider = (*RpcProvider)(nil)
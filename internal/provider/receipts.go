@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+)
+
+type FeePayment struct {
+	Amount string `json:"amount"`
+	Unit   string `json:"unit"`
+}
+
+type ReceiptEvent struct {
+	FromAddress string   `json:"from_address"`
+	Keys        []string `json:"keys"`
+	Data        []string `json:"data"`
+}
+
+type TransactionReceipt struct {
+	TransactionHash string         `json:"transaction_hash"`
+	Type            string         `json:"type"`
+	ExecutionStatus string         `json:"execution_status"`
+	FinalityStatus  string         `json:"finality_status"`
+	ActualFee       FeePayment     `json:"actual_fee"`
+	RevertReason    string         `json:"revert_reason,omitempty"`
+	BlockHash       string         `json:"block_hash,omitempty"`
+	BlockNumber     *uint          `json:"block_number,omitempty"`
+	Events          []ReceiptEvent `json:"events"`
+	// Deployed contract of DEPLOY_ACCOUNT & DEPLOY receipts
+	ContractAddress string `json:"contract_address,omitempty"`
+}
+
+type Transaction struct {
+	TransactionHash string `json:"transaction_hash"`
+	Type            string `json:"type"`
+	Version         string `json:"version"`
+	// Signing account of INVOKE v1+ & DECLARE transactions
+	SenderAddress string `json:"sender_address,omitempty"`
+	// Called contract of INVOKE v0 & L1_HANDLER transactions
+	ContractAddress string `json:"contract_address,omitempty"`
+	Nonce           string `json:"nonce,omitempty"`
+}
+
+// Sender returns the account which signed the transaction, empty if it has none ( L1_HANDLER )
+func (t *Transaction) Sender(receipt *TransactionReceipt) string {
+	if t.SenderAddress != "" {
+		return t.SenderAddress
+	}
+	switch t.Type {
+	case "INVOKE":
+		return t.ContractAddress
+	case "DEPLOY_ACCOUNT":
+		return receipt.ContractAddress
+	}
+	return ""
+}
+
+// GetStarknetTransactionWithReceipt fetches a transaction & its receipt in a single batch
+func GetStarknetTransactionWithReceipt(ctx context.Context, transactionHash string) (*Transaction, *TransactionReceipt, error) {
+	return Default().TransactionWithReceipt(ctx, transactionHash)
+}
+
+// TransactionWithReceipt fetches a transaction & its receipt in a single batch
+func (p *RpcProvider) TransactionWithReceipt(ctx context.Context, transactionHash string) (*Transaction, *TransactionReceipt, error) {
+	var transaction Transaction
+	var receipt TransactionReceipt
+	params := []interface{}{transactionHash}
+	calls := []*RpcBatchCall{
+		{Method: "starknet_getTransactionByHash", Params: params, Result: &transaction},
+		{Method: "starknet_getTransactionReceipt", Params: params, Result: &receipt},
+	}
+	if err := p.Endpoints.Batch(ctx, calls); err != nil {
+		return nil, nil, err
+	}
+	for _, call := range calls {
+		if call.Err != nil {
+			return nil, nil, call.Err
+		}
+	}
+	if receipt.TransactionHash == "" {
+		return nil, nil, fmt.Errorf("no receipt for transaction: %s", transactionHash)
+	}
+	return &transaction, &receipt, nil
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	ReorgSourceNotification = "notification"
+	ReorgSourceHashMismatch = "hash_mismatch"
+)
+
+// ReorgData is a range of blocks reverted by the chain, from a
+// starknet_subscriptionReorg notification or a block hash mismatch of new heads
+type ReorgData struct {
+	StartingBlockHash   string `json:"starting_block_hash"`
+	StartingBlockNumber uint   `json:"starting_block_number"`
+	EndingBlockHash     string `json:"ending_block_hash"`
+	EndingBlockNumber   uint   `json:"ending_block_number"`
+	Source              string `json:"source"`
+}
+
+type reorgNotification struct {
+	Params struct {
+		Result ReorgData `json:"result"`
+	} `json:"params"`
+}
+
+// Reorgs within an already handled range are ignored for this long
+const reorgDedupWindow = time.Minute
+
+func (p *RpcProvider) processReorgNotification(message []byte) {
+	var notification reorgNotification
+	if err := json.Unmarshal(message, &notification); err != nil {
+		fmt.Println("Error unmarshalling reorg:", err)
+		return
+	}
+	reorg := notification.Params.Result
+	reorg.Source = ReorgSourceNotification
+	p.handleReorg(reorg)
+}
+
+// handleReorg rolls back the chain heads past the fork point, notifies the
+// provider's OnReorg hook & reconnects so every subscription restarts from
+// the resume block
+func (p *RpcProvider) handleReorg(reorg ReorgData) {
+	p.reorgMutex.Lock()
+	if last := p.lastReorg; last != nil && time.Since(p.lastReorgAt) < reorgDedupWindow &&
+		reorg.StartingBlockNumber >= last.StartingBlockNumber && reorg.EndingBlockNumber <= last.EndingBlockNumber {
+		p.reorgMutex.Unlock()
+		return
+	}
+	p.lastReorg = &reorg
+	p.lastReorgAt = time.Now()
+	p.reorgMutex.Unlock()
+
+	fmt.Printf("Chain reorg ( %s ) of blocks %d - %d\n", reorg.Source, reorg.StartingBlockNumber, reorg.EndingBlockNumber)
+	p.Heads.Rollback(reorg.StartingBlockNumber)
+	if p.options.OnReorg != nil {
+		p.processMutex.Lock()
+		p.options.OnReorg(reorg)
+		p.processMutex.Unlock()
+	}
+	p.rewindCursors(reorg.StartingBlockNumber)
+	p.restartStarknetWebSocket()
+}
+
+// detectReorg checks a new head against the window, returning the reverted
+// range if the head doesn't extend the tracked chain
+func (p *RpcProvider) detectReorg(header BlockHeader) (ReorgData, bool) {
+	head, _, ok := p.Heads.Head()
+	if !ok {
+		return ReorgData{}, false
+	}
+	forkBlock := uint(0)
+	if existing, ok := p.Heads.Get(header.BlockNumber); ok && existing.BlockHash != header.BlockHash {
+		forkBlock = header.BlockNumber
+	} else if header.BlockNumber > 0 {
+		parent, ok := p.Heads.Get(header.BlockNumber - 1)
+		if !ok || parent.BlockHash == header.ParentHash {
+			return ReorgData{}, false
+		}
+		forkBlock = header.BlockNumber - 1
+	} else {
+		return ReorgData{}, false
+	}
+
+	// Walk back to the first block still matching the canonical chain
+	for forkBlock > 0 {
+		stored, ok := p.Heads.Get(forkBlock - 1)
+		if !ok {
+			break
+		}
+		canonical, err := p.BlockHeader(context.Background(), forkBlock-1)
+		if err != nil {
+			fmt.Println("Error getting block header for reorg:", forkBlock-1, err)
+			break
+		}
+		if canonical.BlockHash == stored.BlockHash {
+			break
+		}
+		forkBlock--
+	}
+	starting, _ := p.Heads.Get(forkBlock)
+	return ReorgData{
+		StartingBlockHash:   starting.BlockHash,
+		StartingBlockNumber: forkBlock,
+		EndingBlockHash:     head.BlockHash,
+		EndingBlockNumber:   head.BlockNumber,
+		Source:              ReorgSourceHashMismatch,
+	}, true
+}
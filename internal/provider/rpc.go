@@ -2,14 +2,9 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"math/big"
-	"net/http"
-	"os"
-
-	"github.com/b-j-roberts/foc-engine/internal/config"
 )
 
 type StarknetRpcCall struct {
@@ -19,13 +14,6 @@ type StarknetRpcCall struct {
 	Params  interface{} `json:"params"`
 }
 
-type StarknetRpcResponse struct {
-	Jsonrpc string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Result  interface{} `json:"result"`
-	Error   interface{} `json:"error"`
-}
-
 /*
 Sample curl command to replicate
 
@@ -42,52 +30,16 @@ curl --location 'http://localhost:5050' \               ✔
 	{"jsonrpc":"2.0","id":1,"result":1}
 */
 func GetStarknetLatestBlockNumber() (uint64, error) {
-	// Create a new StarknetRpcCall object
-	call := StarknetRpcCall{
-		ID:      1,
-		Jsonrpc: "2.0",
-		Method:  "starknet_blockNumber",
-		Params:  []interface{}{},
-	}
-
-	// Marshal the call to JSON
-	jsonData, err := json.Marshal(call)
-	if err != nil {
-		return 0, err
-	}
-
-	// Send the request to the Starknet RPC endpoint
-	url := "http://" + config.Conf.Rpc.Host
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
+	return Default().BlockNumber(context.Background())
+}
 
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
+func (p *RpcProvider) BlockNumber(ctx context.Context) (uint64, error) {
+	var blockNumber uint64
+	err := p.Endpoints.Call(ctx, "starknet_blockNumber", []interface{}{}, &blockNumber)
 	if err != nil {
 		return 0, err
 	}
-
-	// Unmarshal the response into a StarknetRpcResponse object
-	var response StarknetRpcResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return 0, err
-	}
-
-	// Check for errors in the response
-	if response.Error != nil {
-		return 0, fmt.Errorf("error from server: %v", response.Error)
-	}
-
-	// Extract the block number from the result
-	blockNumber, ok := response.Result.(float64)
-	if !ok {
-		return 0, fmt.Errorf("invalid result format")
-	}
-
-	return uint64(blockNumber), nil
+	return blockNumber, nil
 }
 
 type ContractClass struct {
@@ -98,109 +50,91 @@ type ContractClass struct {
 	Abi []interface{} `json:"abi"`
 }
 
-func GetStarknetClassAt(address string) (*ContractClass, error) {
-	// Create a new StarknetRpcCall object
-	call := StarknetRpcCall{
-		ID:      1,
-		Jsonrpc: "2.0",
-		Method:  "starknet_getClassAt",
-		Params: []interface{}{
-			"latest",
-			address,
-		},
+// ParseContractClass parses a class returned by the rpc. Sierra classes hold
+// their abi as a json encoded string, while deprecated ( cairo 0 ) classes hold
+// it as an array
+func ParseContractClass(class []byte) (*ContractClass, error) {
+	var rawClass struct {
+		Abi json.RawMessage `json:"abi"`
 	}
-
-	// Marshal the call to JSON
-	jsonData, err := json.Marshal(call)
-	if err != nil {
+	if err := json.Unmarshal(class, &rawClass); err != nil {
 		return nil, err
 	}
-
-	// Send the request to the Starknet RPC endpoint
-	url := "http://" + config.Conf.Rpc.Host
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	abi, err := ParseAbi(rawClass.Abi)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &ContractClass{
+		Abi: abi,
+	}, nil
+}
 
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// ParseAbi parses an abi from either its json array or json string form
+func ParseAbi(rawAbi []byte) ([]interface{}, error) {
+	rawAbi = bytes.TrimSpace(rawAbi)
+	if len(rawAbi) == 0 || bytes.Equal(rawAbi, []byte("null")) {
+		return nil, fmt.Errorf("invalid result format, abi not found")
 	}
-	// Example:
-	// "abi": "[{\"type\":\"impl\",\"name\":\"Point\",\"size\":1,\"offset\":0,\"members\":[{\"type\":\"felt\",\"name\":\"x\"}]}]" ->
-	// "abi": [{"type":"impl","name":"Point","size":1,"offset":0,"members":[{"type":"felt","name":"x"}]}]
-	// Remove all \ characters from the response body
-	body = bytes.ReplaceAll(body, []byte("\\\""), []byte("\""))
-	// Remove quotes around abi
-	body = bytes.ReplaceAll(body, []byte("\"["), []byte("["))
-	body = bytes.ReplaceAll(body, []byte("]\""), []byte("]"))
-
-	// Unmarshal the response into a StarknetRpcResponse object
-	var response StarknetRpcResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, err
+	if rawAbi[0] == '"' {
+		var abiString string
+		if err := json.Unmarshal(rawAbi, &abiString); err != nil {
+			return nil, fmt.Errorf("invalid abi string: %w", err)
+		}
+		rawAbi = []byte(abiString)
 	}
-	// Check for errors in the response
-	if response.Error != nil {
-		return nil, fmt.Errorf("error from server: %v", response.Error)
+	var abi []interface{}
+	if err := json.Unmarshal(rawAbi, &abi); err != nil {
+		return nil, fmt.Errorf("invalid abi: %w", err)
 	}
+	return abi, nil
+}
 
-	// Extract the contract class from the result
-	contractClass := response.Result
+func GetStarknetClassAt(address string) (*ContractClass, error) {
+	return Default().ClassAt(context.Background(), address)
+}
 
-	// TODO
-	// Output the contract class to a file for debugging
-	filename := fmt.Sprintf("contract_class_%s.json", address)
-	contractClassJson, err := json.MarshalIndent(contractClass, "", "  ")
+func (p *RpcProvider) ClassAt(ctx context.Context, address string) (*ContractClass, error) {
+	var result json.RawMessage
+	err := p.Endpoints.Call(ctx, "starknet_getClassAt", []interface{}{
+		"latest",
+		address,
+	}, &result)
 	if err != nil {
-		fmt.Println("Error marshalling contract class to JSON:", err)
 		return nil, err
 	}
-	err = os.WriteFile(filename, contractClassJson, 0644)
-	if err != nil {
-		fmt.Println("Error writing contract class to file:", err)
-		return nil, err
-	}
-
-	// Convert the contract class to a ContractClass object
-	abi, ok := contractClass.(map[string]interface{})["abi"].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid result format, abi not found")
-	}
-	contractClassObj := &ContractClass{
-		Abi: abi,
-	}
-	return contractClassObj, nil
+	return ParseContractClass(result)
 }
 
-func Mint(address string, amount *big.Int, unit string) error {
-	// Create a new request body
-	requestBody := map[string]interface{}{
-		"address": address,
-		"amount":  amount,
-		"unit":    unit,
-	}
+func GetStarknetClassHashAt(address string) (string, error) {
+	return Default().ClassHashAt(context.Background(), address)
+}
 
-	// Marshal the request body to JSON
-	jsonData, err := json.Marshal(requestBody)
+func (p *RpcProvider) ClassHashAt(ctx context.Context, address string) (string, error) {
+	var classHash string
+	err := p.Endpoints.Call(ctx, "starknet_getClassHashAt", []interface{}{
+		"latest",
+		address,
+	}, &classHash)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return classHash, nil
+}
 
-	// Send the request to the mint endpoint
-	url := "http://" + config.Conf.Rpc.Host + "/mint"
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// GetStarknetClass returns a declared class by its class hash
+func GetStarknetClass(classHash string) (*ContractClass, error) {
+	return Default().Class(context.Background(), classHash)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to mint: %s", resp.Status)
+// Class returns a declared class by its class hash
+func (p *RpcProvider) Class(ctx context.Context, classHash string) (*ContractClass, error) {
+	var result json.RawMessage
+	err := p.Endpoints.Call(ctx, "starknet_getClass", []interface{}{
+		"latest",
+		classHash,
+	}, &result)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return ParseContractClass(result)
 }
@@ -0,0 +1,471 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event subscription statuses
+const (
+	// Backfilling, or waiting for the subscribe response
+	SubscriptionPending = "pending"
+	SubscriptionActive  = "active"
+	SubscriptionPaused  = "paused"
+)
+
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// SubscriptionId is a WebSocket subscription id, a string since rpc v0.8 & a number before
+type SubscriptionId string
+
+func (id *SubscriptionId) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = SubscriptionId(s)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid subscription id: %s", string(data))
+	}
+	*id = SubscriptionId(number.String())
+	return nil
+}
+
+func (id SubscriptionId) String() string {
+	return string(id)
+}
+
+// EventSubscription is an entry of the subscription table, one per subscribed contract
+type EventSubscription struct {
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	// Id of the current subscription, empty while pending or paused
+	SubscriptionId SubscriptionId `json:"subscription_id,omitempty"`
+	// Block the current subscription ( or its backfill ) started from
+	FromBlock    uint      `json:"from_block"`
+	SubscribedAt time.Time `json:"subscribed_at"`
+	PausedAt     time.Time `json:"paused_at"`
+	// Block the backfill restarts from once resumed, set while paused
+	ResumeBlock uint `json:"resume_block,omitempty"`
+	// Last block whose events were all received, reconnects & resumes restart after it
+	ProcessedThrough *uint `json:"processed_through,omitempty"`
+	// Notifications received on the subscription
+	Events         uint64 `json:"events"`
+	LastEventBlock *uint  `json:"last_event_block,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+}
+
+// pendingRequest is a WebSocket call waiting for its response
+type pendingRequest struct {
+	method  string
+	address string
+	// Unsubscribed id, for starknet_unsubscribe calls
+	subscriptionId SubscriptionId
+}
+
+type wsResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RpcError       `json:"error"`
+}
+
+type subscriptionNotification struct {
+	Params struct {
+		SubscriptionId SubscriptionId `json:"subscription_id"`
+		Result         struct {
+			// Missing for pre-confirmed events
+			BlockNumber *uint `json:"block_number"`
+		} `json:"result"`
+	} `json:"params"`
+}
+
+// sendWebSocketRequest sends a call with a new request id, so its response can be matched
+func (p *RpcProvider) sendWebSocketRequest(method string, params interface{}, request pendingRequest) error {
+	request.method = method
+	p.wsMutex.Lock()
+	p.nextRequestId++
+	id := p.nextRequestId
+	p.pendingRequests[id] = request
+	p.wsMutex.Unlock()
+
+	err := p.writeWebSocketMessage(StarknetRpcCall{
+		ID:      id,
+		Jsonrpc: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		p.wsMutex.Lock()
+		delete(p.pendingRequests, id)
+		p.wsMutex.Unlock()
+	}
+	return err
+}
+
+func (p *RpcProvider) sendUnsubscribe(subscriptionId SubscriptionId) error {
+	params := map[string]interface{}{
+		"subscription_id": subscriptionId,
+	}
+	return p.sendWebSocketRequest("starknet_unsubscribe", params, pendingRequest{subscriptionId: subscriptionId})
+}
+
+// resetSubscriptionIds forgets the ids & pending calls of the previous connection,
+// called with wsMutex held when a new connection is made
+func (p *RpcProvider) resetSubscriptionIds() {
+	p.subscriptionIds = make(map[SubscriptionId]string)
+	p.pendingRequests = make(map[int]pendingRequest)
+	p.headsSubscriptionId = ""
+	for _, entry := range p.subscriptionTable {
+		entry.SubscriptionId = ""
+		if entry.Status == SubscriptionActive {
+			entry.Status = SubscriptionPending
+		}
+	}
+}
+
+// trackSubscription adds a contract to the subscription table, called with wsMutex held
+func (p *RpcProvider) trackSubscription(address string, fromBlock uint) {
+	p.subscriptionTable[normalizeAddress(address)] = &EventSubscription{
+		Address:   address,
+		Status:    SubscriptionPending,
+		FromBlock: fromBlock,
+	}
+}
+
+// processWebSocketResponse matches a call response to its request
+func (p *RpcProvider) processWebSocketResponse(message []byte) {
+	var response wsResponse
+	if err := json.Unmarshal(message, &response); err != nil {
+		fmt.Println("Error unmarshalling WebSocket response:", err)
+		return
+	}
+	p.wsMutex.Lock()
+	request, ok := p.pendingRequests[response.ID]
+	delete(p.pendingRequests, response.ID)
+	p.wsMutex.Unlock()
+	if !ok {
+		fmt.Println("Received response to unknown request:", string(message))
+		return
+	}
+	if response.Error != nil {
+		fmt.Println("Error response to", request.method, request.address, response.Error)
+		if request.address != "" {
+			p.wsMutex.Lock()
+			if entry, ok := p.subscriptionTable[normalizeAddress(request.address)]; ok {
+				entry.LastError = response.Error.Error()
+			}
+			p.wsMutex.Unlock()
+		}
+		return
+	}
+
+	switch request.method {
+	case "starknet_subscribeNewHeads":
+		var subscriptionId SubscriptionId
+		if err := json.Unmarshal(response.Result, &subscriptionId); err != nil {
+			fmt.Println("Error unmarshalling subscription id:", err)
+			return
+		}
+		p.wsMutex.Lock()
+		p.headsSubscriptionId = subscriptionId
+		p.wsMutex.Unlock()
+	case "starknet_subscribeEvents":
+		var subscriptionId SubscriptionId
+		if err := json.Unmarshal(response.Result, &subscriptionId); err != nil {
+			fmt.Println("Error unmarshalling subscription id:", err)
+			return
+		}
+		p.onEventsSubscribed(request.address, subscriptionId)
+	case "starknet_unsubscribe":
+		// Notifications received until now were sent before the unsubscribe
+		p.wsMutex.Lock()
+		delete(p.subscriptionIds, request.subscriptionId)
+		p.wsMutex.Unlock()
+		fmt.Println("Unsubscribed:", request.subscriptionId)
+	}
+}
+
+// onEventsSubscribed records the id of a new events subscription, unsubscribing the
+// previous subscription of the contract if it is a duplicate
+func (p *RpcProvider) onEventsSubscribed(address string, subscriptionId SubscriptionId) {
+	p.wsMutex.Lock()
+	p.subscriptionIds[subscriptionId] = normalizeAddress(address)
+	entry, ok := p.subscriptionTable[normalizeAddress(address)]
+	var unsubscribeId SubscriptionId
+	if !ok || entry.Status == SubscriptionPaused {
+		// Paused or removed while subscribing
+		unsubscribeId = subscriptionId
+	} else {
+		if entry.SubscriptionId != "" && entry.SubscriptionId != subscriptionId {
+			fmt.Println("Duplicate subscription for contract:", address, entry.SubscriptionId)
+			unsubscribeId = entry.SubscriptionId
+		}
+		entry.SubscriptionId = subscriptionId
+		entry.Status = SubscriptionActive
+		entry.SubscribedAt = time.Now().UTC()
+		entry.LastError = ""
+	}
+	p.wsMutex.Unlock()
+
+	fmt.Println("Subscribed to events for contract:", address, "id:", subscriptionId)
+	if unsubscribeId != "" {
+		if err := p.sendUnsubscribe(unsubscribeId); err != nil {
+			fmt.Println("Error unsubscribing:", unsubscribeId, err)
+		}
+	}
+}
+
+// recordSubscriptionEvent counts an events notification on its subscription
+// Returns false for notifications of unknown ( unsubscribed ) subscriptions
+func (p *RpcProvider) recordSubscriptionEvent(message []byte) bool {
+	var notification subscriptionNotification
+	if err := json.Unmarshal(message, &notification); err != nil {
+		fmt.Println("Error unmarshalling subscription id:", err)
+		return false
+	}
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	address, ok := p.subscriptionIds[notification.Params.SubscriptionId]
+	if !ok {
+		return false
+	}
+	entry, ok := p.subscriptionTable[address]
+	if !ok {
+		return false
+	}
+	entry.Events++
+	if blockNumber := notification.Params.Result.BlockNumber; blockNumber != nil {
+		if entry.LastEventBlock == nil || *blockNumber > *entry.LastEventBlock {
+			entry.LastEventBlock = blockNumber
+		}
+		// Events are notified in block order, the previous blocks are complete
+		if *blockNumber > 0 {
+			advanceCursor(entry, *blockNumber-1)
+		}
+		// In flight events of a paused subscription, other events of their block may be missed
+		if entry.Status == SubscriptionPaused && *blockNumber > entry.ResumeBlock {
+			entry.ResumeBlock = *blockNumber
+		}
+	}
+	return true
+}
+
+// GetSubscriptions returns the subscription table, sorted by address
+func (p *RpcProvider) GetSubscriptions() []EventSubscription {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	subscriptions := make([]EventSubscription, 0, len(p.subscriptionTable))
+	for _, entry := range p.subscriptionTable {
+		subscriptions = append(subscriptions, *entry)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Address < subscriptions[j].Address
+	})
+	return subscriptions
+}
+
+// removeSubscription stops following a contract, returning its table entry & the
+// subscription id to unsubscribe. Called with wsMutex held.
+func (p *RpcProvider) removeSubscription(address string) (*EventSubscription, SubscriptionId, error) {
+	entry, ok := p.subscriptionTable[normalizeAddress(address)]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %s", ErrSubscriptionNotFound, address)
+	}
+	subscriptions := make([]string, 0, len(p.Subscriptions))
+	for _, subscription := range p.Subscriptions {
+		if normalizeAddress(subscription) != normalizeAddress(address) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	p.Subscriptions = subscriptions
+	jobs := make([]backfillJob, 0, len(p.backfillJobs))
+	for _, job := range p.backfillJobs {
+		if normalizeAddress(job.address) != normalizeAddress(address) {
+			jobs = append(jobs, job)
+		}
+	}
+	p.backfillJobs = jobs
+	for cursorAddress := range p.pollCursors {
+		if normalizeAddress(cursorAddress) == normalizeAddress(address) {
+			delete(p.pollCursors, cursorAddress)
+		}
+	}
+	subscriptionId := entry.SubscriptionId
+	entry.SubscriptionId = ""
+	return entry, subscriptionId, nil
+}
+
+// PauseSubscription stops indexing a contract until ResumeSubscription, which backfills
+// the blocks missed while paused
+func (p *RpcProvider) PauseSubscription(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
+	}
+	p.wsMutex.Lock()
+	if entry, ok := p.subscriptionTable[normalizeAddress(address)]; ok && entry.Status == SubscriptionPaused {
+		p.wsMutex.Unlock()
+		return nil
+	}
+	// Poll cursors are dropped by removeSubscription
+	resumeBlock := p.subscriptionCursor(address)
+	entry, subscriptionId, err := p.removeSubscription(address)
+	if err != nil {
+		p.wsMutex.Unlock()
+		return err
+	}
+	entry.Status = SubscriptionPaused
+	entry.PausedAt = time.Now().UTC()
+	entry.ResumeBlock = resumeBlock
+	p.wsMutex.Unlock()
+
+	fmt.Println("Paused subscription for contract:", address, "resuming from block", resumeBlock)
+	if subscriptionId != "" {
+		return p.sendUnsubscribe(subscriptionId)
+	}
+	return nil
+}
+
+// ResumeSubscription restarts indexing a paused contract from its resume block
+func (p *RpcProvider) ResumeSubscription(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
+	}
+	p.wsMutex.Lock()
+	entry, ok := p.subscriptionTable[normalizeAddress(address)]
+	if !ok {
+		p.wsMutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, address)
+	}
+	if entry.Status != SubscriptionPaused {
+		p.wsMutex.Unlock()
+		return nil
+	}
+	resumeBlock := entry.ResumeBlock
+	entry.Status = SubscriptionPending
+	entry.FromBlock = resumeBlock
+	entry.ResumeBlock = 0
+	p.Subscriptions = append(p.Subscriptions, entry.Address)
+	polling := p.polling
+	if polling {
+		entry.Status = SubscriptionActive
+		p.pollCursors[entry.Address] = resumeBlock
+	}
+	p.wsMutex.Unlock()
+
+	fmt.Println("Resumed subscription for contract:", address, "from block", resumeBlock)
+	if !polling {
+		p.enqueueBackfill(entry.Address, resumeBlock)
+	}
+	return nil
+}
+
+// RemoveSubscription stops indexing a contract & drops it from the subscription table,
+// until it is subscribed again ( ex: on restart, for registered contracts )
+func (p *RpcProvider) RemoveSubscription(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
+	}
+	p.wsMutex.Lock()
+	_, subscriptionId, err := p.removeSubscription(address)
+	if err != nil {
+		p.wsMutex.Unlock()
+		return err
+	}
+	delete(p.subscriptionTable, normalizeAddress(address))
+	delete(p.backfilledThrough, normalizeAddress(address))
+	// In flight notifications are dropped
+	delete(p.subscriptionIds, subscriptionId)
+	p.wsMutex.Unlock()
+
+	fmt.Println("Removed subscription for contract:", address)
+	if subscriptionId != "" {
+		return p.sendUnsubscribe(subscriptionId)
+	}
+	return nil
+}
+
+// advanceCursor records that the events of a subscription up to blockNumber were all received
+func advanceCursor(entry *EventSubscription, blockNumber uint) {
+	if entry.ProcessedThrough == nil || blockNumber > *entry.ProcessedThrough {
+		entry.ProcessedThrough = &blockNumber
+	}
+}
+
+// setProcessedThrough advances the cursor of a contract's subscription
+func (p *RpcProvider) setProcessedThrough(address string, blockNumber uint) {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if entry, ok := p.subscriptionTable[normalizeAddress(address)]; ok {
+		advanceCursor(entry, blockNumber)
+	}
+}
+
+// subscriptionCursor returns the block indexing a contract restarts from, its poll cursor or
+// the block after the last one whose events were all received. Called with wsMutex held.
+func (p *RpcProvider) subscriptionCursor(address string) uint {
+	for cursorAddress, cursor := range p.pollCursors {
+		if normalizeAddress(cursorAddress) == normalizeAddress(address) {
+			return cursor
+		}
+	}
+	entry, ok := p.subscriptionTable[normalizeAddress(address)]
+	if !ok {
+		return p.startBlockNumber()
+	}
+	cursor := entry.FromBlock
+	if entry.ProcessedThrough != nil && *entry.ProcessedThrough+1 > cursor {
+		cursor = *entry.ProcessedThrough + 1
+	}
+	return cursor
+}
+
+// rewindCursors moves the cursors past blockNumber back to it, after a reorg
+func (p *RpcProvider) rewindCursors(blockNumber uint) {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	for address, cursor := range p.pollCursors {
+		if cursor > blockNumber {
+			p.pollCursors[address] = blockNumber
+		}
+	}
+	for _, entry := range p.subscriptionTable {
+		if entry.ProcessedThrough == nil || *entry.ProcessedThrough < blockNumber {
+			continue
+		}
+		if blockNumber == 0 {
+			entry.ProcessedThrough = nil
+		} else {
+			processedThrough := blockNumber - 1
+			entry.ProcessedThrough = &processedThrough
+		}
+		if entry.FromBlock > blockNumber {
+			entry.FromBlock = blockNumber
+		}
+	}
+}
+
+// isSubscribed reports whether a contract is subscribed & not paused
+func (p *RpcProvider) isSubscribed(address string) bool {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	for _, subscription := range p.Subscriptions {
+		if strings.EqualFold(normalizeAddress(subscription), normalizeAddress(address)) {
+			return true
+		}
+	}
+	return false
+}
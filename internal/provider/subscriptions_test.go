@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+)
+
+// subscribedProvider returns a provider subscribed to address, as if indexing on a WebSocket
+func subscribedProvider(address string, fromBlock uint) *RpcProvider {
+	p := newRpcProvider(NewRpcEndpointPool(nil))
+	p.Subscriptions = append(p.Subscriptions, address)
+	p.trackSubscription(address, fromBlock)
+	p.subscriptionIds["0x1"] = normalizeAddress(address)
+	return p
+}
+
+func eventNotification(blockNumber uint) []byte {
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"starknet_subscriptionEvents","params":{"subscription_id":"0x1","result":{"block_number":%d}}}`, blockNumber))
+}
+
+func TestSubscriptionCursor(t *testing.T) {
+	p := subscribedProvider("0xabc", 5)
+	cursor := func() uint {
+		p.wsMutex.Lock()
+		defer p.wsMutex.Unlock()
+		return p.subscriptionCursor("0x0abc")
+	}
+	if got := cursor(); got != 5 {
+		t.Errorf("new subscription cursor = %d, want 5", got)
+	}
+
+	// Backfilled pages, then notified events
+	p.setProcessedThrough("0xabc", 9)
+	if got := cursor(); got != 10 {
+		t.Errorf("cursor after backfill = %d, want 10", got)
+	}
+	p.recordSubscriptionEvent(eventNotification(14))
+	if got := cursor(); got != 14 {
+		t.Errorf("cursor after an event of block 14 = %d, want 14", got)
+	}
+	// Cursors never move back, except for reorgs
+	p.setProcessedThrough("0xabc", 3)
+	if got := cursor(); got != 14 {
+		t.Errorf("cursor after an older block = %d, want 14", got)
+	}
+	p.rewindCursors(11)
+	if got := cursor(); got != 11 {
+		t.Errorf("cursor after a reorg from block 11 = %d, want 11", got)
+	}
+	p.rewindCursors(2)
+	if got := cursor(); got != 2 {
+		t.Errorf("cursor after a reorg before the start block = %d, want 2", got)
+	}
+}
+
+func TestInterruptedBackfillIsRequeued(t *testing.T) {
+	p := subscribedProvider("0xabc", 5)
+	job := backfillJob{address: "0xabc", fromBlock: 5, generation: p.wsGeneration}
+	if p.interrupted(job) {
+		t.Fatal("job of the current connection interrupted")
+	}
+
+	// Reconnected mid backfill, the reconnect & the job both requeue it once
+	p.wsGeneration++
+	p.setProcessedThrough("0xabc", 7)
+	p.enqueueResume("0xabc")
+	if !p.interrupted(job) {
+		t.Fatal("job of a previous connection not interrupted")
+	}
+	if len(p.backfillJobs) != 1 {
+		t.Fatalf("queued %d jobs, want 1", len(p.backfillJobs))
+	}
+	requeued, _ := p.nextBackfill()
+	if !requeued.resume || requeued.generation != p.wsGeneration {
+		t.Errorf("requeued job = %+v", requeued)
+	}
+	p.wsMutex.Lock()
+	fromBlock := p.subscriptionCursor(requeued.address)
+	p.wsMutex.Unlock()
+	if fromBlock != 8 {
+		t.Errorf("requeued job resumes from block %d, want 8", fromBlock)
+	}
+
+	// Paused contracts aren't requeued, they resume from their cursor
+	p.wsMutex.Lock()
+	_, _, err := p.removeSubscription("0xabc")
+	p.wsMutex.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.generation = p.wsGeneration
+	if !p.interrupted(job) || len(p.backfillJobs) != 0 {
+		t.Errorf("paused job not dropped, queued %d jobs", len(p.backfillJobs))
+	}
+}
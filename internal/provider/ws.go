@@ -4,43 +4,288 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"time"
 
-	"github.com/b-j-roberts/foc-engine/internal/config"
 	"github.com/gorilla/websocket"
 )
 
-func ConnectStarknetWebSocket(processStarknetEventData func([]byte)) (*websocket.Conn, error) {
-	// Connect to the WebSocket server
-	var wsURL string
-	if config.Conf.Api.Production {
-		wsURL = "wss://" + config.Conf.Rpc.Host + "/ws"
-	} else {
-		wsURL = "ws://" + config.Conf.Rpc.Host + "/ws"
+type WebSocketState string
+
+const (
+	WebSocketDisconnected WebSocketState = "disconnected"
+	WebSocketConnected    WebSocketState = "connected"
+	WebSocketReconnecting WebSocketState = "reconnecting"
+	WebSocketClosed       WebSocketState = "closed"
+	// Not using the WebSocket, see IndexerModePolling
+	WebSocketPolling WebSocketState = "polling"
+)
+
+type WebSocketStatus struct {
+	State             WebSocketState `json:"state"`
+	Url               string         `json:"url,omitempty"`
+	ConnectedAt       time.Time      `json:"connected_at"`
+	DisconnectedAt    time.Time      `json:"disconnected_at"`
+	ReconnectAttempts int            `json:"reconnect_attempts"`
+	LastError         string         `json:"last_error,omitempty"`
+	Subscriptions     []string       `json:"subscriptions"`
+	PendingBackfills  int            `json:"pending_backfills"`
+	Mode              string         `json:"mode"`
+}
+
+const (
+	// Backoff between reconnection attempts, doubled after each failed attempt
+	wsMinReconnectBackoff = 1 * time.Second
+	wsMaxReconnectBackoff = 30 * time.Second
+	// The connection is considered dropped if no pong / message is read within wsPongWait
+	wsPingInterval = 20 * time.Second
+	wsPongWait     = 60 * time.Second
+)
+
+// ConnectStarknetWebSocket connects to the healthiest endpoint with a WebSocket url,
+// failing over to the next endpoints if the connection fails
+func (p *RpcProvider) ConnectStarknetWebSocket() (*websocket.Conn, error) {
+	endpoints := p.Endpoints.RankedWs()
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no rpc endpoints with a WebSocket url")
 	}
-	u, err := url.Parse(wsURL)
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		fmt.Println("Error connecting to WebSocket:", err)
-		StarknetProvider = &Provider{
-			RpcHost:       config.Conf.Rpc.Host,
-			WebSocketConn: nil,
+	var lastErr error
+	for _, endpoint := range endpoints {
+		// Connect to the WebSocket server
+		u, err := url.Parse(endpoint.WsUrl)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+		if err != nil {
+			fmt.Println("Error connecting to WebSocket:", u.String(), err)
+			endpoint.record(0, err)
+			lastErr = err
+			continue
+		}
+
+		p.wsMutex.Lock()
+		if p.closing {
+			p.wsMutex.Unlock()
+			conn.Close()
+			return nil, fmt.Errorf("provider closed")
+		}
+		p.WebSocketConn = conn
+		p.WebSocketEndpoint = endpoint
+		p.wsState = WebSocketConnected
+		p.wsConnectedAt = time.Now().UTC()
+		p.wsReconnectAttempts = 0
+		p.wsGeneration++
+		p.resetSubscriptionIds()
+		p.wsMutex.Unlock()
+		go p.readStarknetWebSocket(conn, endpoint)
+		go p.pingStarknetWebSocket(conn)
+		fmt.Println("Connected to WebSocket server at", u.String())
+		if err := p.SubscribeNewHeads(); err != nil {
+			fmt.Println("Error subscribing to new heads:", err)
+		}
+		return conn, nil
+	}
+	return nil, lastErr
+}
+
+func (p *RpcProvider) readStarknetWebSocket(conn *websocket.Conn, endpoint *RpcEndpoint) {
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			fmt.Println("Error reading message from WebSocket:", err)
+			p.wsMutex.Lock()
+			// Closed on shutdown or replaced by another connection
+			if p.closing || p.WebSocketConn != conn {
+				p.wsMutex.Unlock()
+				return
+			}
+			p.WebSocketConn = nil
+			p.WebSocketEndpoint = nil
+			p.wsState = WebSocketDisconnected
+			p.wsDisconnectedAt = time.Now().UTC()
+			p.wsLastError = err.Error()
+			p.wsMutex.Unlock()
+			conn.Close()
+			endpoint.record(0, err)
+			p.reconnectStarknetWebSocket()
+			return
 		}
-		return nil, err
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		p.ProcessWebSocketMessage(message)
 	}
+}
 
-	go func() {
-		for {
-			_, message, err := conn.ReadMessage()
+// pingStarknetWebSocket keeps the connection alive & detects half open connections
+func (p *RpcProvider) pingStarknetWebSocket(conn *websocket.Conn) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsPingInterval))
 			if err != nil {
-				fmt.Println("Error reading message from WebSocket:", err)
+				// The read loop handles the dropped connection
 				return
 			}
-			ProcessWebSocketMessage(message, processStarknetEventData) // TODO: Refactor func param
+		case <-p.closeChan:
+			return
+		}
+	}
+}
+
+// reconnectStarknetWebSocket reconnects with backoff until connected or closed,
+// then re-issues the active subscriptions, each from its own cursor
+func (p *RpcProvider) reconnectStarknetWebSocket() {
+	backoff := wsMinReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		p.wsMutex.Lock()
+		if p.closing {
+			p.wsMutex.Unlock()
+			return
+		}
+		p.wsState = WebSocketReconnecting
+		p.wsReconnectAttempts = attempt
+		p.wsMutex.Unlock()
+
+		fmt.Println("Reconnecting WebSocket, attempt", attempt)
+		_, err := p.ConnectStarknetWebSocket()
+		if err == nil {
+			break
+		}
+		fmt.Println("Error reconnecting WebSocket:", err)
+		p.wsMutex.Lock()
+		p.wsLastError = err.Error()
+		p.wsMutex.Unlock()
+		if attempt >= wsReconnectAttemptsBeforePolling && p.indexerMode() == IndexerModeAuto {
+			fmt.Println("WebSocket unavailable, falling back to polling")
+			p.startPolling()
+			return
 		}
-	}()
-	fmt.Println("Connected to WebSocket server at", u.String())
 
-	return conn, nil
+		select {
+		case <-time.After(backoff):
+		case <-p.closeChan:
+			return
+		}
+		backoff *= 2
+		if backoff > wsMaxReconnectBackoff {
+			backoff = wsMaxReconnectBackoff
+		}
+	}
+
+	p.wsMutex.Lock()
+	subscriptions := append([]string{}, p.Subscriptions...)
+	p.wsMutex.Unlock()
+	fmt.Println("Resubscribing to", len(subscriptions), "contracts")
+	for _, address := range subscriptions {
+		// Backfills the blocks missed while disconnected before subscribing
+		p.enqueueResume(address)
+	}
+}
+
+// GetWebSocketStatus returns the state of the WebSocket connection
+func (p *RpcProvider) GetWebSocketStatus() WebSocketStatus {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	status := WebSocketStatus{
+		State:             p.wsState,
+		ConnectedAt:       p.wsConnectedAt,
+		DisconnectedAt:    p.wsDisconnectedAt,
+		ReconnectAttempts: p.wsReconnectAttempts,
+		LastError:         p.wsLastError,
+		Subscriptions:     append([]string{}, p.Subscriptions...),
+		PendingBackfills:  len(p.backfillJobs),
+		Mode:              p.indexerMode(),
+	}
+	if p.WebSocketConn != nil && p.WebSocketEndpoint != nil {
+		status.Url = p.WebSocketEndpoint.WsUrl
+	}
+	return status
+}
+
+// checkWebSocketHealth moves the WebSocket off its endpoint once it is unhealthy
+// ( ex: lagging head ) & a healthy endpoint is available
+func (p *RpcProvider) checkWebSocketHealth() {
+	p.wsMutex.Lock()
+	conn := p.WebSocketConn
+	current := p.WebSocketEndpoint
+	p.wsMutex.Unlock()
+	if conn == nil || current == nil || p.Endpoints.IsHealthy(current) {
+		return
+	}
+	endpoints := p.Endpoints.RankedWs()
+	if len(endpoints) == 0 || endpoints[0] == current || !p.Endpoints.IsHealthy(endpoints[0]) {
+		return
+	}
+	fmt.Println("WebSocket endpoint unhealthy, failing over from", current.WsUrl, "to", endpoints[0].WsUrl)
+	// The read loop fails over once the connection is closed
+	p.restartStarknetWebSocket()
+}
+
+// restartStarknetWebSocket closes the current connection, the read loop then
+// reconnects & resubscribes from the subscription cursors
+func (p *RpcProvider) restartStarknetWebSocket() {
+	p.wsMutex.Lock()
+	conn := p.WebSocketConn
+	p.wsMutex.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// writeWebSocketMessage sends a call over the current WebSocket connection
+func (p *RpcProvider) writeWebSocketMessage(call StarknetRpcCall) error {
+	// Convert the call to JSON
+	callBytes, err := json.Marshal(call)
+	if err != nil {
+		fmt.Println("Error marshalling call to JSON:", err)
+		return err
+	}
+
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.WebSocketConn == nil {
+		fmt.Println("WebSocket connection is nil")
+		return fmt.Errorf("WebSocket connection is nil")
+	}
+	err = p.WebSocketConn.WriteMessage(websocket.TextMessage, callBytes)
+	if err != nil {
+		fmt.Println("Error writing message to WebSocket:", err)
+		return err
+	}
+	fmt.Println("Message sent to WebSocket:", call)
+	return nil
+}
+
+// Notifications read but not processed yet, see enqueueNotification
+const NotificationQueueSize = 4096
+
+// enqueueNotification queues the processing of a notification, so the read loop doesn't
+// stall ( & miss its read deadline ) on block header or receipt fetches. Notifications
+// are processed in order, events are never processed across a reorg notification.
+func (p *RpcProvider) enqueueNotification(process func()) {
+	select {
+	case p.notifications <- process:
+	case <-p.closeChan:
+	}
+}
+
+// runNotifications processes the queued notifications until the provider is closed
+func (p *RpcProvider) runNotifications() {
+	defer p.workers.Done()
+	for {
+		select {
+		case process := <-p.notifications:
+			process()
+		case <-p.closeChan:
+			return
+		}
+	}
 }
 
 // TODO: Can we include more here?
@@ -50,7 +295,7 @@ type StarknetWsResponse struct {
 	Method  string `json:"method"`
 }
 
-func ProcessWebSocketMessage(message []byte, processStarknetEventData func([]byte)) {
+func (p *RpcProvider) ProcessWebSocketMessage(message []byte) {
 	var response StarknetWsResponse
 	err := json.Unmarshal(message, &response)
 	if err != nil {
@@ -59,72 +304,91 @@ func ProcessWebSocketMessage(message []byte, processStarknetEventData func([]byt
 	}
 	switch response.Method {
 	case "":
-		fmt.Println("Received empty msg:", string(message))
-	case "starknet_subscribeNewHeads":
-		// TODO
-		fmt.Println("Received new head subscription message:", string(message))
+		p.processWebSocketResponse(message)
+	case "starknet_subscriptionNewHeads", "starknet_subscribeNewHeads":
+		p.enqueueNotification(func() {
+			p.processNewHead(message)
+		})
+	case "starknet_subscriptionReorg":
+		p.enqueueNotification(func() {
+			p.processReorgNotification(message)
+		})
 	case "starknet_subscriptionEvents":
-		processStarknetEventData(message)
+		// Unsubscribed, or replaying backfilled blocks
+		if !p.recordSubscriptionEvent(message) || p.isBackfilledEvent(message) {
+			return
+		}
+		p.enqueueNotification(func() {
+			p.processEventData(message)
+		})
 	default:
 		fmt.Println("Unknown WebSocket message method:", response.Method)
 	}
 }
 
-func SubscribeNewHeads() {
-	call := StarknetRpcCall{
-		ID:      1,
-		Jsonrpc: "2.0",
-		Method:  "starknet_subscribeNewHeads",
-		Params:  map[string]interface{}{},
+// SubscribeNewHeads subscribes to new block headers, tracked in Heads
+func (p *RpcProvider) SubscribeNewHeads() error {
+	return p.sendWebSocketRequest("starknet_subscribeNewHeads", map[string]interface{}{}, pendingRequest{})
+}
+
+// SubscribeEvents backfills the past events of a contract from its start block ( see
+// contractStartBlock ), then subscribes to its new events. The subscription is re-issued
+// whenever the WebSocket reconnects or fails over to another endpoint, & tracked in the
+// subscription table.
+func (p *RpcProvider) SubscribeEvents(address string) error {
+	if !p.Indexing() {
+		return ErrNotIndexing
 	}
-	// Convert the call to JSON
-	callBytes, err := json.Marshal(call)
-	if err != nil {
-		fmt.Println("Error marshalling call to JSON:", err)
-		return
+	fromBlock := p.contractStartBlock(address)
+	p.wsMutex.Lock()
+	// Paused contracts stay paused until ResumeSubscription
+	if _, ok := p.subscriptionTable[normalizeAddress(address)]; ok {
+		p.wsMutex.Unlock()
+		return nil
 	}
-
-	err = StarknetProvider.WebSocketConn.WriteMessage(websocket.TextMessage, callBytes)
-	if err != nil {
-		fmt.Println("Error writing message to WebSocket:", err)
-		return
+	p.Subscriptions = append(p.Subscriptions, address)
+	p.trackSubscription(address, fromBlock)
+	if p.polling {
+		p.subscriptionTable[normalizeAddress(address)].Status = SubscriptionActive
+		p.pollCursors[address] = fromBlock
+		p.wsMutex.Unlock()
+		return nil
 	}
-	fmt.Println("Message sent to WebSocket:", call)
+	p.wsMutex.Unlock()
+
+	p.enqueueBackfill(address, fromBlock)
+	return nil
 }
 
-func SubscribeEvents(address string) error {
-	var startingBlockNumber int = 0
-	if config.Conf.Indexer.StartAt != nil {
-		startingBlockNumber = *config.Conf.Indexer.StartAt
-	}
-	call := StarknetRpcCall{
-		ID:      1,
-		Jsonrpc: "2.0",
-		Method:  "starknet_subscribeEvents",
-		Params: map[string]interface{}{
-			"block_id": map[string]interface{}{
-				"block_number": startingBlockNumber,
-			},
-			"from_address": address,
-		},
+// startBlockNumber returns the block new subscriptions start from, Indexer.StartAt
+func (p *RpcProvider) startBlockNumber() uint {
+	if startAt := p.options.Config.StartAt; startAt != nil && *startAt > 0 {
+		return uint(*startAt)
 	}
-	// Convert the call to JSON
-	callBytes, err := json.Marshal(call)
-	if err != nil {
-		fmt.Println("Error marshalling call to JSON:", err)
-		return err
+	return 0
+}
+
+// contractStartBlock returns the block a new subscription starts from, the persisted
+// cursor of the contract ( see IndexerOptions.ContractResumeBlock ) if past Indexer.StartAt
+func (p *RpcProvider) contractStartBlock(address string) uint {
+	startBlock := p.startBlockNumber()
+	if p.options.ContractResumeBlock != nil {
+		if blockNumber, ok := p.options.ContractResumeBlock(address); ok && blockNumber > startBlock {
+			return blockNumber
+		}
 	}
+	return startBlock
+}
 
-	if StarknetProvider.WebSocketConn == nil {
-		fmt.Println("WebSocket connection is nil")
-		return fmt.Errorf("WebSocket connection is nil")
+func (p *RpcProvider) sendSubscribeEvents(address string, blockNumber uint) error {
+	params := map[string]interface{}{
+		"block_id": map[string]interface{}{
+			"block_number": blockNumber,
+		},
+		"from_address": address,
 	}
-	err = StarknetProvider.WebSocketConn.WriteMessage(websocket.TextMessage, callBytes)
-	if err != nil {
-		fmt.Println("Error writing message to WebSocket:", err)
-		return err
+	if p.options.Config.FinalityStatus != "" {
+		params["finality_status"] = p.options.Config.FinalityStatus
 	}
-	fmt.Println("Message sent to WebSocket:", call)
-
-	return nil
+	return p.sendWebSocketRequest("starknet_subscribeEvents", params, pendingRequest{address: address})
 }
@@ -0,0 +1,230 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/starknet.go/utils"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+var (
+	ErrFunctionNotFound = errors.New("function not found")
+	// Only view functions can be called, external functions need a transaction
+	ErrFunctionNotView = errors.New("function isn't a view")
+)
+
+type AbiParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type AbiFunction struct {
+	Name            string     `json:"name"`
+	Inputs          []AbiParam `json:"inputs"`
+	Outputs         []string   `json:"outputs"`
+	StateMutability string     `json:"state_mutability"`
+}
+
+// GetFunctions returns the functions of the abi, declared at the top level or in interfaces
+func (t *TypeIndex) GetFunctions() []*AbiFunction {
+	functions := []*AbiFunction{}
+	var addFunctions func(entries []interface{})
+	addFunctions = func(entries []interface{}) {
+		for _, abiEntry := range entries {
+			entry, ok := abiEntry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch entry["type"] {
+			case "interface":
+				items, _ := entry["items"].([]interface{})
+				addFunctions(items)
+			case "function":
+				functions = append(functions, parseAbiFunction(entry))
+			}
+		}
+	}
+	addFunctions(t.Abi)
+	return functions
+}
+
+func parseAbiFunction(entry map[string]interface{}) *AbiFunction {
+	function := &AbiFunction{
+		Inputs:  []AbiParam{},
+		Outputs: []string{},
+	}
+	function.Name, _ = entry["name"].(string)
+	function.StateMutability, _ = entry["state_mutability"].(string)
+	inputs, _ := entry["inputs"].([]interface{})
+	for _, input := range inputs {
+		inputEntry, ok := input.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := inputEntry["name"].(string)
+		typeName, _ := inputEntry["type"].(string)
+		function.Inputs = append(function.Inputs, AbiParam{Name: name, Type: typeName})
+	}
+	outputs, _ := entry["outputs"].([]interface{})
+	for _, output := range outputs {
+		outputEntry, ok := output.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		typeName, _ := outputEntry["type"].(string)
+		function.Outputs = append(function.Outputs, typeName)
+	}
+	return function
+}
+
+func (t *TypeIndex) GetFunction(name string) (*AbiFunction, error) {
+	for _, function := range t.GetFunctions() {
+		if function.Name == name {
+			return function, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrFunctionNotFound, name)
+}
+
+// EncodeFunctionArgs encodes the calldata of a function call from its named json
+// arguments, see EncodeType for the value shapes
+func (t *TypeIndex) EncodeFunctionArgs(function *AbiFunction, args json.RawMessage) ([]string, error) {
+	namedArgs := map[string]interface{}{}
+	if len(bytes.TrimSpace(args)) > 0 {
+		// Numbers are kept as json.Number, felts don't fit in a float64
+		decoder := json.NewDecoder(bytes.NewReader(args))
+		decoder.UseNumber()
+		if err := decoder.Decode(&namedArgs); err != nil {
+			return nil, fmt.Errorf("%w: arguments must be an object: %v", ErrInvalidValue, err)
+		}
+	}
+	calldata := []string{}
+	for _, input := range function.Inputs {
+		value, ok := namedArgs[input.Name]
+		if !ok {
+			return nil, newEncodeError(input.Name, input.Type, ErrMissingValue)
+		}
+		felts, err := t.encodeType(input.Name, input.Type, value)
+		if err != nil {
+			return nil, err
+		}
+		calldata = append(calldata, felts...)
+	}
+	for name := range namedArgs {
+		found := false
+		for _, input := range function.Inputs {
+			if input.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: unknown argument %s of %s", ErrInvalidValue, name, function.Name)
+		}
+	}
+	return calldata, nil
+}
+
+// DecodeFunctionResult decodes the returned felts of a function call, as a single
+// value for functions with one output ( all Cairo 1 functions ), as a list otherwise
+func (t *TypeIndex) DecodeFunctionResult(function *AbiFunction, result []string) (interface{}, error) {
+	values := []interface{}{}
+	for _, output := range function.Outputs {
+		value, offset, err := t.decodeType("", output, result)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		result = result[offset:]
+	}
+	if len(result) > 0 {
+		return nil, newDecodeError(function.Name, function.Name, result, ErrUnconsumedFelts)
+	}
+	switch len(values) {
+	case 0:
+		return nil, nil
+	case 1:
+		return values[0], nil
+	}
+	return values, nil
+}
+
+// FunctionCall is a read-only call of a registered contract's function
+type FunctionCall struct {
+	ContractAddress string          `json:"contractAddress"`
+	Function        string          `json:"function"`
+	Args            json.RawMessage `json:"args,omitempty"`
+}
+
+type FunctionCallResult struct {
+	Result interface{} `json:"result"`
+	// Returned felts, kept when the result can't be decoded
+	Raw   []string `json:"raw,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// CallFunctions encodes the calls' arguments with their contract abi, runs them with
+// starknet_call ( batched ) at blockNumber ( latest if nil ) & decodes their results.
+// Returns an error if the rpc request failed, errors of each call are set on its result.
+func (r *Registry) CallFunctions(ctx context.Context, calls []FunctionCall, blockNumber *uint) ([]FunctionCallResult, error) {
+	results := make([]FunctionCallResult, len(calls))
+	functions := make([]*AbiFunction, len(calls))
+	decoders := make([]*ContractDecoder, len(calls))
+	contractCalls := []*provider.ContractCall{}
+	// Map: index in calls -> index in contractCalls
+	callIndexes := make(map[int]int)
+	for i, call := range calls {
+		registeredContract, ok := r.GetRegisteredContract(call.ContractAddress)
+		if !ok || registeredContract.Decoder == nil {
+			results[i].Error = fmt.Sprintf("contract not registered: %s", call.ContractAddress)
+			continue
+		}
+		function, err := registeredContract.Decoder.GetFunction(call.Function)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if function.StateMutability != "view" {
+			results[i].Error = fmt.Errorf("%w: %s", ErrFunctionNotView, function.Name).Error()
+			continue
+		}
+		calldata, err := registeredContract.Decoder.EncodeFunctionArgs(function, call.Args)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		functions[i] = function
+		decoders[i] = registeredContract.Decoder
+		callIndexes[i] = len(contractCalls)
+		contractCalls = append(contractCalls, &provider.ContractCall{
+			ContractAddress:    call.ContractAddress,
+			EntryPointSelector: utils.GetSelectorFromNameFelt(function.Name).String(),
+			Calldata:           calldata,
+		})
+	}
+	if len(contractCalls) == 0 {
+		return results, nil
+	}
+	if err := r.provider.CallContracts(ctx, contractCalls, provider.BlockId(blockNumber)); err != nil {
+		return nil, err
+	}
+	for i, contractCallIndex := range callIndexes {
+		contractCall := contractCalls[contractCallIndex]
+		if contractCall.Err != nil {
+			results[i].Error = contractCall.Err.Error()
+			continue
+		}
+		value, err := decoders[i].DecodeFunctionResult(functions[i], contractCall.Result)
+		if err != nil {
+			results[i].Raw = contractCall.Result
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Result = value
+	}
+	return results, nil
+}
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongodriver "go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// StoredClass is a contract class persisted in the class store, keyed by class hash
+type StoredClass struct {
+	ClassHash string `json:"class_hash" bson:"_id"`
+	// Json encoded abi, kept as a string so abi entry names aren't used as document keys
+	Abi       string    `json:"abi" bson:"abi"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+type cachedClass struct {
+	ContractClass *provider.ContractClass
+	Decoder       *ContractDecoder
+}
+
+// classLoad is a class being loaded, shared by the concurrent lookups of its class hash
+type classLoad struct {
+	done  chan struct{}
+	class *cachedClass
+	err   error
+}
+
+// ClassStore fetches each contract class once from the rpc & persists it, in Mongo
+// when connected or on disk otherwise, so classes are shared across restarts &
+// across contracts deployed from the same class
+type ClassStore struct {
+	mutex sync.Mutex
+	// Map: Normalized class hash -> class & its compiled decoder
+	classes map[string]*cachedClass
+	// Map: Normalized class hash -> load in progress
+	loading map[string]*classLoad
+	// Directory used when Mongo isn't connected, see classDir
+	dir string
+	// Node access the classes are fetched from
+	provider provider.Provider
+}
+
+// classDir returns the directory of the stored classes : CLASS_STORE_DIR, the store's
+// dir ( ex: Indexer.ClassStoreDir ) or the user cache dir ( ex: ~/.cache/foc-engine/class_store )
+func (s *ClassStore) classDir() string {
+	if dir := os.Getenv("CLASS_STORE_DIR"); dir != "" {
+		return dir
+	}
+	if s.dir != "" {
+		return s.dir
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "foc-engine", "class_store")
+}
+
+// NewClassStore creates a store of the classes fetched from p, provider.Default() if nil
+func NewClassStore(dir string, p provider.Provider) *ClassStore {
+	if p == nil {
+		p = provider.Default()
+	}
+	return &ClassStore{
+		classes:  make(map[string]*cachedClass),
+		loading:  make(map[string]*classLoad),
+		dir:      dir,
+		provider: p,
+	}
+}
+
+// GetClass returns the contract class & decoder for a class hash, loading it
+// from the store or the rpc if it isn't cached yet. The lock isn't held while
+// loading, concurrent lookups of the same class wait for a single load.
+func (s *ClassStore) GetClass(classHash string) (*provider.ContractClass, *ContractDecoder, error) {
+	classHash = NormalizeFelt(classHash)
+	s.mutex.Lock()
+	if class, ok := s.classes[classHash]; ok {
+		s.mutex.Unlock()
+		return class.ContractClass, class.Decoder, nil
+	}
+	load, loading := s.loading[classHash]
+	if !loading {
+		load = &classLoad{done: make(chan struct{})}
+		s.loading[classHash] = load
+	}
+	s.mutex.Unlock()
+
+	if !loading {
+		load.class, load.err = s.loadClass(classHash)
+		s.mutex.Lock()
+		if load.err == nil {
+			s.classes[classHash] = load.class
+		}
+		delete(s.loading, classHash)
+		s.mutex.Unlock()
+		close(load.done)
+	}
+	<-load.done
+	if load.err != nil {
+		return nil, nil, load.err
+	}
+	return load.class.ContractClass, load.class.Decoder, nil
+}
+
+// loadClass loads a class from the store, or from the rpc & stores it
+func (s *ClassStore) loadClass(classHash string) (*cachedClass, error) {
+	contractClass, err := s.load(classHash)
+	if err != nil {
+		fmt.Println("Error loading stored class:", classHash, err)
+	}
+	if contractClass == nil {
+		contractClass, err = s.provider.Class(context.Background(), classHash)
+		if err != nil {
+			return nil, fmt.Errorf("error getting class %s: %w", classHash, err)
+		}
+		if err := s.save(classHash, contractClass); err != nil {
+			// Still usable, it will be refetched on the next restart
+			fmt.Println("Error storing class:", classHash, err)
+		}
+	}
+	return &cachedClass{
+		ContractClass: contractClass,
+		Decoder:       NewContractDecoder(contractClass.Abi),
+	}, nil
+}
+
+// GetClassAt returns the class hash, class & decoder of the contract at address
+func (s *ClassStore) GetClassAt(address string) (string, *provider.ContractClass, *ContractDecoder, error) {
+	classHash, err := s.provider.ClassHashAt(context.Background(), address)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error getting class hash: %w", err)
+	}
+	contractClass, decoder, err := s.GetClass(classHash)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return NormalizeFelt(classHash), contractClass, decoder, nil
+}
+
+// load returns the stored class, or nil if it isn't stored
+func (s *ClassStore) load(classHash string) (*provider.ContractClass, error) {
+	var storedClass StoredClass
+	if mongo.Mongo != nil {
+		err := mongo.GetFocEngineClassesCollection().FindOne(context.TODO(), bson.M{
+			"_id": classHash,
+		}).Decode(&storedClass)
+		if errors.Is(err, mongodriver.ErrNoDocuments) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		classJson, err := os.ReadFile(s.classPath(classHash))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(classJson, &storedClass); err != nil {
+			return nil, err
+		}
+	}
+	abi, err := provider.ParseAbi([]byte(storedClass.Abi))
+	if err != nil {
+		return nil, err
+	}
+	return &provider.ContractClass{
+		Abi: abi,
+	}, nil
+}
+
+func (s *ClassStore) save(classHash string, contractClass *provider.ContractClass) error {
+	abiJson, err := json.Marshal(contractClass.Abi)
+	if err != nil {
+		return err
+	}
+	storedClass := StoredClass{
+		ClassHash: classHash,
+		Abi:       string(abiJson),
+		CreatedAt: time.Now().UTC(),
+	}
+	if mongo.Mongo != nil {
+		_, err := mongo.GetFocEngineClassesCollection().InsertOne(context.TODO(), storedClass)
+		if mongodriver.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return err
+	}
+	classJson, err := json.Marshal(storedClass)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.classDir(), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.classPath(classHash), classJson, 0644)
+}
+
+func (s *ClassStore) classPath(classHash string) string {
+	return filepath.Join(s.classDir(), classHash+".json")
+}
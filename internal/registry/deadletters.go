@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Collections a dead letter is retried into
+const (
+	DeadLetterRegistry = "registry"
+	DeadLetterEvents   = "events"
+)
+
+// DeadLetter is a raw event that failed to decode, kept for retrying after an abi fix
+type DeadLetter struct {
+	Id              bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	Collection      string        `json:"collection" bson:"collection"`
+	ContractAddress string        `json:"contract_address" bson:"contract_address"`
+	Event           StarknetEvent `json:"event" bson:"event"`
+	Error           string        `json:"error" bson:"error"`
+	DecodeError     *DecodeError  `json:"decode_error,omitempty" bson:"decode_error,omitempty"`
+	Retries         int           `json:"retries" bson:"retries"`
+	CreatedAt       time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+type RetryDeadLettersResult struct {
+	Retried   int      `json:"retried"`
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors"`
+}
+
+// InsertDeadLetter stores an event which failed to decode into foc_engine.dead_letters
+func (r *Registry) InsertDeadLetter(collection string, event StarknetEvent, decodeErr error) {
+	now := time.Now().UTC()
+	deadLetter := DeadLetter{
+		Collection:      collection,
+		ContractAddress: event.FromAddress,
+		Event:           event,
+		Error:           decodeErr.Error(),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	var typedErr *DecodeError
+	if errors.As(decodeErr, &typedErr) {
+		deadLetter.DecodeError = typedErr
+	}
+	store := r.EventStore()
+	if store == nil {
+		fmt.Println("Error inserting dead letter:", ErrNoEventStore)
+		return
+	}
+	err := store.InsertDeadLetter(context.TODO(), deadLetter)
+	if err != nil {
+		fmt.Println("Error inserting dead letter into MongoDB:", err)
+	}
+}
+
+// GetDeadLetters returns a page of dead letters matching filter, newest first
+func GetDeadLetters(ctx context.Context, filter bson.M, page int, limit int) ([]DeadLetter, error) {
+	skip := (page - 1) * limit
+	findOptions := options.Find().SetSort(bson.M{
+		"_id": -1,
+	}).SetLimit(int64(limit)).SetSkip(int64(skip))
+	res, err := mongo.GetFocEngineDeadLettersCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close(ctx)
+
+	deadLetters := make([]DeadLetter, 0)
+	if err := res.All(ctx, &deadLetters); err != nil {
+		return nil, err
+	}
+	return deadLetters, nil
+}
+
+// RetryDeadLetters re-decodes the dead letters matching filter with the currently loaded abis.
+// Decoded events are moved into their collection, failures are kept with the new error.
+func (r *Registry) RetryDeadLetters(ctx context.Context, filter bson.M) (*RetryDeadLettersResult, error) {
+	res, err := mongo.GetFocEngineDeadLettersCollection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var deadLetters []DeadLetter
+	if err := res.All(ctx, &deadLetters); err != nil {
+		return nil, err
+	}
+
+	result := &RetryDeadLettersResult{
+		Errors: make([]string, 0),
+	}
+	for _, deadLetter := range deadLetters {
+		result.Retried++
+		err := r.retryDeadLetter(ctx, deadLetter)
+		if err == nil {
+			result.Succeeded++
+			continue
+		}
+		result.Failed++
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", deadLetter.Id.Hex(), err))
+
+		update := bson.M{
+			"error":        err.Error(),
+			"retries":      deadLetter.Retries + 1,
+			"updated_at":   time.Now().UTC(),
+			"decode_error": nil,
+		}
+		var typedErr *DecodeError
+		if errors.As(err, &typedErr) {
+			update["decode_error"] = typedErr
+		}
+		_, updateErr := mongo.GetFocEngineDeadLettersCollection().UpdateByID(ctx, deadLetter.Id, bson.M{
+			"$set": update,
+		})
+		if updateErr != nil {
+			fmt.Println("Error updating dead letter:", updateErr)
+		}
+	}
+	return result, nil
+}
+
+func (r *Registry) retryDeadLetter(ctx context.Context, deadLetter DeadLetter) error {
+	var typeNameJson map[string]interface{}
+	var err error
+	switch deadLetter.Collection {
+	case DeadLetterRegistry:
+		typeNameJson, err = r.DecodeRegistryEvent(deadLetter.Event)
+	case DeadLetterEvents:
+		typeNameJson, err = r.DecodeRegisteredContractEvent(deadLetter.Event)
+	default:
+		return fmt.Errorf("unknown dead letter collection: %s", deadLetter.Collection)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.EnrichEventDocument(ctx, typeNameJson, deadLetter.Event)
+	err = r.UpsertEventDocument(ctx, deadLetter.Collection, typeNameJson)
+	if err != nil {
+		return err
+	}
+	_, err = mongo.GetFocEngineDeadLettersCollection().DeleteOne(ctx, bson.M{
+		"_id": deadLetter.Id,
+	})
+	return err
+}
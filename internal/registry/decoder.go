@@ -0,0 +1,575 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NethermindEth/starknet.go/contracts"
+	"github.com/NethermindEth/starknet.go/utils"
+)
+
+// TypeIndex maps abi type names to their definitions, so decoding doesn't need
+// to scan the abi for every struct / enum it encounters
+type TypeIndex struct {
+	Abi []interface{}
+	// Map: TypeName -> abi entry ( full type paths & their "::" suffixes )
+	Types map[string]map[string]interface{}
+}
+
+func NewTypeIndex(abi []interface{}) *TypeIndex {
+	index := &TypeIndex{
+		Abi:   abi,
+		Types: make(map[string]map[string]interface{}),
+	}
+	// Full type paths take precedence over suffixes of other type paths
+	for _, abiEntry := range abi {
+		entry, ok := abiEntry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, ok := entry["name"].(string)
+		if !ok {
+			continue
+		}
+		if _, ok := index.Types[name]; !ok {
+			index.Types[name] = entry
+		}
+	}
+	// Allow lookups by a "::"-separated suffix of the type path
+	// Example: "pow_game::actions::BlockMined" -> "actions::BlockMined", "BlockMined"
+	for _, abiEntry := range abi {
+		entry, ok := abiEntry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, ok := entry["name"].(string)
+		if !ok {
+			continue
+		}
+		for suffix := name; strings.Contains(suffix, "::"); {
+			suffix = suffix[strings.Index(suffix, "::")+2:]
+			if _, ok := index.Types[suffix]; !ok {
+				index.Types[suffix] = entry
+			}
+		}
+	}
+	return index
+}
+
+// Lookup returns the abi entry defining typeName, or nil if it isn't in the abi
+func (t *TypeIndex) Lookup(typeName string) map[string]interface{} {
+	return t.Types[typeName]
+}
+
+type EventMember struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+}
+
+type EventDefinition struct {
+	TypeName string `json:"type_name"`
+	// Selectors emitted as the leading event keys, one per nested ( non-flat ) enum level
+	Selectors []string      `json:"selectors"`
+	Members   []EventMember `json:"members"`
+}
+
+type eventSelectorNode struct {
+	Event *EventDefinition
+	// Set for nested ( non-flat ) component event enums, resolved on the next key
+	Nested map[string]*eventSelectorNode
+}
+
+// ContractDecoder is compiled once per registered contract abi, so incoming
+// events are resolved by selector lookup instead of walking & hashing the abi
+type ContractDecoder struct {
+	*TypeIndex
+	// Map: Normalized selector -> event / nested event enum
+	Selectors map[string]*eventSelectorNode
+	Events    []*EventDefinition
+}
+
+// Max depth of nested component event enums to follow
+const maxEventEnumDepth = 16
+
+func NewContractDecoder(abi []interface{}) *ContractDecoder {
+	decoder := &ContractDecoder{
+		TypeIndex: NewTypeIndex(abi),
+		Selectors: make(map[string]*eventSelectorNode),
+		Events:    []*EventDefinition{},
+	}
+	eventEnums := getEventEnums(abi)
+	for _, root := range getRootEventEnums(eventEnums) {
+		decoder.compileEventEnum(eventEnums, root, decoder.Selectors, []string{}, 0)
+	}
+	return decoder
+}
+
+// compileEventEnum adds the variants of an event enum to the selector tree :
+//   - nested variants use the selector of the variant name as the next key, and
+//     if their type is itself an event enum ( non-flat component ), its variants
+//     are resolved on the following key
+//   - flat variants ( #[flat] components ) emit no selector of their own, so the
+//     inner enum's variants are added at the same level
+//
+// Example abi event enum:
+/*
+   map[kind:enum name:pow_game::pow::PowGame::Event type:event variants:[map[kind:nested name:ChainUnlocked type:pow_game::pow::PowGame::ChainUnlocked] map[kind:nested name:BalanceUpdated type:pow_game::pow::PowGame::BalanceUpdated] map[kind:nested name:TransactionAdded type:pow_game::actions::TransactionAdded] map[kind:nested name:BlockMined type:pow_game::actions::BlockMined] map[kind:nested name:DAStored type:pow_game::actions::DAStored] map[kind:nested name:ProofStored type:pow_game::actions::ProofStored] map[kind:flat name:UpgradeEvent type:pow_game::upgrades::component::PowUpgradesComponent::Event] map[kind:flat name:TransactionEvent type:pow_game::transactions::component::PowTransactionsComponent::Event] map[kind:flat name:PrestigeEvent type:pow_game::prestige::component::PrestigeComponent::Event] map[kind:flat name:BuilderEvent type:pow_game::builder::component::BuilderComponent::Event]]]
+*/
+func (d *ContractDecoder) compileEventEnum(eventEnums map[string]map[string]interface{}, enumName string, nodes map[string]*eventSelectorNode, selectors []string, depth int) {
+	if depth > maxEventEnumDepth {
+		return
+	}
+	for _, variant := range getEventVariants(eventEnums[enumName]) {
+		_, isEnum := eventEnums[variant.Type]
+		if variant.Kind == "flat" {
+			if isEnum {
+				d.compileEventEnum(eventEnums, variant.Type, nodes, selectors, depth+1)
+			}
+			continue
+		}
+
+		selector := NormalizeFelt(utils.GetSelectorFromNameFelt(variant.Name).String())
+		variantSelectors := append(append([]string{}, selectors...), selector)
+		if isEnum {
+			node, ok := nodes[selector]
+			if !ok {
+				node = &eventSelectorNode{Nested: make(map[string]*eventSelectorNode)}
+				nodes[selector] = node
+			}
+			if node.Nested != nil {
+				d.compileEventEnum(eventEnums, variant.Type, node.Nested, variantSelectors, depth+1)
+			}
+			continue
+		}
+		// First declared variant wins on selector collisions
+		if _, ok := nodes[selector]; ok {
+			continue
+		}
+		event := &EventDefinition{
+			TypeName:  variant.Type,
+			Selectors: variantSelectors,
+			Members:   d.getEventMembers(variant.Type),
+		}
+		nodes[selector] = &eventSelectorNode{Event: event}
+		d.Events = append(d.Events, event)
+	}
+}
+
+func (d *ContractDecoder) getEventMembers(typeName string) []EventMember {
+	eventMembers := []EventMember{}
+	abi := d.Lookup(typeName)
+	if abi == nil {
+		return eventMembers
+	}
+	members, ok := abi["members"].([]interface{})
+	if !ok {
+		return eventMembers
+	}
+	for _, member := range members {
+		memberEntry, ok := member.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		memberName, _ := memberEntry["name"].(string)
+		memberType, _ := memberEntry["type"].(string)
+		memberKind, _ := memberEntry["kind"].(string)
+		eventMembers = append(eventMembers, EventMember{
+			Name: memberName,
+			Type: memberType,
+			Kind: memberKind,
+		})
+	}
+	return eventMembers
+}
+
+// ResolveEvent finds the event definition for an event's keys
+// Returns the event & the number of leading keys which were selectors
+func (d *ContractDecoder) ResolveEvent(keys []string) (*EventDefinition, int, error) {
+	if len(keys) == 0 {
+		return nil, 0, fmt.Errorf("event has no keys")
+	}
+	nodes := d.Selectors
+	for i, key := range keys {
+		node, ok := nodes[NormalizeFelt(key)]
+		if !ok {
+			break
+		}
+		if node.Event != nil {
+			return node.Event, i + 1, nil
+		}
+		nodes = node.Nested
+	}
+	return nil, 0, fmt.Errorf("%w: selector %s", ErrEventNotFound, keys[0])
+}
+
+// GetEvent returns the definition of an event by its type name
+func (d *ContractDecoder) GetEvent(typeName string) *EventDefinition {
+	for _, event := range d.Events {
+		if event.TypeName == typeName {
+			return event
+		}
+	}
+	return nil
+}
+
+// getEventEnums returns all abi event entries of kind enum, keyed by type name
+func getEventEnums(abi []interface{}) map[string]map[string]interface{} {
+	eventEnums := make(map[string]map[string]interface{})
+	for _, abiEntry := range abi {
+		checkABI, ok := abiEntry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if checkABI["type"] != string(contracts.ABITypeEvent) || checkABI["kind"] != "enum" {
+			continue
+		}
+		name, ok := checkABI["name"].(string)
+		if !ok {
+			continue
+		}
+		eventEnums[name] = checkABI
+	}
+	return eventEnums
+}
+
+// getRootEventEnums returns the event enums not used as a variant of another event
+// enum, ie. the contract's own "::Event" enum rather than its components'
+func getRootEventEnums(eventEnums map[string]map[string]interface{}) []string {
+	referenced := make(map[string]bool)
+	for _, eventEnum := range eventEnums {
+		for _, variant := range getEventVariants(eventEnum) {
+			referenced[variant.Type] = true
+		}
+	}
+	roots := []string{}
+	for name := range eventEnums {
+		if !referenced[name] {
+			roots = append(roots, name)
+		}
+	}
+	if len(roots) == 0 {
+		for name := range eventEnums {
+			roots = append(roots, name)
+		}
+	}
+	// Deterministic resolution order
+	sort.Strings(roots)
+	return roots
+}
+
+type EventVariant struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+}
+
+func getEventVariants(eventEnum map[string]interface{}) []EventVariant {
+	variants := []EventVariant{}
+	abiVariants, ok := eventEnum["variants"].([]interface{})
+	if !ok {
+		return variants
+	}
+	for _, variant := range abiVariants {
+		variantEntry, ok := variant.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		variantName, ok := variantEntry["name"].(string)
+		if !ok {
+			continue
+		}
+		variantType, ok := variantEntry["type"].(string)
+		if !ok {
+			continue
+		}
+		variantKind, _ := variantEntry["kind"].(string)
+		variants = append(variants, EventVariant{
+			Name: variantName,
+			Type: variantType,
+			Kind: variantKind,
+		})
+	}
+	return variants
+}
+
+// NormalizeFelt formats a felt hex string without leading zeros, in lower case
+// Example: "0x00AB" -> "0xab"
+func NormalizeFelt(felt string) string {
+	felt = strings.ToLower(felt)
+	felt = strings.TrimPrefix(felt, "0x")
+	felt = strings.TrimLeft(felt, "0")
+	if felt == "" {
+		return "0x0"
+	}
+	return "0x" + felt
+}
+
+// DecodeEvent decodes an event struct's members, reading "key" members from the
+// event keys ( after the selectors ) & "data" members from the event data
+// Returns the decoded fields & the names of the fields decoded from keys
+func (t *TypeIndex) DecodeEvent(typeName string, keys []string, data []string) (map[string]interface{}, []string, error) {
+	fields := map[string]interface{}{}
+	keyFields := []string{}
+	abi := t.Lookup(typeName)
+	if abi == nil {
+		return nil, nil, newDecodeError(typeName, typeName, data, ErrUnknownType)
+	}
+	members, ok := abi["members"].([]interface{})
+	if !ok {
+		return nil, nil, newDecodeError(typeName, typeName, data, ErrInvalidAbi)
+	}
+	if !hasMemberKinds(members) {
+		// No key / data split in the abi, decode members in declaration order
+		data = append(append([]string{}, keys...), data...)
+		keys = []string{}
+	}
+	for _, member := range members {
+		memberEntry, ok := member.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		memberName, _ := memberEntry["name"].(string)
+		memberType, _ := memberEntry["type"].(string)
+		memberKind, _ := memberEntry["kind"].(string)
+		if memberKind == "key" {
+			value, offset, err := t.decodeType(memberName, memberType, keys)
+			if err != nil {
+				return nil, nil, err
+			}
+			fields[memberName] = value
+			keys = keys[offset:]
+			keyFields = append(keyFields, memberName)
+		} else {
+			value, offset, err := t.decodeType(memberName, memberType, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			fields[memberName] = value
+			data = data[offset:]
+		}
+	}
+	if len(keys) > 0 {
+		return nil, nil, newDecodeError(typeName, typeName, keys, ErrUnconsumedFelts)
+	}
+	if len(data) > 0 {
+		return nil, nil, newDecodeError(typeName, typeName, data, ErrUnconsumedFelts)
+	}
+	return fields, keyFields, nil
+}
+
+func hasMemberKinds(members []interface{}) bool {
+	for _, member := range members {
+		memberEntry, ok := member.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := memberEntry["kind"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeType decodes a value of typeName from the start of data
+// Returns the decoded value and the number of felts consumed
+func (t *TypeIndex) DecodeType(typeName string, data []string) (interface{}, int, error) {
+	return t.decodeType("", typeName, data)
+}
+
+// decodeType decodes a value of typeName, with path locating the value within
+// the outer type for error reporting ( ex: "position.x", "moves[2]" )
+func (t *TypeIndex) decodeType(path string, typeName string, data []string) (interface{}, int, error) {
+	if IsPrimitiveType(typeName) {
+		if parser, ok := StarknetMultiFeltParsers[typeName]; ok {
+			value, offset, err := parser(typeName, data)
+			if err != nil {
+				return nil, 0, newDecodeError(path, typeName, data, err)
+			}
+			return value, offset, nil
+		}
+		if len(data) == 0 {
+			return nil, 0, newDecodeError(path, typeName, data, ErrNotEnoughFelts)
+		}
+		value, err := StarknetStringToTypedData(typeName, data[0])
+		if err != nil {
+			return nil, 0, newDecodeError(path, typeName, data[:1], err)
+		}
+		return value, 1, nil
+	} else if IsArrayType(typeName) {
+		if len(data) == 0 {
+			return nil, 0, newDecodeError(path, typeName, data, ErrNotEnoughFelts)
+		}
+		arrayType := GetArrayInnerType(typeName)
+		arrayLen, err := strconv.ParseUint(data[0], 0, 32)
+		if err != nil {
+			return nil, 0, newDecodeError(path, typeName, data[:1], fmt.Errorf("invalid array length: %v", err))
+		}
+		data = data[1:]
+		arrayData, offset, err := t.decodeArrayElements(path, typeName, arrayType, int(arrayLen), data)
+		if err != nil {
+			return nil, 0, err
+		}
+		return arrayData, 1 + offset, nil
+	} else if IsTupleType(typeName) {
+		tupleTypes := GetTupleInnerTypes(typeName)
+		tupleData := make([]interface{}, 0, len(tupleTypes))
+		totalOffset := 0
+		for i, tupleType := range tupleTypes {
+			value, offset, err := t.decodeType(joinDecodePath(path, strconv.Itoa(i)), tupleType, data)
+			if err != nil {
+				return nil, 0, err
+			}
+			tupleData = append(tupleData, value)
+			data = data[offset:]
+			totalOffset += offset
+		}
+		return tupleData, totalOffset, nil
+	} else if IsFixedArrayType(typeName) {
+		// Fixed size arrays are serialized without a length prefix
+		arrayType, arrayLen, err := GetFixedArrayInfo(typeName)
+		if err != nil {
+			return nil, 0, newDecodeError(path, typeName, data, err)
+		}
+		return t.decodeArrayElements(path, typeName, arrayType, arrayLen, data)
+	} else if t.IsEnumType(typeName) {
+		if len(data) == 0 {
+			return nil, 0, newDecodeError(path, typeName, data, ErrNotEnoughFelts)
+		}
+		variantIndex, err := strconv.ParseUint(data[0], 0, 32)
+		if err != nil {
+			return nil, 0, newDecodeError(path, typeName, data[:1], fmt.Errorf("invalid enum variant index: %v", err))
+		}
+		variants := t.GetEnumVariants(typeName)
+		if int(variantIndex) >= len(variants) {
+			return nil, 0, newDecodeError(path, typeName, data[:1], fmt.Errorf("%w: %d of %d", ErrInvalidVariant, variantIndex, len(variants)))
+		}
+		data = data[1:]
+		variant := variants[variantIndex]
+		if IsUnitType(variant.Type) {
+			return map[string]interface{}{
+				"variant": variant.Name,
+				"value":   nil,
+			}, 1, nil
+		}
+		value, offset, err := t.decodeType(joinDecodePath(path, variant.Name), variant.Type, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		return map[string]interface{}{
+			"variant": variant.Name,
+			"value":   value,
+		}, 1 + offset, nil
+	} else if IsStructType(typeName) {
+		abi := t.Lookup(typeName)
+		if abi == nil {
+			return nil, 0, newDecodeError(path, typeName, data, ErrUnknownType)
+		}
+		members, ok := abi["members"].([]interface{})
+		if !ok {
+			return nil, 0, newDecodeError(path, typeName, data, ErrInvalidAbi)
+		}
+		fields := map[string]interface{}{}
+		totalOffset := 0
+		for _, member := range members {
+			memberEntry, ok := member.(map[string]interface{})
+			if !ok {
+				return nil, 0, newDecodeError(path, typeName, data, ErrInvalidAbi)
+			}
+			memberName, _ := memberEntry["name"].(string)
+			memberType, _ := memberEntry["type"].(string)
+			value, offset, err := t.decodeType(joinDecodePath(path, memberName), memberType, data)
+			if err != nil {
+				return nil, 0, err
+			}
+			fields[memberName] = value
+			data = data[offset:]
+			totalOffset += offset
+		}
+		return fields, totalOffset, nil
+	}
+	return nil, 0, newDecodeError(path, typeName, data, ErrUnknownType)
+}
+
+// decodeArrayElements decodes arrayLen values of arrayType from the start of data
+// Elements must take at least a felt, which bounds the allocation & loop on bogus
+// lengths ( from the data or a malformed abi )
+func (t *TypeIndex) decodeArrayElements(path string, typeName string, arrayType string, arrayLen int, data []string) ([]interface{}, int, error) {
+	if arrayLen > len(data) {
+		return nil, 0, newDecodeError(path, typeName, data, fmt.Errorf("%w: array length %d with %d felts left", ErrNotEnoughFelts, arrayLen, len(data)))
+	}
+	arrayData := make([]interface{}, 0, arrayLen)
+	totalOffset := 0
+	for i := 0; i < arrayLen; i++ {
+		elementPath := fmt.Sprintf("%s[%d]", path, i)
+		value, offset, err := t.decodeType(elementPath, arrayType, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if offset == 0 {
+			return nil, 0, newDecodeError(elementPath, arrayType, data, fmt.Errorf("%w: zero sized array element", ErrInvalidAbi))
+		}
+		arrayData = append(arrayData, value)
+		data = data[offset:]
+		totalOffset += offset
+	}
+	return arrayData, totalOffset, nil
+}
+
+func (t *TypeIndex) IsEnumType(typeName string) bool {
+	if IsPrimitiveType(typeName) || IsArrayType(typeName) || IsTupleType(typeName) || IsFixedArrayType(typeName) {
+		return false
+	}
+	if abi := t.Lookup(typeName); abi != nil {
+		return abi["type"] == "enum"
+	}
+	return IsCoreEnumType(typeName)
+}
+
+// GetEnumVariants returns the variants of an enum in declaration order, which is
+// also the order of the variant index used in its serialization.
+// Core enums ( Option / Result ) are not always listed in the abi, so those fall
+// back to their well known variants.
+func (t *TypeIndex) GetEnumVariants(typeName string) []EnumVariant {
+	variants := []EnumVariant{}
+	if abi := t.Lookup(typeName); abi != nil && abi["type"] == "enum" {
+		abiVariants, ok := abi["variants"].([]interface{})
+		if !ok {
+			return variants
+		}
+		for _, variant := range abiVariants {
+			variantEntry, ok := variant.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			variantName, _ := variantEntry["name"].(string)
+			variantType, _ := variantEntry["type"].(string)
+			variants = append(variants, EnumVariant{
+				Name: variantName,
+				Type: variantType,
+			})
+		}
+		return variants
+	}
+
+	for _, enum := range Types.Enum {
+		if !stringStartsWith(typeName, enum.Type+"<") && !stringStartsWith(typeName, enum.Type+"::<") {
+			continue
+		}
+		innerTypes := splitTypeList(GetGenericInnerType(typeName))
+		for i, variantName := range CoreEnumVariants[enum.Type] {
+			variantType := "()"
+			if i < len(innerTypes) {
+				variantType = innerTypes[i]
+			}
+			variants = append(variants, EnumVariant{
+				Name: variantName,
+				Type: variantType,
+			})
+		}
+		break
+	}
+	return variants
+}
@@ -0,0 +1,332 @@
+package registry
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/NethermindEth/starknet.go/utils"
+)
+
+// -1 as a felt ( FeltPrime - 1 )
+const feltMinusOne = "0x800000000000011000000000000000000000000000000000000000000000000"
+
+var decoderTestAbi = []interface{}{
+	map[string]interface{}{
+		"type": "struct",
+		"name": "game::Position",
+		"members": []interface{}{
+			map[string]interface{}{"name": "x", "type": "core::integer::u32"},
+			map[string]interface{}{"name": "y", "type": "core::integer::u32"},
+		},
+	},
+	map[string]interface{}{
+		"type": "enum",
+		"name": "game::Direction",
+		"variants": []interface{}{
+			map[string]interface{}{"name": "Up", "type": "()"},
+			map[string]interface{}{"name": "Down", "type": "()"},
+			map[string]interface{}{"name": "Teleport", "type": "game::Position"},
+		},
+	},
+	// Event enums of a contract with a nested & a flat component
+	map[string]interface{}{
+		"type": "event",
+		"name": "game::Moved",
+		"kind": "struct",
+		"members": []interface{}{
+			map[string]interface{}{"name": "player", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+			map[string]interface{}{"name": "direction", "type": "game::Direction", "kind": "data"},
+			map[string]interface{}{"name": "position", "type": "game::Position", "kind": "data"},
+		},
+	},
+	map[string]interface{}{
+		"type": "event",
+		"name": "game::upgrades::Upgraded",
+		"kind": "struct",
+		"members": []interface{}{
+			map[string]interface{}{"name": "level", "type": "core::integer::u8", "kind": "data"},
+		},
+	},
+	map[string]interface{}{
+		"type": "event",
+		"name": "game::upgrades::Event",
+		"kind": "enum",
+		"variants": []interface{}{
+			map[string]interface{}{"name": "Upgraded", "type": "game::upgrades::Upgraded", "kind": "nested"},
+		},
+	},
+	map[string]interface{}{
+		"type": "event",
+		"name": "game::prestige::Prestiged",
+		"kind": "struct",
+		"members": []interface{}{
+			map[string]interface{}{"name": "count", "type": "core::integer::u16", "kind": "data"},
+		},
+	},
+	map[string]interface{}{
+		"type": "event",
+		"name": "game::prestige::Event",
+		"kind": "enum",
+		"variants": []interface{}{
+			map[string]interface{}{"name": "Prestiged", "type": "game::prestige::Prestiged", "kind": "nested"},
+		},
+	},
+	map[string]interface{}{
+		"type": "event",
+		"name": "game::Event",
+		"kind": "enum",
+		"variants": []interface{}{
+			map[string]interface{}{"name": "Moved", "type": "game::Moved", "kind": "nested"},
+			map[string]interface{}{"name": "UpgradeEvent", "type": "game::upgrades::Event", "kind": "nested"},
+			map[string]interface{}{"name": "PrestigeEvent", "type": "game::prestige::Event", "kind": "flat"},
+		},
+	},
+}
+
+func selector(name string) string {
+	return utils.GetSelectorFromNameFelt(name).String()
+}
+
+func bigIntValue(value string, bias *big.Int) BigIntValue {
+	val, _ := new(big.Int).SetString(value, 0)
+	return NewBigIntValue(val, bias)
+}
+
+func TestDecodeType(t *testing.T) {
+	u128Max := "0xffffffffffffffffffffffffffffffff"
+	tests := []struct {
+		name       string
+		typeName   string
+		data       []string
+		want       interface{}
+		wantOffset int
+	}{
+		{"felt", "core::felt252", []string{"0x2a"}, "0x2a", 1},
+		{"u8", "core::integer::u8", []string{"0xff"}, uint64(255), 1},
+		{"u64", "core::integer::u64", []string{"0xffffffffffffffff"}, uint64(18446744073709551615), 1},
+		{"bool", "core::bool", []string{"0x1"}, true, 1},
+		{"address", "core::starknet::contract_address::ContractAddress", []string{"0xabc"}, "0xabc", 1},
+		{"i8 negative", "core::integer::i8", []string{feltMinusOne}, int64(-1), 1},
+		{"i32 positive", "core::integer::i32", []string{"0x7fffffff"}, int64(2147483647), 1},
+		{"i128 negative", "core::integer::i128", []string{feltMinusOne}, bigIntValue("-1", i128Bias), 1},
+		{"u128", "core::integer::u128", []string{u128Max}, bigIntValue(u128Max, nil), 1},
+		{"u256", "core::integer::u256", []string{"0x1", "0x2"}, bigIntValue("0x200000000000000000000000000000001", nil), 2},
+		{"byte array pending word", "core::byte_array::ByteArray", []string{"0x0", "0x68656c6c6f", "0x5"}, "hello", 3},
+		{
+			"byte array full word",
+			"core::byte_array::ByteArray",
+			// "abcdefghijklmnopqrstuvwxyz01234" & "56"
+			[]string{"0x1", "0x6162636465666768696a6b6c6d6e6f707172737475767778797a3031323334", "0x3536", "0x2"},
+			"abcdefghijklmnopqrstuvwxyz0123456",
+			4,
+		},
+		{"array", "core::array::Array::<core::integer::u8>", []string{"0x2", "0x1", "0x2"}, []interface{}{uint64(1), uint64(2)}, 3},
+		{"span", "core::array::Span::<core::felt252>", []string{"0x0"}, []interface{}{}, 1},
+		{"tuple", "(core::felt252, core::bool)", []string{"0x1", "0x0"}, []interface{}{"0x1", false}, 2},
+		{"nested tuple", "(core::integer::u8, (core::integer::u16, core::integer::u32))", []string{"0x1", "0x2", "0x3"}, []interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}}, 3},
+		{"fixed array", "[core::integer::u8; 3]", []string{"0x1", "0x2", "0x3", "0x4"}, []interface{}{uint64(1), uint64(2), uint64(3)}, 3},
+		{"nested fixed array", "[[core::integer::u8; 2]; 2]", []string{"0x1", "0x2", "0x3", "0x4"}, []interface{}{[]interface{}{uint64(1), uint64(2)}, []interface{}{uint64(3), uint64(4)}}, 4},
+		{"struct", "game::Position", []string{"0x3", "0x4"}, map[string]interface{}{"x": uint64(3), "y": uint64(4)}, 2},
+		{"enum unit variant", "game::Direction", []string{"0x1"}, map[string]interface{}{"variant": "Down", "value": nil}, 1},
+		{"enum struct variant", "game::Direction", []string{"0x2", "0x5", "0x6"}, map[string]interface{}{"variant": "Teleport", "value": map[string]interface{}{"x": uint64(5), "y": uint64(6)}}, 3},
+		{"option some", "core::option::Option::<core::integer::u32>", []string{"0x0", "0x7"}, map[string]interface{}{"variant": "Some", "value": uint64(7)}, 2},
+		{"option none", "core::option::Option::<core::integer::u32>", []string{"0x1"}, map[string]interface{}{"variant": "None", "value": nil}, 1},
+		{"result err", "core::result::Result::<core::integer::u8, core::felt252>", []string{"0x1", "0x2a"}, map[string]interface{}{"variant": "Err", "value": "0x2a"}, 2},
+		{"array of enums", "core::array::Array::<game::Direction>", []string{"0x2", "0x0", "0x2", "0x1", "0x2"}, []interface{}{
+			map[string]interface{}{"variant": "Up", "value": nil},
+			map[string]interface{}{"variant": "Teleport", "value": map[string]interface{}{"x": uint64(1), "y": uint64(2)}},
+		}, 5},
+	}
+	index := NewTypeIndex(decoderTestAbi)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, offset, err := index.DecodeType(test.typeName, test.data)
+			if err != nil {
+				t.Fatalf("DecodeType(%s) error: %v", test.typeName, err)
+			}
+			if !reflect.DeepEqual(value, test.want) {
+				t.Errorf("DecodeType(%s) = %#v, want %#v", test.typeName, value, test.want)
+			}
+			if offset != test.wantOffset {
+				t.Errorf("DecodeType(%s) offset = %d, want %d", test.typeName, offset, test.wantOffset)
+			}
+		})
+	}
+}
+
+func TestDecodeTypeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeName string
+		data     []string
+		wantErr  error
+		wantPath string
+	}{
+		{"no felts", "core::felt252", []string{}, ErrNotEnoughFelts, ""},
+		{"u8 overflow", "core::integer::u8", []string{"0x100"}, nil, ""},
+		{"u256 missing high", "core::integer::u256", []string{"0x1"}, ErrNotEnoughFelts, ""},
+		{"u256 low overflow", "core::integer::u256", []string{"0x100000000000000000000000000000000", "0x0"}, ErrInvalidValue, ""},
+		{"i8 out of range", "core::integer::i8", []string{"0x80"}, nil, ""},
+		{"byte array short", "core::byte_array::ByteArray", []string{"0x2", "0x1"}, ErrNotEnoughFelts, ""},
+		{"array length past data", "core::array::Array::<core::felt252>", []string{"0xffffffff", "0x1"}, ErrNotEnoughFelts, ""},
+		{"fixed array length past data", "[core::felt252; 4294967295]", []string{"0x1"}, ErrNotEnoughFelts, ""},
+		{"fixed array of zero sized elements", "[(); 3]", []string{"0x1", "0x2", "0x3"}, ErrInvalidAbi, "[0]"},
+		{"array of zero sized elements", "core::array::Array::<()>", []string{"0x1", "0x0"}, ErrInvalidAbi, "[0]"},
+		{"enum variant out of range", "game::Direction", []string{"0x3"}, ErrInvalidVariant, ""},
+		{"unknown type", "game::Unknown", []string{"0x1"}, ErrUnknownType, ""},
+		{"struct member path", "game::Position", []string{"0x1"}, ErrNotEnoughFelts, "y"},
+		{"array element path", "core::array::Array::<game::Position>", []string{"0x1", "0x1"}, ErrNotEnoughFelts, "[0].y"},
+	}
+	index := NewTypeIndex(decoderTestAbi)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := index.DecodeType(test.typeName, test.data)
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("DecodeType(%s) error = %v, want a DecodeError", test.typeName, err)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("DecodeType(%s) error = %v, want %v", test.typeName, err, test.wantErr)
+			}
+			if decodeErr.Path != test.wantPath {
+				t.Errorf("DecodeType(%s) error path = %q, want %q", test.typeName, decodeErr.Path, test.wantPath)
+			}
+		})
+	}
+}
+
+func TestResolveEvent(t *testing.T) {
+	tests := []struct {
+		name              string
+		keys              []string
+		wantType          string
+		wantSelectorCount int
+		wantErr           error
+	}{
+		{"contract event", []string{selector("Moved"), "0xabc"}, "game::Moved", 1, nil},
+		{"nested component event", []string{selector("UpgradeEvent"), selector("Upgraded")}, "game::upgrades::Upgraded", 2, nil},
+		{"flat component event", []string{selector("Prestiged")}, "game::prestige::Prestiged", 1, nil},
+		{"nested component without its variant key", []string{selector("Upgraded")}, "", 0, ErrEventNotFound},
+		{"unknown selector", []string{selector("Unknown")}, "", 0, ErrEventNotFound},
+		{"padded selector", []string{"0x0" + selector("Moved")[2:], "0xabc"}, "game::Moved", 1, nil},
+	}
+	decoder := NewContractDecoder(decoderTestAbi)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, selectorCount, err := decoder.ResolveEvent(test.keys)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("ResolveEvent error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveEvent error: %v", err)
+			}
+			if event.TypeName != test.wantType || selectorCount != test.wantSelectorCount {
+				t.Errorf("ResolveEvent = %s, %d, want %s, %d", event.TypeName, selectorCount, test.wantType, test.wantSelectorCount)
+			}
+		})
+	}
+	if count := len(decoder.Events); count != 3 {
+		t.Errorf("compiled %d events, want 3", count)
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		name          string
+		typeName      string
+		abi           []interface{}
+		keys          []string
+		data          []string
+		want          map[string]interface{}
+		wantKeyFields []string
+		wantErr       error
+	}{
+		{
+			name:     "key & data members",
+			typeName: "game::Moved",
+			abi:      decoderTestAbi,
+			keys:     []string{"0xabc"},
+			data:     []string{"0x0", "0x1", "0x2"},
+			want: map[string]interface{}{
+				"player":    "0xabc",
+				"direction": map[string]interface{}{"variant": "Up", "value": nil},
+				"position":  map[string]interface{}{"x": uint64(1), "y": uint64(2)},
+			},
+			wantKeyFields: []string{"player"},
+		},
+		{
+			name:     "members without kinds in declaration order",
+			typeName: "game::Position",
+			abi:      decoderTestAbi,
+			keys:     []string{"0x1"},
+			data:     []string{"0x2"},
+			want: map[string]interface{}{
+				"x": uint64(1),
+				"y": uint64(2),
+			},
+			wantKeyFields: []string{},
+		},
+		{
+			name:     "unconsumed keys",
+			typeName: "game::Moved",
+			abi:      decoderTestAbi,
+			keys:     []string{"0xabc", "0xdef"},
+			data:     []string{"0x0", "0x1", "0x2"},
+			wantErr:  ErrUnconsumedFelts,
+		},
+		{
+			name:     "unconsumed data",
+			typeName: "game::Moved",
+			abi:      decoderTestAbi,
+			keys:     []string{"0xabc"},
+			data:     []string{"0x0", "0x1", "0x2", "0x3"},
+			wantErr:  ErrUnconsumedFelts,
+		},
+		{
+			name:     "data member read from keys is missing",
+			typeName: "game::Moved",
+			abi:      decoderTestAbi,
+			keys:     []string{},
+			data:     []string{"0xabc", "0x0", "0x1", "0x2"},
+			wantErr:  ErrNotEnoughFelts,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, keyFields, err := DecodeEvent(test.typeName, test.abi, test.keys, test.data)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("DecodeEvent error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeEvent error: %v", err)
+			}
+			if !reflect.DeepEqual(fields, test.want) {
+				t.Errorf("DecodeEvent = %#v, want %#v", fields, test.want)
+			}
+			if !reflect.DeepEqual(keyFields, test.wantKeyFields) {
+				t.Errorf("DecodeEvent key fields = %v, want %v", keyFields, test.wantKeyFields)
+			}
+		})
+	}
+}
+
+func TestBigIntValueSortKey(t *testing.T) {
+	// Sort keys of i128 values order like the values
+	values := []string{"-170141183460469231731687303715884105728", "-1", "0", "1", "170141183460469231731687303715884105727"}
+	previous := ""
+	for _, value := range values {
+		sortKey := bigIntValue(value, i128Bias).SortKey
+		if sortKey <= previous {
+			t.Errorf("sort key of %s = %s, not after %s", value, sortKey, previous)
+		}
+		previous = sortKey
+	}
+}
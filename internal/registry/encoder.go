@@ -0,0 +1,285 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// EncodeType encodes a json value ( decoded with json.Decoder.UseNumber ) of typeName
+// into calldata felts. Values use the same shapes DecodeType returns :
+//   - integers & felts as json numbers or decimal / hex strings, u128 / i128 / u256 also
+//     as a BigIntValue object & u256 as {"low", "high"}
+//   - felt252 also as a short string ( ex: "hello" ) & ByteArray as a string
+//   - arrays, spans, tuples & fixed arrays as json arrays, structs as json objects
+//   - enums as {"variant", "value"}, or the variant name for unit variants
+func (t *TypeIndex) EncodeType(typeName string, value interface{}) ([]string, error) {
+	return t.encodeType("", typeName, value)
+}
+
+func (t *TypeIndex) encodeType(path string, typeName string, value interface{}) ([]string, error) {
+	if IsPrimitiveType(typeName) {
+		felts, err := encodePrimitive(typeName, value)
+		if err != nil {
+			return nil, newEncodeError(path, typeName, err)
+		}
+		return felts, nil
+	} else if IsArrayType(typeName) {
+		values, ok := value.([]interface{})
+		if !ok {
+			return nil, newEncodeError(path, typeName, fmt.Errorf("%w: expected an array", ErrInvalidValue))
+		}
+		arrayType := GetArrayInnerType(typeName)
+		felts := []string{fmt.Sprintf("0x%x", len(values))}
+		for i, element := range values {
+			elementFelts, err := t.encodeType(fmt.Sprintf("%s[%d]", path, i), arrayType, element)
+			if err != nil {
+				return nil, err
+			}
+			felts = append(felts, elementFelts...)
+		}
+		return felts, nil
+	} else if IsTupleType(typeName) || IsFixedArrayType(typeName) {
+		var elementTypes []string
+		if IsTupleType(typeName) {
+			elementTypes = GetTupleInnerTypes(typeName)
+		} else {
+			arrayType, arrayLen, err := GetFixedArrayInfo(typeName)
+			if err != nil {
+				return nil, newEncodeError(path, typeName, err)
+			}
+			for i := 0; i < arrayLen; i++ {
+				elementTypes = append(elementTypes, arrayType)
+			}
+		}
+		values, ok := value.([]interface{})
+		if !ok || len(values) != len(elementTypes) {
+			return nil, newEncodeError(path, typeName, fmt.Errorf("%w: expected an array of %d elements", ErrInvalidValue, len(elementTypes)))
+		}
+		// Fixed size arrays are serialized without a length prefix, like tuples
+		felts := []string{}
+		for i, elementType := range elementTypes {
+			elementPath := joinDecodePath(path, strconv.Itoa(i))
+			if IsFixedArrayType(typeName) {
+				elementPath = fmt.Sprintf("%s[%d]", path, i)
+			}
+			elementFelts, err := t.encodeType(elementPath, elementType, values[i])
+			if err != nil {
+				return nil, err
+			}
+			felts = append(felts, elementFelts...)
+		}
+		return felts, nil
+	} else if t.IsEnumType(typeName) {
+		variantName, variantValue, err := enumValue(value)
+		if err != nil {
+			return nil, newEncodeError(path, typeName, err)
+		}
+		for i, variant := range t.GetEnumVariants(typeName) {
+			if variant.Name != variantName {
+				continue
+			}
+			felts := []string{fmt.Sprintf("0x%x", i)}
+			if IsUnitType(variant.Type) {
+				return felts, nil
+			}
+			variantFelts, err := t.encodeType(joinDecodePath(path, variant.Name), variant.Type, variantValue)
+			if err != nil {
+				return nil, err
+			}
+			return append(felts, variantFelts...), nil
+		}
+		return nil, newEncodeError(path, typeName, fmt.Errorf("%w: unknown variant %s", ErrInvalidVariant, variantName))
+	} else if IsStructType(typeName) {
+		abi := t.Lookup(typeName)
+		if abi == nil {
+			return nil, newEncodeError(path, typeName, ErrUnknownType)
+		}
+		members, ok := abi["members"].([]interface{})
+		if !ok {
+			return nil, newEncodeError(path, typeName, ErrInvalidAbi)
+		}
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, newEncodeError(path, typeName, fmt.Errorf("%w: expected an object", ErrInvalidValue))
+		}
+		felts := []string{}
+		for _, member := range members {
+			memberEntry, ok := member.(map[string]interface{})
+			if !ok {
+				return nil, newEncodeError(path, typeName, ErrInvalidAbi)
+			}
+			memberName, _ := memberEntry["name"].(string)
+			memberType, _ := memberEntry["type"].(string)
+			memberValue, ok := fields[memberName]
+			if !ok {
+				return nil, newEncodeError(joinDecodePath(path, memberName), memberType, ErrMissingValue)
+			}
+			memberFelts, err := t.encodeType(joinDecodePath(path, memberName), memberType, memberValue)
+			if err != nil {
+				return nil, err
+			}
+			felts = append(felts, memberFelts...)
+		}
+		return felts, nil
+	}
+	return nil, newEncodeError(path, typeName, ErrUnknownType)
+}
+
+// enumValue returns the variant & value of an enum json value
+func enumValue(value interface{}) (string, interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil, nil
+	case map[string]interface{}:
+		variant, ok := v["variant"].(string)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: missing enum variant", ErrInvalidValue)
+		}
+		return variant, v["value"], nil
+	}
+	return "", nil, fmt.Errorf("%w: expected an enum variant", ErrInvalidValue)
+}
+
+// Integer bounds of the primitive types, signed types are encoded as FeltPrime - |value| when negative
+var integerBounds = map[string]struct {
+	bits   int
+	signed bool
+}{
+	"core::integer::u8":   {8, false},
+	"core::integer::u16":  {16, false},
+	"core::integer::u32":  {32, false},
+	"core::integer::u64":  {64, false},
+	"core::integer::u128": {128, false},
+	"core::integer::i8":   {8, true},
+	"core::integer::i16":  {16, true},
+	"core::integer::i32":  {32, true},
+	"core::integer::i64":  {64, true},
+	"core::integer::i128": {128, true},
+}
+
+func encodePrimitive(typeName string, value interface{}) ([]string, error) {
+	switch typeName {
+	case "core::bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected a boolean", ErrInvalidValue)
+		}
+		if b {
+			return []string{"0x1"}, nil
+		}
+		return []string{"0x0"}, nil
+	case "core::byte_array::ByteArray":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected a string", ErrInvalidValue)
+		}
+		return EncodeByteArray(s), nil
+	case "core::integer::u256":
+		if fields, ok := value.(map[string]interface{}); ok {
+			if _, ok := fields["low"]; ok {
+				low, err := parseBigInt(fields["low"])
+				if err != nil {
+					return nil, err
+				}
+				high, err := parseBigInt(fields["high"])
+				if err != nil {
+					return nil, err
+				}
+				value = json.Number(new(big.Int).Or(new(big.Int).Lsh(high, 128), low).String())
+			}
+		}
+		val, err := parseBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+		if val.Sign() < 0 || val.BitLen() > 256 {
+			return nil, fmt.Errorf("%w: %s out of range", ErrInvalidValue, val)
+		}
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+		low := new(big.Int).And(val, mask)
+		high := new(big.Int).Rsh(val, 128)
+		return []string{fmt.Sprintf("0x%x", low), fmt.Sprintf("0x%x", high)}, nil
+	case "core::felt252", "core::starknet::contract_address::ContractAddress", "core::starknet::class_hash::ClassHash":
+		val, err := parseBigInt(value)
+		if err != nil {
+			s, ok := value.(string)
+			if typeName != "core::felt252" || !ok {
+				return nil, err
+			}
+			// Cairo short string
+			if len(s) > byteArrayWordSize {
+				return nil, fmt.Errorf("%w: short string longer than %d bytes", ErrInvalidValue, byteArrayWordSize)
+			}
+			val = new(big.Int).SetBytes([]byte(s))
+		}
+		if val.Sign() < 0 || val.Cmp(FeltPrime) >= 0 {
+			return nil, fmt.Errorf("%w: %s out of range", ErrInvalidValue, val)
+		}
+		return []string{fmt.Sprintf("0x%x", val)}, nil
+	}
+
+	bounds, ok := integerBounds[typeName]
+	if !ok {
+		return nil, ErrUnknownType
+	}
+	val, err := parseBigInt(value)
+	if err != nil {
+		return nil, err
+	}
+	min, max := big.NewInt(0), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bounds.bits)), big.NewInt(1))
+	if bounds.signed {
+		min = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(bounds.bits-1)))
+		max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bounds.bits-1)), big.NewInt(1))
+	}
+	if val.Cmp(min) < 0 || val.Cmp(max) > 0 {
+		return nil, fmt.Errorf("%w: %s out of range", ErrInvalidValue, val)
+	}
+	if val.Sign() < 0 {
+		val.Add(val, FeltPrime)
+	}
+	return []string{fmt.Sprintf("0x%x", val)}, nil
+}
+
+// parseBigInt parses an integer from a json number, a decimal / hex string or a BigIntValue object
+func parseBigInt(value interface{}) (*big.Int, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		if bigIntValue, ok := v["value"].(string); ok {
+			s = bigIntValue
+		}
+	}
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	val, ok := new(big.Int).SetString(strings.TrimPrefix(s, "-"), 0)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected an integer, got %v", ErrInvalidValue, value)
+	}
+	if negative {
+		val.Neg(val)
+	}
+	return val, nil
+}
+
+// EncodeByteArray serializes a string as a core::byte_array::ByteArray
+// Layout: [data_len, data_word_0, ..., data_word_n, pending_word, pending_word_len]
+func EncodeByteArray(s string) []string {
+	bytes := []byte(s)
+	fullWords := len(bytes) / byteArrayWordSize
+	felts := []string{fmt.Sprintf("0x%x", fullWords)}
+	for i := 0; i < fullWords; i++ {
+		word := bytes[i*byteArrayWordSize : (i+1)*byteArrayWordSize]
+		felts = append(felts, fmt.Sprintf("0x%x", new(big.Int).SetBytes(word)))
+	}
+	pending := bytes[fullWords*byteArrayWordSize:]
+	return append(felts, fmt.Sprintf("0x%x", new(big.Int).SetBytes(pending)), fmt.Sprintf("0x%x", len(pending)))
+}
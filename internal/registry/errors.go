@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNotEnoughFelts  = errors.New("not enough felts")
+	ErrUnconsumedFelts = errors.New("unconsumed felts after decoding")
+	ErrInvalidValue    = errors.New("invalid value")
+	ErrInvalidVariant  = errors.New("enum variant index out of range")
+	ErrUnknownType     = errors.New("type not found in abi")
+	ErrInvalidAbi      = errors.New("invalid abi entry")
+	ErrEventNotFound   = errors.New("event not found")
+	ErrMissingValue    = errors.New("missing value")
+)
+
+// Max raw felts kept on a DecodeError, to bound dead letter size
+const maxDecodeErrorFelts = 16
+
+// DecodeError is returned when event data can't be decoded with the abi
+type DecodeError struct {
+	// Location of the failing value within the event ( ex: "position.x", "moves[2]" )
+	Path string `json:"path" bson:"path"`
+	// Type being decoded at Path
+	Type string `json:"type" bson:"type"`
+	// Raw felts at Path, where decoding failed
+	Felts []string `json:"felts" bson:"felts"`
+	Err   error    `json:"-" bson:"-"`
+}
+
+func newDecodeError(path string, typeName string, felts []string, err error) *DecodeError {
+	if len(felts) > maxDecodeErrorFelts {
+		felts = felts[:maxDecodeErrorFelts]
+	}
+	return &DecodeError{
+		Path:  path,
+		Type:  typeName,
+		Felts: append([]string{}, felts...),
+		Err:   err,
+	}
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode %s ( %s ) from [%s]: %v", e.Path, e.Type, strings.Join(e.Felts, ", "), e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func joinDecodePath(path string, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// EncodeError is returned when a value can't be encoded as calldata with the abi
+type EncodeError struct {
+	// Location of the failing value within the arguments ( ex: "position.x", "moves[2]" )
+	Path string `json:"path"`
+	// Type being encoded at Path
+	Type string `json:"type"`
+	Err  error  `json:"-"`
+}
+
+func newEncodeError(path string, typeName string, err error) *EncodeError {
+	return &EncodeError{
+		Path: path,
+		Type: typeName,
+		Err:  err,
+	}
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("failed to encode %s ( %s ): %v", e.Path, e.Type, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
@@ -1,9 +1,9 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"math/big"
 
 	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
 	"github.com/b-j-roberts/foc-engine/internal/provider"
@@ -15,19 +15,29 @@ const (
 	ContractRegisteredEvent = "0x206ba27d5bbda42a63e108ee1ac7a6455c197ee34cd40a268e61b06f78dbc9a"
 )
 
+type StarknetEvent struct {
+	BlockHash       string   `json:"block_hash" bson:"block_hash"`
+	BlockNumber     uint     `json:"block_number" bson:"block_number"`
+	FromAddress     string   `json:"from_address" bson:"from_address"`
+	TransactionHash string   `json:"transaction_hash" bson:"transaction_hash"`
+	Keys            []string `json:"keys" bson:"keys"`
+	Data            []string `json:"data" bson:"data"`
+	// Index of the event within its transaction, from the rpc when provided or the receipt
+	EventIndex *uint `json:"event_index,omitempty" bson:"event_index,omitempty"`
+	// Set from the block header when received, not part of the rpc event
+	BlockTimestamp *uint64 `json:"block_timestamp,omitempty" bson:"block_timestamp,omitempty"`
+	// Set by rpc v0.9+, otherwise derived from the block hash ( see normalizeFinality )
+	FinalityStatus string `json:"finality_status,omitempty" bson:"finality_status,omitempty"`
+}
+
 type StarknetEventData struct {
 	JsonRpc string `json:"jsonrpc"`
 	Method  string `json:"method"`
 	Params  struct {
-		SubscriptionId big.Int `json:"subscription_id"`
-		Result         struct {
-			BlockHash       string   `json:"block_hash"`
-			BlockNumber     uint     `json:"block_number"`
-			FromAddress     string   `json:"from_address"`
-			TransactionHash string   `json:"transaction_hash"`
-			Keys            []string `json:"keys"`
-			Data            []string `json:"data"`
-		}
+		SubscriptionId provider.SubscriptionId `json:"subscription_id"`
+		Result         StarknetEvent           `json:"result"`
+		// Identical events of the transaction before this one, set for starknet_getEvents results
+		Occurrence uint `json:"occurrence"`
 	} `json:"params"`
 }
 
@@ -42,13 +52,16 @@ func PrintStarknetEventData(eventData StarknetEventData) {
 	fmt.Printf("  Data: %v\n", eventData.Params.Result.Data)
 }
 
-func ProcessStarknetEventData(message []byte) {
+func (r *Registry) ProcessStarknetEventData(message []byte) {
 	var eventData StarknetEventData
 	err := json.Unmarshal(message, &eventData)
 	if err != nil {
 		fmt.Println("Error unmarshalling event data:", err)
 		return
 	}
+	r.setEventIndex(context.TODO(), &eventData.Params.Result, eventData.Params.Occurrence)
+	eventData.Params.Result.FinalityStatus = normalizeFinality(eventData.Params.Result)
+	r.setBlockHeader(&eventData.Params.Result)
 	// TODO: Pad the address to 0x0000...0000 w/ 64 hex digits
 	contractAddress := eventData.Params.Result.FromAddress
 	if len(contractAddress) != 66 {
@@ -59,37 +72,78 @@ func ProcessStarknetEventData(message []byte) {
 		// Pad with leading zeros to 64 characters
 		contractAddress = fmt.Sprintf("0x%064s", contractAddress)
 	}
-	if FocRegistry.RegistryAddresses[contractAddress] {
-		ProcessRegistryEvent(eventData)
-	} else if _, ok := FocRegistry.RegisteredContracts[contractAddress]; ok {
-		ProcessRegisteredContractEvent(eventData)
+	if r.isRegistryAddress(contractAddress) {
+		r.ProcessRegistryEvent(eventData)
+	} else if _, ok := r.getRegisteredContract(contractAddress); ok {
+		r.ProcessRegisteredContractEvent(eventData)
 	} else {
 		fmt.Println("Unknown contract address:", contractAddress)
 	}
+
+	// Track the last completed blocks across all subscriptions
+	r.mutex.Lock()
+	lastCompletedBlock := r.LastCompletedBlock
+	// One-off offset to ensure we don't miss any events if shut down mid-block
+	if eventData.Params.Result.BlockNumber > lastCompletedBlock+1 {
+		r.LastCompletedBlock = eventData.Params.Result.BlockNumber - 1
+	}
+	r.mutex.Unlock()
+	r.trackProcessedBlock(eventData.Params.Result)
+}
+
+// setEventIndex sets the index of an event within its transaction from the transaction
+// receipt, for rpc versions which don't include it in emitted events. Receipts are only
+// fetched with Indexer.EnrichReceipts, events are otherwise stored without an index.
+func (r *Registry) setEventIndex(ctx context.Context, event *StarknetEvent, occurrence uint) {
+	if event.EventIndex != nil || event.TransactionHash == "" || !r.config.EnrichReceipts {
+		return
+	}
+	details, err := r.GetTransactionDetails(ctx, event.TransactionHash)
+	if err != nil {
+		// Stored without, see UpsertEventDocument
+		fmt.Println("Error getting transaction receipt:", event.TransactionHash, err)
+		return
+	}
+	if index, ok := details.receiptEventIndex(*event, occurrence); ok {
+		event.EventIndex = &index
+	}
+}
+
+// setBlockHeader sets the block hash & timestamp of an event from the provider's chain heads,
+// fetching the header of blocks outside of its window ( off the WebSocket read loop )
+func (r *Registry) setBlockHeader(event *StarknetEvent) {
+	if event.FinalityStatus == FinalityPreConfirmed {
+		// Not in an accepted block yet
+		return
+	}
+	header, err := r.getBlockHeader(context.Background(), event.BlockNumber)
+	if err != nil {
+		fmt.Println("Error getting block header:", event.BlockNumber, err)
+		return
+	}
+	if event.BlockHash == "" {
+		event.BlockHash = header.BlockHash
+	}
+	timestamp := header.Timestamp
+	event.BlockTimestamp = &timestamp
 }
 
 // TODO: Store current block events locally till block complete?
-func ProcessRegistryEvent(eventMessage StarknetEventData) {
+func (r *Registry) ProcessRegistryEvent(eventMessage StarknetEventData) {
 	if eventMessage.Method == "" {
 		return
 	}
 
 	if eventMessage.Params.Result.Keys[0] == ContractRegisteredEvent {
-		ProcessRegisterContractEvent(eventMessage)
+		r.ProcessRegisterContractEvent(eventMessage)
 	} else {
 		fmt.Println("Unknown event:")
 		PrintStarknetEventData(eventMessage)
 	}
 
-	// Track the last completed blocks
-	lastCompletedBlock := FocRegistry.LastCompletedBlock
-	// One-off offset to ensure we don't miss any events if shut down mid-block
-	if eventMessage.Params.Result.BlockNumber > lastCompletedBlock+1 {
-		FocRegistry.LastCompletedBlock = eventMessage.Params.Result.BlockNumber - 1
-	}
 }
 
-func ProcessRegisterContractEvent(eventMessage StarknetEventData) {
+func (r *Registry) ProcessRegisterContractEvent(eventMessage StarknetEventData) {
 	focEngineAddress := eventMessage.Params.Result.FromAddress
 	if len(focEngineAddress) != 66 {
 		// Remove 0x prefix if present
@@ -101,43 +155,40 @@ func ProcessRegisterContractEvent(eventMessage StarknetEventData) {
 	}
 	address := eventMessage.Params.Result.Keys[1]
 	classHash := eventMessage.Params.Result.Data[0]
-	RegisterContract(address, classHash)
+	r.RegisterContract(address, classHash)
 
-	if _, ok := FocRegistry.RegistryContracts[focEngineAddress]; !ok {
+	if _, ok := r.getRegistryContract(focEngineAddress); !ok {
 		fmt.Println("Unknown foc engine address:", focEngineAddress)
 		return
 	}
-	registryContract := FocRegistry.RegistryContracts[focEngineAddress]
-	abi := registryContract.ContractClass.Abi
-	typeName, err := GetEventTypeName(eventMessage.Params.Result.Keys[0], abi)
+	typeNameJson, err := r.DecodeRegistryEvent(eventMessage.Params.Result)
 	if err != nil {
-		fmt.Println("Error getting event type name:", err)
-		return
+		// Still subscribe below, the registration can be retried from the dead letters
+		fmt.Println("Error decoding registry event:", err)
+		r.InsertDeadLetter(DeadLetterRegistry, eventMessage.Params.Result, err)
+	} else {
+		r.EnrichEventDocument(context.TODO(), typeNameJson, eventMessage.Params.Result)
+		err := r.UpsertEventDocument(context.TODO(), "registry", typeNameJson)
+		if err != nil {
+			fmt.Println("Error inserting event into MongoDB:", err)
+			return
+		}
+		fmt.Println("Inserted event into MongoDB:", typeNameJson["transaction_hash"])
 	}
-	eventData := eventMessage.Params.Result.Keys[1:]
-	eventData = append(eventData, eventMessage.Params.Result.Data...)
-	typeNameJson, _ := StarknetTypeDataMin(typeName, abi, eventData)
-	typeNameJson.(map[string]interface{})["registry_address"] = eventMessage.Params.Result.FromAddress
-	typeNameJson.(map[string]interface{})["block_number"] = eventMessage.Params.Result.BlockNumber
-	typeNameJson.(map[string]interface{})["transaction_hash"] = eventMessage.Params.Result.TransactionHash
-	typeNameJson.(map[string]interface{})["event_type"] = typeName
-	res, err := mongo.InsertJson("foc_engine", "registry", typeNameJson)
-	if err != nil {
-		fmt.Println("Error inserting event into MongoDB:", err)
+
+	if err := r.provider.SubscribeEvents(address); err != nil {
+		fmt.Println("Error subscribing to events for contract:", address, err)
 		return
 	}
-	fmt.Println("Inserted event into MongoDB:", res)
-
-	provider.SubscribeEvents(address)
 	fmt.Println("Subscribed to events for contract:", address)
 }
 
-func ProcessRegisterClassEvent(eventMessage StarknetEventData) {
+func (r *Registry) ProcessRegisterClassEvent(eventMessage StarknetEventData) {
 	// Register contract in memory
 	address := eventMessage.Params.Result.Keys[1]
 	name := eventMessage.Params.Result.Data[0]
 	version := eventMessage.Params.Result.Data[1]
-	RegisterClass(address, name, version)
+	r.RegisterClass(address, name, version)
 
 	// TODO: Load abi
 
@@ -151,8 +202,50 @@ func ProcessRegisterClassEvent(eventMessage StarknetEventData) {
 	fmt.Println("Inserted event into MongoDB:", res)
 }
 
-func ProcessRegisteredContractEvent(eventMessage StarknetEventData) {
-	contractAddress := eventMessage.Params.Result.FromAddress
+func (r *Registry) ProcessRegisteredContractEvent(eventMessage StarknetEventData) {
+	typeNameJson, err := r.DecodeRegisteredContractEvent(eventMessage.Params.Result)
+	if err != nil {
+		fmt.Println("Error decoding event:", err)
+		r.InsertDeadLetter(DeadLetterEvents, eventMessage.Params.Result, err)
+		return
+	}
+
+	r.EnrichEventDocument(context.TODO(), typeNameJson, eventMessage.Params.Result)
+	err = r.UpsertEventDocument(context.TODO(), "events", typeNameJson)
+	if err != nil {
+		fmt.Println("Error inserting event into MongoDB:", err)
+		return
+	}
+}
+
+// DecodeRegistryEvent decodes an event emitted by a registry contract into
+// the document stored in the registry collection
+func (r *Registry) DecodeRegistryEvent(event StarknetEvent) (map[string]interface{}, error) {
+	focEngineAddress := event.FromAddress
+	if len(focEngineAddress) != 66 {
+		// Remove 0x prefix if present
+		if focEngineAddress[:2] == "0x" {
+			focEngineAddress = focEngineAddress[2:]
+		}
+		// Pad with leading zeros to 64 characters
+		focEngineAddress = fmt.Sprintf("0x%064s", focEngineAddress)
+	}
+	registryContract, ok := r.getRegistryContract(focEngineAddress)
+	if !ok {
+		return nil, fmt.Errorf("unknown foc engine address: %s", focEngineAddress)
+	}
+	typeNameJson, err := decodeEventDocument(registryContract.Decoder, event)
+	if err != nil {
+		return nil, err
+	}
+	typeNameJson["registry_address"] = event.FromAddress
+	return typeNameJson, nil
+}
+
+// DecodeRegisteredContractEvent decodes an event emitted by a registered contract
+// into the document stored in the events collection
+func (r *Registry) DecodeRegisteredContractEvent(event StarknetEvent) (map[string]interface{}, error) {
+	contractAddress := event.FromAddress
 	if len(contractAddress) != 66 {
 		// Remove 0x prefix if present
 		if contractAddress[:2] == "0x" {
@@ -161,28 +254,50 @@ func ProcessRegisteredContractEvent(eventMessage StarknetEventData) {
 		// Pad with leading zeros to 64 characters
 		contractAddress = fmt.Sprintf("0x%064s", contractAddress)
 	}
-	if _, ok := FocRegistry.RegisteredContracts[contractAddress]; !ok {
-		fmt.Println("Unknown registered contract address:", contractAddress)
-		return
+	registeredContract, ok := r.getRegisteredContract(contractAddress)
+	if !ok {
+		return nil, fmt.Errorf("unknown registered contract address: %s", contractAddress)
 	}
-	registeredContract := FocRegistry.RegisteredContracts[contractAddress]
-	abi := registeredContract.ContractClass.Abi
-	typeName, err := GetEventTypeName(eventMessage.Params.Result.Keys[0], abi)
+	typeNameJson, err := decodeEventDocument(registeredContract.Decoder, event)
 	if err != nil {
-		fmt.Println("Error getting event type name:", err)
-		return
+		return nil, err
 	}
-	eventData := eventMessage.Params.Result.Keys[1:]
-	eventData = append(eventData, eventMessage.Params.Result.Data...)
-	typeNameJson, _ := StarknetTypeDataMin(typeName, abi, eventData)
-	typeNameJson.(map[string]interface{})["contract_address"] = eventMessage.Params.Result.FromAddress
-	typeNameJson.(map[string]interface{})["block_number"] = eventMessage.Params.Result.BlockNumber
-	typeNameJson.(map[string]interface{})["transaction_hash"] = eventMessage.Params.Result.TransactionHash
-	typeNameJson.(map[string]interface{})["event_type"] = typeName
+	typeNameJson["contract_address"] = event.FromAddress
+	return typeNameJson, nil
+}
 
-	_, err = mongo.InsertJson("foc_engine", "events", typeNameJson)
+func decodeEventDocument(decoder *ContractDecoder, event StarknetEvent) (map[string]interface{}, error) {
+	if decoder == nil {
+		return nil, fmt.Errorf("no abi loaded for contract: %s", event.FromAddress)
+	}
+	eventDefinition, selectorCount, err := decoder.ResolveEvent(event.Keys)
 	if err != nil {
-		fmt.Println("Error inserting event into MongoDB:", err)
-		return
+		return nil, err
+	}
+	typeName := eventDefinition.TypeName
+	eventKeys := event.Keys[selectorCount:]
+	typeNameJson, keyFields, err := decoder.DecodeEvent(typeName, eventKeys, event.Data)
+	if err != nil {
+		return nil, err
+	}
+	typeNameJson["block_number"] = event.BlockNumber
+	typeNameJson["transaction_hash"] = event.TransactionHash
+	typeNameJson["event_type"] = typeName
+	typeNameJson["key_fields"] = keyFields
+	// Raw felts, to re-decode the event without reindexing from chain
+	typeNameJson["raw_keys"] = event.Keys
+	typeNameJson["raw_data"] = event.Data
+	if event.EventIndex != nil {
+		typeNameJson["event_index"] = *event.EventIndex
+	}
+	if event.BlockHash != "" {
+		typeNameJson["block_hash"] = event.BlockHash
+	}
+	if event.BlockTimestamp != nil {
+		typeNameJson["block_timestamp"] = *event.BlockTimestamp
+	}
+	if event.FinalityStatus != "" {
+		typeNameJson["finality_status"] = event.FinalityStatus
 	}
+	return typeNameJson, nil
 }
@@ -0,0 +1,167 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Finality statuses of stored events, from least to most final
+const (
+	FinalityPreConfirmed = "PRE_CONFIRMED"
+	FinalityAcceptedOnL2 = "ACCEPTED_ON_L2"
+	FinalityAcceptedOnL1 = "ACCEPTED_ON_L1"
+)
+
+var finalityRanks = map[string]int{
+	FinalityPreConfirmed: 0,
+	FinalityAcceptedOnL2: 1,
+	FinalityAcceptedOnL1: 2,
+}
+
+// Interval between finality promotions of stored events
+const FinalityUpdateInterval = 1 * time.Minute
+
+// normalizeFinality returns the finality of an event, from the rpc when provided
+// Events without a block hash are pre-confirmed ( "PENDING" before rpc v0.9 )
+func normalizeFinality(event StarknetEvent) string {
+	switch event.FinalityStatus {
+	case FinalityPreConfirmed, FinalityAcceptedOnL2, FinalityAcceptedOnL1:
+		return event.FinalityStatus
+	case "PENDING":
+		return FinalityPreConfirmed
+	}
+	if event.BlockHash == "" {
+		return FinalityPreConfirmed
+	}
+	return FinalityAcceptedOnL2
+}
+
+// FinalityFilter returns the mongo filter on finality_status for events at least
+// as final as minFinality. Events stored before finality tracking count as ACCEPTED_ON_L2.
+func FinalityFilter(minFinality string) (bson.M, error) {
+	minRank, ok := finalityRanks[minFinality]
+	if !ok {
+		return nil, fmt.Errorf("invalid finality status: %s", minFinality)
+	}
+	statuses := bson.A{}
+	for _, status := range []string{FinalityPreConfirmed, FinalityAcceptedOnL2, FinalityAcceptedOnL1} {
+		if finalityRanks[status] >= minRank {
+			statuses = append(statuses, status)
+		}
+	}
+	if minRank <= finalityRanks[FinalityAcceptedOnL2] {
+		statuses = append(statuses, nil)
+	}
+	return bson.M{"$in": statuses}, nil
+}
+
+// Fields identifying an event document, events are received again as their
+// finality changes & when resubscribing
+var eventIdentityFields = []string{"contract_address", "registry_address", "transaction_hash", "event_index"}
+
+// Fields identifying an event document without an event index ( its receipt couldn't
+// be fetched ), identical events of a transaction share a document
+var eventContentFields = []string{"contract_address", "registry_address", "transaction_hash", "raw_keys", "raw_data"}
+
+// UpsertEventDocument stores a decoded event, replacing the stored document of the
+// same event if any, see EventStore.UpsertEvent
+func (r *Registry) UpsertEventDocument(ctx context.Context, collectionName string, document map[string]interface{}) error {
+	store := r.EventStore()
+	if store == nil {
+		return ErrNoEventStore
+	}
+	identityFields := eventIdentityFields
+	if _, ok := document["event_index"]; !ok {
+		identityFields = eventContentFields
+	}
+	identity := make(map[string]interface{}, len(identityFields))
+	for _, field := range identityFields {
+		if value, ok := document[field]; ok {
+			identity[field] = value
+		}
+	}
+	return store.UpsertEvent(ctx, collectionName, identity, document)
+}
+
+// PromoteFinality updates the finality of stored events whose block was accepted
+// on L2 or L1 since they were stored, returning the number of updated documents
+func (r *Registry) PromoteFinality(ctx context.Context) (int64, error) {
+	store := r.EventStore()
+	if store == nil {
+		return 0, ErrNoEventStore
+	}
+	updated := int64(0)
+	for _, collectionName := range []string{"events", "registry"} {
+		count, err := r.promoteFinality(ctx, store, collectionName, []string{FinalityPreConfirmed}, FinalityAcceptedOnL2)
+		updated += count
+		if err != nil {
+			return updated, err
+		}
+		count, err = r.promoteFinality(ctx, store, collectionName, []string{FinalityPreConfirmed, FinalityAcceptedOnL2}, FinalityAcceptedOnL1)
+		updated += count
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// promoteFinality moves the events with a finality in fromStatuses to toStatus, up
+// to the last block which reached toStatus. Blocks reach each status in order, so
+// the last one is found with a binary search over the blocks of the events.
+func (r *Registry) promoteFinality(ctx context.Context, store EventStore, collectionName string, fromStatuses []string, toStatus string) (int64, error) {
+	blockNumbers, err := store.FinalityBlocks(ctx, collectionName, fromStatuses)
+	if err != nil {
+		return 0, err
+	}
+	if len(blockNumbers) == 0 {
+		return 0, nil
+	}
+	sort.Slice(blockNumbers, func(i, j int) bool {
+		return blockNumbers[i] < blockNumbers[j]
+	})
+
+	// Number of leading blocks which reached toStatus
+	var checkErr error
+	reached := sort.Search(len(blockNumbers), func(i int) bool {
+		header, err := r.provider.BlockHeader(ctx, blockNumbers[i])
+		if err != nil {
+			if checkErr == nil && !provider.IsRpcError(err, provider.RpcErrBlockNotFound) {
+				checkErr = err
+			}
+			return true
+		}
+		rank, ok := finalityRanks[header.Status]
+		return !ok || rank < finalityRanks[toStatus]
+	})
+	if checkErr != nil {
+		return 0, checkErr
+	}
+	if reached == 0 {
+		return 0, nil
+	}
+
+	return store.PromoteFinality(ctx, collectionName, fromStatuses, blockNumbers[reached-1], toStatus, time.Now().UTC())
+}
+
+// StartFinalityUpdater promotes the finality of stored events every FinalityUpdateInterval
+func (r *Registry) StartFinalityUpdater() {
+	go func() {
+		ticker := time.NewTicker(FinalityUpdateInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			updated, err := r.PromoteFinality(context.Background())
+			if err != nil {
+				fmt.Println("Error updating event finality:", err)
+			}
+			if updated > 0 {
+				fmt.Println("Updated finality of", updated, "events")
+			}
+		}
+	}()
+}
@@ -0,0 +1,544 @@
+package registry
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/starknet.go/utils"
+	"github.com/b-j-roberts/foc-engine/internal/config"
+	"github.com/b-j-roberts/foc-engine/internal/fakenode"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+const (
+	testRegistryClassHash = "0xc0"
+	testRegistryAddress   = "0x1000"
+	testPlayer            = "0x9"
+)
+
+var testRegistryAbi = []map[string]interface{}{
+	{
+		"type": "event",
+		"name": "registry::ContractRegistered",
+		"kind": "struct",
+		"members": []interface{}{
+			map[string]interface{}{"name": "contract_address", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+			map[string]interface{}{"name": "class_hash", "type": "core::starknet::class_hash::ClassHash", "kind": "data"},
+		},
+	},
+	{
+		"type": "event",
+		"name": "registry::Event",
+		"kind": "enum",
+		"variants": []interface{}{
+			map[string]interface{}{"name": "ContractRegistered", "type": "registry::ContractRegistered", "kind": "nested"},
+		},
+	},
+}
+
+// memoryStore is an in-memory EventStore, for running the indexer without Mongo
+type memoryStore struct {
+	mutex sync.Mutex
+	// Map: Collection name -> documents, in insertion order
+	collections map[string][]map[string]interface{}
+	reorgs      []Reorg
+	deadLetters []DeadLetter
+	nextId      int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		collections: make(map[string][]map[string]interface{}),
+	}
+}
+
+func copyDocument(document map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(document))
+	for field, value := range document {
+		copied[field] = value
+	}
+	return copied
+}
+
+func (s *memoryStore) UpsertEvent(ctx context.Context, collectionName string, identity map[string]interface{}, document map[string]interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	document = copyDocument(document)
+	for i, existing := range s.collections[collectionName] {
+		if existing["reorged"] == true {
+			continue
+		}
+		matches := true
+		for field, value := range identity {
+			if !reflect.DeepEqual(existing[field], value) {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		existingFinality, _ := existing["finality_status"].(string)
+		newFinality, _ := document["finality_status"].(string)
+		if existingRank, ok := finalityRanks[existingFinality]; ok && existingRank > finalityRanks[newFinality] {
+			document["finality_status"] = existingFinality
+		}
+		document["_id"] = existing["_id"]
+		s.collections[collectionName][i] = document
+		return nil
+	}
+	s.nextId++
+	document["_id"] = s.nextId
+	s.collections[collectionName] = append(s.collections[collectionName], document)
+	return nil
+}
+
+func (s *memoryStore) FinalityBlocks(ctx context.Context, collectionName string, statuses []string) ([]uint, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	seen := make(map[uint]bool)
+	blockNumbers := []uint{}
+	for _, document := range s.collections[collectionName] {
+		blockNumber, _ := document["block_number"].(uint)
+		finality, _ := document["finality_status"].(string)
+		if document["reorged"] == true || seen[blockNumber] || !slices.Contains(statuses, finality) {
+			continue
+		}
+		seen[blockNumber] = true
+		blockNumbers = append(blockNumbers, blockNumber)
+	}
+	return blockNumbers, nil
+}
+
+func (s *memoryStore) PromoteFinality(ctx context.Context, collectionName string, fromStatuses []string, throughBlock uint, toStatus string, updatedAt time.Time) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	updated := int64(0)
+	for _, document := range s.collections[collectionName] {
+		blockNumber, _ := document["block_number"].(uint)
+		finality, _ := document["finality_status"].(string)
+		if document["reorged"] == true || blockNumber > throughBlock || !slices.Contains(fromStatuses, finality) {
+			continue
+		}
+		document["finality_status"] = toStatus
+		document["finality_updated_at"] = updatedAt
+		updated++
+	}
+	return updated, nil
+}
+
+func (s *memoryStore) LastEventBlock(ctx context.Context, collectionName string, addressField string, addresses []string) (uint, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	last, found := uint(0), false
+	for _, document := range s.collections[collectionName] {
+		address, _ := document[addressField].(string)
+		blockNumber, _ := document["block_number"].(uint)
+		if document["reorged"] == true || !slices.Contains(addresses, address) || (found && blockNumber <= last) {
+			continue
+		}
+		last, found = blockNumber, true
+	}
+	return last, found, nil
+}
+
+func (s *memoryStore) MarkReorged(ctx context.Context, collectionName string, fromBlock uint, toBlock uint, reorgedAt time.Time) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	marked := int64(0)
+	for _, document := range s.collections[collectionName] {
+		blockNumber, _ := document["block_number"].(uint)
+		if document["reorged"] == true || blockNumber < fromBlock || blockNumber > toBlock {
+			continue
+		}
+		document["reorged"] = true
+		document["reorged_at"] = reorgedAt
+		marked++
+	}
+	return marked, nil
+}
+
+func (s *memoryStore) InsertReorg(ctx context.Context, reorg Reorg) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reorgs = append(s.reorgs, reorg)
+	return nil
+}
+
+func (s *memoryStore) InsertDeadLetter(ctx context.Context, deadLetter DeadLetter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.deadLetters = append(s.deadLetters, deadLetter)
+	return nil
+}
+
+// documents returns the stored documents of a collection
+func (s *memoryStore) documents(collectionName string) []map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	documents := []map[string]interface{}{}
+	for _, document := range s.collections[collectionName] {
+		documents = append(documents, copyDocument(document))
+	}
+	return documents
+}
+
+func (s *memoryStore) reorgCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.reorgs)
+}
+
+// eventually fails the test if condition isn't true within a few seconds
+func eventually(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func registeredEvent(contractAddress string, classHash string) fakenode.Event {
+	return fakenode.Event{
+		FromAddress: testRegistryAddress,
+		Keys:        []string{ContractRegisteredEvent, contractAddress},
+		Data:        []string{classHash},
+	}
+}
+
+func movedEvent(x string) fakenode.Event {
+	return fakenode.Event{
+		FromAddress: testContractAddress,
+		Keys:        []string{utils.GetSelectorFromNameFelt("Moved").String(), testPlayer},
+		Data:        []string{x},
+	}
+}
+
+// startTestIndexer runs the indexer of a registry against the node, storing into an
+// in-memory store, & subscribes to the test registry
+func startTestIndexer(t *testing.T, node *fakenode.Node) (*memoryStore, *Registry) {
+	t.Helper()
+	store := newMemoryStore()
+	return store, startTestIndexerWithOptions(t, node, RegistryOptions{EventStore: store})
+}
+
+// startTestIndexerWithOptions runs the indexer of a registry with options against the node,
+// ex: with the documents of a previous run. The indexer uses WebSocket subscriptions unless
+// options.Config sets another mode
+func startTestIndexerWithOptions(t *testing.T, node *fakenode.Node, options RegistryOptions) *Registry {
+	t.Helper()
+	node.SetClass(testRegistryClassHash, testClass(t, testRegistryAbi))
+	node.DeployContract(testRegistryAddress, testRegistryClassHash)
+
+	starknetProvider := node.Provider()
+	options.Provider = starknetProvider
+	focRegistry := newTestRegistry(t, options)
+	indexerConfig := options.Config
+	if indexerConfig.Mode == "" {
+		indexerConfig.Mode = provider.IndexerModeWebSocket
+	}
+	err := starknetProvider.StartIndexer(provider.IndexerOptions{
+		Config:                   indexerConfig,
+		ProcessStarknetEventData: focRegistry.ProcessStarknetEventData,
+		ContractResumeBlock:      focRegistry.GetContractResumeBlock,
+		OnReorg:                  focRegistry.ProcessReorg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(starknetProvider.Close)
+
+	focRegistry.AddRegistryAddress(testRegistryAddress)
+	if err := starknetProvider.SubscribeEvents(testRegistryAddress); err != nil {
+		t.Fatal(err)
+	}
+	return focRegistry
+}
+
+// movedDocuments returns the stored Moved events, by block hash
+func movedDocuments(store *memoryStore) map[string]map[string]interface{} {
+	documents := make(map[string]map[string]interface{})
+	for _, document := range store.documents("events") {
+		if document["event_type"] == "game::Moved" {
+			documents[document["block_hash"].(string)] = document
+		}
+	}
+	return documents
+}
+
+func TestIndexerBackfillsThenSubscribes(t *testing.T) {
+	node := newTestNode(t)
+	registration := node.AddBlock(registeredEvent(testContractAddress, testClassHash))
+	past := node.AddBlock(movedEvent("0x1"))
+	store, focRegistry := startTestIndexer(t, node)
+
+	eventually(t, "the backfilled events", func() bool {
+		return len(store.documents("registry")) == 1 && len(movedDocuments(store)) == 1
+	})
+	live := node.AddBlock(movedEvent("0x2"))
+	eventually(t, "the subscribed event", func() bool {
+		return len(movedDocuments(store)) == 2
+	})
+
+	registryDocument := store.documents("registry")[0]
+	if registryDocument["block_hash"] != registration.Hash {
+		t.Errorf("registry block hash = %v, want %s", registryDocument["block_hash"], registration.Hash)
+	}
+	if _, ok := focRegistry.GetRegisteredContract(testContractAddress); !ok {
+		t.Error("contract not registered")
+	}
+	documents := movedDocuments(store)
+	for _, block := range []*fakenode.Block{past, live} {
+		document, ok := documents[block.Hash]
+		if !ok {
+			t.Fatalf("no event stored for block %d", block.Number)
+		}
+		if document["block_number"] != uint(block.Number) || document["block_timestamp"] != block.Timestamp {
+			t.Errorf("block %d event = %v", block.Number, document)
+		}
+		if document["finality_status"] != FinalityAcceptedOnL2 {
+			t.Errorf("block %d event finality = %v", block.Number, document["finality_status"])
+		}
+		// Receipts are only fetched with Indexer.EnrichReceipts
+		if _, ok := document["event_index"]; ok {
+			t.Errorf("block %d event has an event index without receipts", block.Number)
+		}
+	}
+	if x := documents[live.Hash]["x"]; x != uint64(2) {
+		t.Errorf("live event x = %#v, want 2", x)
+	}
+	// The subscription replaying the backfilled block isn't stored again
+	if count := len(store.documents("events")); count != 2 {
+		t.Errorf("stored %d events, want 2", count)
+	}
+}
+
+func TestIndexerReorg(t *testing.T) {
+	node := newTestNode(t)
+	node.AddBlock(registeredEvent(testContractAddress, testClassHash))
+	store, _ := startTestIndexer(t, node)
+	eventually(t, "the registration", func() bool {
+		return len(store.documents("registry")) == 1
+	})
+	kept := node.AddBlock(movedEvent("0x1"))
+	reverted := node.AddBlock(movedEvent("0x2"))
+	eventually(t, "the events before the reorg", func() bool {
+		return len(movedDocuments(store)) == 2
+	})
+
+	node.Reorg(reverted.Number)
+	eventually(t, "the reorg", func() bool {
+		return store.reorgCount() == 1
+	})
+	replacement := node.AddBlock(movedEvent("0x3"))
+	eventually(t, "the event of the new chain", func() bool {
+		_, ok := movedDocuments(store)[replacement.Hash]
+		return ok
+	})
+
+	documents := movedDocuments(store)
+	if documents[kept.Hash]["reorged"] == true {
+		t.Error("event before the fork marked as reorged")
+	}
+	if documents[reverted.Hash]["reorged"] != true {
+		t.Error("reverted event not marked as reorged")
+	}
+	if documents[replacement.Hash]["reorged"] == true || documents[replacement.Hash]["block_number"] != uint(reverted.Number) {
+		t.Errorf("new chain event = %v", documents[replacement.Hash])
+	}
+	if count := len(store.documents("events")); count != 3 {
+		t.Errorf("stored %d events, want 3", count)
+	}
+	if reorg := store.reorgs[0]; reorg.StartingBlockNumber != uint(reverted.Number) || reorg.EventsReorged != 1 {
+		t.Errorf("reorg = %+v", reorg)
+	}
+}
+
+func TestIndexerPolling(t *testing.T) {
+	node := newTestNode(t)
+	node.AddBlock(registeredEvent(testContractAddress, testClassHash))
+	past := node.AddBlock(movedEvent("0x1"))
+	store := newMemoryStore()
+	focRegistry := startTestIndexerWithOptions(t, node, RegistryOptions{
+		EventStore: store,
+		Config:     config.IndexerConfig{Mode: provider.IndexerModePolling, PollInterval: 1},
+	})
+	starknetProvider := focRegistry.Provider().(*provider.RpcProvider)
+	if !starknetProvider.IsPolling() {
+		t.Fatal("provider not polling")
+	}
+	if node.Subscriptions() != 0 {
+		t.Errorf("polling provider has %d subscriptions", node.Subscriptions())
+	}
+	eventually(t, "the backfilled event", func() bool {
+		_, ok := movedDocuments(store)[past.Hash]
+		return ok
+	})
+	reverted := node.AddBlock(movedEvent("0x2"))
+	eventually(t, "the polled event", func() bool {
+		_, ok := movedDocuments(store)[reverted.Hash]
+		return ok
+	})
+
+	// The replaced block is detected from its hash by pollBlockHeaders
+	node.Reorg(reverted.Number)
+	replacement := node.AddBlock(movedEvent("0x3"))
+	eventually(t, "the reorg & the event of the new chain", func() bool {
+		_, ok := movedDocuments(store)[replacement.Hash]
+		return store.reorgCount() == 1 && ok
+	})
+
+	documents := movedDocuments(store)
+	if documents[past.Hash]["reorged"] == true {
+		t.Error("event before the fork marked as reorged")
+	}
+	if documents[reverted.Hash]["reorged"] != true {
+		t.Error("reverted event not marked as reorged")
+	}
+	if count := len(store.documents("events")); count != 3 {
+		t.Errorf("stored %d events, want 3", count)
+	}
+	if reorg := store.reorgs[0]; reorg.StartingBlockNumber != uint(reverted.Number) {
+		t.Errorf("reorg = %+v", reorg)
+	}
+}
+
+func TestIndexerEventIndexFromReceipts(t *testing.T) {
+	node := newTestNode(t)
+	node.AddBlock(registeredEvent(testContractAddress, testClassHash))
+	// Identical events of a transaction, after an event of another contract
+	transaction := []fakenode.Event{
+		{FromAddress: "0xdef", Keys: []string{"0x1"}, TransactionHash: "0x7e"},
+		movedEvent("0x1"),
+		movedEvent("0x1"),
+	}
+	transaction[1].TransactionHash = "0x7e"
+	transaction[2].TransactionHash = "0x7e"
+	node.AddBlock(transaction...)
+	store := newMemoryStore()
+	starknetProvider := startTestIndexerWithOptions(t, node, RegistryOptions{
+		EventStore: store,
+		Config:     config.IndexerConfig{EnrichReceipts: true},
+	}).Provider()
+	eventually(t, "the backfilled events", func() bool {
+		return len(store.documents("events")) == 2
+	})
+
+	// Replayed by the backfill of the reconnect
+	reconnectedAt := time.Now().UTC()
+	node.DropConnections()
+	eventually(t, "the resubscriptions", func() bool {
+		subscriptions := starknetProvider.GetSubscriptions()
+		for _, subscription := range subscriptions {
+			if subscription.Status != provider.SubscriptionActive || !subscription.SubscribedAt.After(reconnectedAt) {
+				return false
+			}
+		}
+		return len(subscriptions) == 2
+	})
+
+	documents := store.documents("events")
+	if len(documents) != 2 {
+		t.Fatalf("stored %d events, want 2", len(documents))
+	}
+	indexes := map[interface{}]bool{}
+	for _, document := range documents {
+		indexes[document["event_index"]] = true
+		if document["sender_address"] != fakenode.DefaultSender {
+			t.Errorf("event sender = %v, want %s", document["sender_address"], fakenode.DefaultSender)
+		}
+	}
+	if !indexes[uint(1)] || !indexes[uint(2)] {
+		t.Errorf("event indexes = %v, want 1 & 2", indexes)
+	}
+}
+
+func TestPromoteFinality(t *testing.T) {
+	node := newTestNode(t)
+	node.AddBlock(registeredEvent(testContractAddress, testClassHash))
+	accepted := node.AddBlock(movedEvent("0x1"))
+	pending := node.AddBlock(movedEvent("0x2"))
+	store, focRegistry := startTestIndexer(t, node)
+	eventually(t, "the backfilled events", func() bool {
+		return len(movedDocuments(store)) == 2
+	})
+
+	node.AcceptOnL1(accepted.Number)
+	updated, err := focRegistry.PromoteFinality(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The registration & the first event
+	if updated != 2 {
+		t.Errorf("promoted %d events, want 2", updated)
+	}
+	documents := movedDocuments(store)
+	if finality := documents[accepted.Hash]["finality_status"]; finality != FinalityAcceptedOnL1 {
+		t.Errorf("accepted block event finality = %v", finality)
+	}
+	if finality := documents[pending.Hash]["finality_status"]; finality != FinalityAcceptedOnL2 {
+		t.Errorf("pending block event finality = %v", finality)
+	}
+
+	// Storing the event again doesn't downgrade its finality
+	replayed := copyDocument(documents[accepted.Hash])
+	delete(replayed, "_id")
+	replayed["finality_status"] = FinalityAcceptedOnL2
+	if err := focRegistry.UpsertEventDocument(context.Background(), "events", replayed); err != nil {
+		t.Fatal(err)
+	}
+	if finality := movedDocuments(store)[accepted.Hash]["finality_status"]; finality != FinalityAcceptedOnL1 {
+		t.Errorf("replayed event finality = %v, want %s", finality, FinalityAcceptedOnL1)
+	}
+	if count := len(store.documents("events")); count != 2 {
+		t.Errorf("stored %d events, want 2", count)
+	}
+}
+
+func TestIndexerResumesFromContractCursor(t *testing.T) {
+	node := newTestNode(t)
+	node.AddBlock(registeredEvent(testContractAddress, testClassHash))
+	before := node.AddBlock(movedEvent("0x1"))
+	last := node.AddBlock(movedEvent("0x2"))
+	node.AddBlock()
+	// Stored before a restart
+	store := newMemoryStore()
+	store.UpsertEvent(context.Background(), "events", nil, map[string]interface{}{
+		"contract_address": testContractAddress,
+		"block_number":     uint(last.Number),
+		"block_hash":       last.Hash,
+		"event_type":       "game::Moved",
+	})
+	starknetProvider := startTestIndexerWithOptions(t, node, RegistryOptions{EventStore: store}).Provider()
+
+	eventually(t, "the contract subscription", func() bool {
+		for _, subscription := range starknetProvider.GetSubscriptions() {
+			if subscription.Address == testContractAddress {
+				return subscription.Status == provider.SubscriptionActive
+			}
+		}
+		return false
+	})
+	for _, subscription := range starknetProvider.GetSubscriptions() {
+		if subscription.Address != testContractAddress {
+			continue
+		}
+		if subscription.FromBlock != uint(last.Number) {
+			t.Errorf("contract subscribed from block %d, want %d", subscription.FromBlock, last.Number)
+		}
+		if subscription.ProcessedThrough == nil || *subscription.ProcessedThrough != uint(node.Head().Number) {
+			t.Errorf("contract processed through %v, want %d", subscription.ProcessedThrough, node.Head().Number)
+		}
+	}
+	// Blocks before the cursor aren't backfilled again
+	if _, ok := movedDocuments(store)[before.Hash]; ok {
+		t.Error("event before the contract cursor backfilled")
+	}
+}
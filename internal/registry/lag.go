@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// processedBlock is the last block a registry processed an event from
+type processedBlock struct {
+	mutex       sync.Mutex
+	blockNumber uint
+	timestamp   uint64
+	processedAt time.Time
+}
+
+func (r *Registry) trackProcessedBlock(event StarknetEvent) {
+	processed := &r.processed
+	processed.mutex.Lock()
+	defer processed.mutex.Unlock()
+	if event.BlockNumber < processed.blockNumber {
+		return
+	}
+	processed.blockNumber = event.BlockNumber
+	if event.BlockTimestamp != nil {
+		processed.timestamp = *event.BlockTimestamp
+	}
+	processed.processedAt = time.Now().UTC()
+}
+
+// rollbackProcessedBlock resets the last processed block to before a reorg fork point
+func (r *Registry) rollbackProcessedBlock(blockNumber uint) {
+	processed := &r.processed
+	processed.mutex.Lock()
+	defer processed.mutex.Unlock()
+	if processed.blockNumber < blockNumber {
+		return
+	}
+	processed.blockNumber = 0
+	processed.timestamp = 0
+	if blockNumber > 0 {
+		processed.blockNumber = blockNumber - 1
+		if heads := r.provider.ChainHeads(); heads != nil {
+			if header, ok := heads.Get(blockNumber - 1); ok {
+				processed.timestamp = header.Timestamp
+			}
+		}
+	}
+}
+
+// IndexerLag compares the last block with indexed events to the chain head
+// The lag only shrinks when events are received, so it grows between events of
+// quiet contracts even when the indexer is caught up
+type IndexerLag struct {
+	HeadBlock              uint      `json:"head_block"`
+	HeadTimestamp          uint64    `json:"head_timestamp"`
+	HeadReceivedAt         time.Time `json:"head_received_at"`
+	LastProcessedBlock     uint      `json:"last_processed_block"`
+	LastProcessedTimestamp uint64    `json:"last_processed_timestamp"`
+	LastProcessedAt        time.Time `json:"last_processed_at"`
+	LastCompletedBlock     uint      `json:"last_completed_block"`
+	LagBlocks              uint      `json:"lag_blocks"`
+	LagSeconds             uint64    `json:"lag_seconds"`
+}
+
+// GetIndexerLag returns the lag of the indexer behind the chain head
+func (r *Registry) GetIndexerLag() (*IndexerLag, error) {
+	heads := r.provider.ChainHeads()
+	if heads == nil {
+		return nil, fmt.Errorf("provider doesn't track chain heads")
+	}
+	head, receivedAt, ok := heads.Head()
+	if !ok {
+		return nil, fmt.Errorf("no chain head received yet")
+	}
+	processed := &r.processed
+	processed.mutex.Lock()
+	lag := &IndexerLag{
+		HeadBlock:              head.BlockNumber,
+		HeadTimestamp:          head.Timestamp,
+		HeadReceivedAt:         receivedAt,
+		LastProcessedBlock:     processed.blockNumber,
+		LastProcessedTimestamp: processed.timestamp,
+		LastProcessedAt:        processed.processedAt,
+	}
+	processed.mutex.Unlock()
+	lag.LastCompletedBlock = r.GetLastCompletedBlock()
+	if head.BlockNumber > lag.LastProcessedBlock {
+		lag.LagBlocks = head.BlockNumber - lag.LastProcessedBlock
+	}
+	if lag.LastProcessedTimestamp != 0 && head.Timestamp > lag.LastProcessedTimestamp {
+		lag.LagSeconds = head.Timestamp - lag.LastProcessedTimestamp
+	}
+	return lag, nil
+}
@@ -2,131 +2,47 @@ package registry
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
-
-	"github.com/NethermindEth/starknet.go/contracts"
-	"github.com/NethermindEth/starknet.go/utils"
+	"strings"
 )
 
 func GetEventTypeName(eventSelector string, abi []interface{}) (string, error) {
+	typeName, _, err := ResolveEventType([]string{eventSelector}, abi)
+	return typeName, err
+}
+
+// ResolveEventType finds the event struct type for an event's keys
+// Returns the full event type path & the number of leading keys which were selectors
+// Prefer RegisteredContract.Decoder when decoding many events from the same abi
+func ResolveEventType(keys []string, abi []interface{}) (string, int, error) {
 	if abi == nil {
-		return "", fmt.Errorf("abi is nil")
+		return "", 0, fmt.Errorf("abi is nil")
 	}
-	/*
-	  var nestedAbi contracts.NestedString
-	  if err := nestedAbi.UnmarshalJSON([]byte(abi)); err != nil {
-	    return "", fmt.Errorf("failed to unmarshal abi: %v", err)
-	  }
-	  fmt.Println("Nested ABI:", nestedAbi)
-	*/
-	for _, abiEntry := range abi {
-		checkABI, ok := abiEntry.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		abiType, ok := checkABI["type"].(string)
-		if !ok {
-			continue
-		}
-		switch abiType {
-		case string(contracts.ABITypeConstructor), string(contracts.ABITypeFunction), string(contracts.ABITypeL1Handler):
-			//TODO: fmt.Println("ABI Function Entry:", abiEntry)
-			continue
-		case string(contracts.ABITypeStruct):
-			// TODO: fmt.Println("ABI Struct Entry:", abiEntry)
-			continue
-		case string(contracts.ABITypeEvent):
-			// Example output for event types
-			/*
-			   indexer-1          | ABI Event Entry: map[kind:enum name:pow_game::pow::PowGame::Event type:event variants:[map[kind:nested name:ChainUnlocked type:pow_game::pow::PowGame::ChainUnlocked] map[kind:nested name:BalanceUpdated type:pow_game::pow::PowGame::BalanceUpdated] map[kind:nested name:TransactionAdded type:pow_game::actions::TransactionAdded] map[kind:nested name:BlockMined type:pow_game::actions::BlockMined] map[kind:nested name:DAStored type:pow_game::actions::DAStored] map[kind:nested name:ProofStored type:pow_game::actions::ProofStored] map[kind:flat name:UpgradeEvent type:pow_game::upgrades::component::PowUpgradesComponent::Event] map[kind:flat name:TransactionEvent type:pow_game::transactions::component::PowTransactionsComponent::Event] map[kind:flat name:PrestigeEvent type:pow_game::prestige::component::PrestigeComponent::Event] map[kind:flat name:BuilderEvent type:pow_game::builder::component::BuilderComponent::Event]]]
-
-			*/
-			// If event entry ends with "<ContractName::EventName>" ending
-			//if stringEndsWith(checkABI["name"].(string), "::"+ContractName+"::Event") {
-			if stringEndsWith(checkABI["name"].(string), "::Event") {
-				// Loop through variants
-				for _, variant := range checkABI["variants"].([]interface{}) {
-					variantEntry, ok := variant.(map[string]interface{})
-					if !ok {
-						continue
-					}
-					variantName, ok := variantEntry["name"].(string)
-					if !ok {
-						continue
-					}
-					// Check if variant name is the same as event selector
-					if utils.GetSelectorFromNameFelt(variantName).String() == eventSelector {
-						variantType, ok := variantEntry["type"].(string)
-						if !ok {
-							continue
-						}
-						// Remove prefix from variantType
-						// Example: "pow_game::pow::PowGame::ChainUnlocked" -> "ChainUnlocked"
-						//variantType = variantType[strings.LastIndex(variantType, "::")+2:]
-						return variantType, nil
-					}
-				}
-			}
-		default:
-			// fmt.Println("Unknown ABI Entry:", abiType)
-			continue
-		}
+	event, selectorCount, err := NewContractDecoder(abi).ResolveEvent(keys)
+	if err != nil {
+		return "", 0, err
 	}
+	return event.TypeName, selectorCount, nil
+}
 
-	return "", fmt.Errorf("event not found")
+// DecodeEvent decodes an event struct's members from the event keys & data
+func DecodeEvent(typeName string, abis []interface{}, keys []string, data []string) (map[string]interface{}, []string, error) {
+	return NewTypeIndex(abis).DecodeEvent(typeName, keys, data)
 }
 
-// TODO: Check valid data
-// TODO: Parse data based on type
-func StarknetTypeDataMin(typeName string, abis []interface{}, data []string) (interface{}, int) {
-	if IsPrimitiveType(typeName) {
-		return StarknetStringToTypedData(typeName, data[0]), 1
-	} else if IsArrayType(typeName) {
-		arrayType := GetArrayInnerType(typeName)
-		arrayLen, err := strconv.ParseUint(data[0], 0, 32)
-		data = data[1:]
-		if err != nil {
-			fmt.Println("Error parsing array length:", err)
-			return nil, 0
-		}
-		var arrayData []interface{}
-		totalOffset := 1
-		for i := 0; i < int(arrayLen); i++ {
-			value, offset := StarknetTypeDataMin(arrayType, abis, data)
-			arrayData = append(arrayData, value)
-			data = data[offset:]
-			totalOffset += offset
-		}
-		return arrayData, totalOffset
-	} else if IsStructType(typeName) {
-		fields := map[string]interface{}{}
-		totalOffset := 0
-		for _, abi := range abis {
-			if abi.(map[string]interface{})["name"] == typeName ||
-				stringEndsWith(abi.(map[string]interface{})["name"].(string), "::"+typeName) {
-				for _, member := range abi.(map[string]interface{})["members"].([]interface{}) {
-					memberName := member.(map[string]interface{})["name"]
-					value, offset := StarknetTypeDataMin(member.(map[string]interface{})["type"].(string), abis, data)
-					fields[memberName.(string)] = value
-					data = data[offset:]
-					totalOffset += offset
-				}
-				break
-			}
-		}
-		return fields, totalOffset
-	}
-	return nil, 0
+// StarknetTypeDataMin decodes a value of typeName from the start of data
+// Returns the decoded value and the number of felts consumed
+func StarknetTypeDataMin(typeName string, abis []interface{}, data []string) (interface{}, int, error) {
+	return NewTypeIndex(abis).DecodeType(typeName, data)
 }
 
-func StarknetStringToTypedData(typeName string, data string) interface{} {
-	if IsPrimitiveType(typeName) {
-		return StarknetTypeParsers[typeName](typeName, data)
-	} else {
-		fmt.Println("Not a primitive type")
-		// TODO: Error?
+func StarknetStringToTypedData(typeName string, data string) (interface{}, error) {
+	parser, ok := StarknetTypeParsers[typeName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not a single felt primitive", ErrUnknownType, typeName)
 	}
-	return nil
+	return parser(typeName, data)
 }
 
 func IsArrayType(typeName string) bool {
@@ -157,8 +73,110 @@ func GetArrayInnerType(typeName string) string {
 	return ""
 }
 
+// Tuples are written as "(type1, type2, ...)"
+func IsTupleType(typeName string) bool {
+	return stringStartsWith(typeName, "(") && stringEndsWith(typeName, ")")
+}
+
+// GetTupleInnerTypes returns the types of each tuple element
+// Example: "(core::felt252, core::integer::u32)" -> ["core::felt252", "core::integer::u32"]
+func GetTupleInnerTypes(typeName string) []string {
+	return splitTypeList(typeName[1 : len(typeName)-1])
+}
+
+// Fixed size arrays are written as "[type; length]"
+func IsFixedArrayType(typeName string) bool {
+	return stringStartsWith(typeName, "[") && stringEndsWith(typeName, "]")
+}
+
+// GetFixedArrayInfo returns the inner type & length of a fixed size array
+// Example: "[core::integer::u8; 9]" -> "core::integer::u8", 9
+func GetFixedArrayInfo(typeName string) (string, int, error) {
+	inner := typeName[1 : len(typeName)-1]
+	// Split on the last top level ';' since the inner type may be a nested fixed array
+	sep := -1
+	depth := 0
+	for i, c := range inner {
+		switch c {
+		case '<', '(', '[':
+			depth++
+		case '>', ')', ']':
+			depth--
+		case ';':
+			if depth == 0 {
+				sep = i
+			}
+		}
+	}
+	if sep == -1 {
+		return "", 0, fmt.Errorf("missing length in fixed array type: %s", typeName)
+	}
+	arrayLen, err := strconv.ParseUint(strings.TrimSpace(inner[sep+1:]), 0, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid length in fixed array type %s: %v", typeName, err)
+	}
+	return strings.TrimSpace(inner[:sep]), int(arrayLen), nil
+}
+
+func IsCoreEnumType(typeName string) bool {
+	for _, enum := range Types.Enum {
+		if stringStartsWith(typeName, enum.Type+"<") ||
+			stringStartsWith(typeName, enum.Type+"::<") {
+			return true
+		}
+	}
+	return false
+}
+
+func IsUnitType(typeName string) bool {
+	return typeName == "()" || typeName == ""
+}
+
+type EnumVariant struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// GetGenericInnerType returns the generic arguments of a type
+// Example: "core::option::Option::<core::integer::u32>" -> "core::integer::u32"
+func GetGenericInnerType(typeName string) string {
+	start := strings.Index(typeName, "<")
+	end := strings.LastIndex(typeName, ">")
+	if start == -1 || end == -1 || end < start {
+		return ""
+	}
+	return typeName[start+1 : end]
+}
+
+// splitTypeList splits a comma separated list of types, ignoring commas inside of
+// nested generics, tuples and fixed size arrays
+// Example: "core::felt252, (core::integer::u8, core::bool)" -> ["core::felt252", "(core::integer::u8, core::bool)"]
+func splitTypeList(typeList string) []string {
+	types := []string{}
+	depth := 0
+	start := 0
+	for i, c := range typeList {
+		switch c {
+		case '<', '(', '[':
+			depth++
+		case '>', ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, strings.TrimSpace(typeList[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(typeList[start:]); last != "" {
+		types = append(types, last)
+	}
+	return types
+}
+
 func IsStructType(typeName string) bool {
-	return !IsPrimitiveType(typeName) && !IsArrayType(typeName)
+	return !IsPrimitiveType(typeName) && !IsArrayType(typeName) &&
+		!IsTupleType(typeName) && !IsFixedArrayType(typeName)
 }
 
 func IsPrimitiveType(typeName string) bool {
@@ -178,6 +196,13 @@ type TypeInfo struct {
 type TypesInfo struct {
 	Primitives []TypeInfo `json:"primitives"`
 	Array      []TypeInfo `json:"array"`
+	Enum       []TypeInfo `json:"enum"`
+}
+
+// Variant names of core enums, in variant index order
+var CoreEnumVariants = map[string][]string{
+	"core::option::Option": {"Some", "None"},
+	"core::result::Result": {"Ok", "Err"},
 }
 
 var Types = TypesInfo{
@@ -273,6 +298,16 @@ var Types = TypesInfo{
 			Name: "span",
 		},
 	},
+	Enum: []TypeInfo{
+		{
+			Type: "core::option::Option",
+			Name: "option",
+		},
+		{
+			Type: "core::result::Result",
+			Name: "result",
+		},
+	},
 }
 
 // TODO: Improve "snapshot" types
@@ -284,109 +319,212 @@ func stringEndsWith(s string, suffix string) bool {
 	return len(s) >= len(suffix) && s[len(s)-len(suffix):] == suffix
 }
 
-var StarknetTypeParsers = map[string]func(string, string) interface{}{
-	"core::byte_array::ByteArray": func(typeName string, data string) interface{} {
-		// TODO: Parse byte array
-		return data
+// Parsers for primitive types serialized over multiple felts
+// Returns the parsed value and the number of felts consumed
+var StarknetMultiFeltParsers = map[string]func(string, []string) (interface{}, int, error){
+	"core::byte_array::ByteArray": func(typeName string, data []string) (interface{}, int, error) {
+		return ParseByteArray(data)
 	},
-	"core::felt252": func(typeName string, data string) interface{} {
-		return data
+	"core::integer::u256": func(typeName string, data []string) (interface{}, int, error) {
+		if len(data) < 2 {
+			return nil, 0, ErrNotEnoughFelts
+		}
+		low, ok := new(big.Int).SetString(data[0], 0)
+		if !ok || low.Sign() < 0 || low.BitLen() > 128 {
+			return nil, 0, fmt.Errorf("%w: u256 low %s", ErrInvalidValue, data[0])
+		}
+		high, ok := new(big.Int).SetString(data[1], 0)
+		if !ok || high.Sign() < 0 || high.BitLen() > 128 {
+			return nil, 0, fmt.Errorf("%w: u256 high %s", ErrInvalidValue, data[1])
+		}
+		val := new(big.Int).Lsh(high, 128)
+		val.Or(val, low)
+		return NewBigIntValue(val, nil), 2, nil
+	},
+}
+
+// Starknet field prime : 2^251 + 17 * 2^192 + 1
+var FeltPrime, _ = new(big.Int).SetString("0x800000000000011000000000000000000000000000000000000000000000001", 0)
+
+var (
+	i128Max  = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1))
+	i128Min  = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 127))
+	i128Bias = new(big.Int).Lsh(big.NewInt(1), 127)
+)
+
+// BigIntValue holds integers too wide for int64/uint64 ( u128, u256, i128 )
+// Value is the decimal string for display, SortKey is a fixed width hex string
+// which sorts & range queries in the same order as the integer in Mongo
+type BigIntValue struct {
+	Value   string `json:"value" bson:"value"`
+	SortKey string `json:"sort_key" bson:"sort_key"`
+}
+
+// Hex digits used for BigIntValue sort keys ( 256 bits )
+const bigIntSortKeyDigits = 64
+
+// NewBigIntValue builds a BigIntValue from val, adding bias to the sort key so
+// signed values stay non-negative and ordered
+func NewBigIntValue(val *big.Int, bias *big.Int) BigIntValue {
+	sortVal := new(big.Int).Set(val)
+	if bias != nil {
+		sortVal.Add(sortVal, bias)
+	}
+	return BigIntValue{
+		Value:   val.String(),
+		SortKey: fmt.Sprintf("0x%0*x", bigIntSortKeyDigits, sortVal),
+	}
+}
+
+// Number of bytes stored in each full word of a ByteArray
+const byteArrayWordSize = 31
+
+// ParseByteArray decodes a serialized core::byte_array::ByteArray into a string
+// Layout: [data_len, data_word_0, ..., data_word_n, pending_word, pending_word_len]
+func ParseByteArray(data []string) (string, int, error) {
+	if len(data) < 1 {
+		return "", 0, ErrNotEnoughFelts
+	}
+	dataLen, err := strconv.ParseUint(data[0], 0, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid byte array data length: %v", err)
+	}
+	totalOffset := int(dataLen) + 3
+	if len(data) < totalOffset {
+		return "", 0, fmt.Errorf("%w: byte array needs %d felts, got %d", ErrNotEnoughFelts, totalOffset, len(data))
+	}
+
+	bytes := make([]byte, 0, int(dataLen)*byteArrayWordSize)
+	for i := 1; i <= int(dataLen); i++ {
+		word, err := feltToBytes(data[i], byteArrayWordSize)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid byte array word %d: %v", i-1, err)
+		}
+		bytes = append(bytes, word...)
+	}
+	pendingWordLen, err := strconv.ParseUint(data[dataLen+2], 0, 8)
+	if err != nil || pendingWordLen >= byteArrayWordSize {
+		return "", 0, fmt.Errorf("invalid byte array pending word length: %s", data[dataLen+2])
+	}
+	pendingWord, err := feltToBytes(data[dataLen+1], int(pendingWordLen))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid byte array pending word: %v", err)
+	}
+	bytes = append(bytes, pendingWord...)
+
+	return strings.ToValidUTF8(string(bytes), "\uFFFD"), totalOffset, nil
+}
+
+// feltToBytes converts a felt hex string into its big endian representation,
+// left padded to size bytes
+func feltToBytes(felt string, size int) ([]byte, error) {
+	value, ok := new(big.Int).SetString(felt, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid felt: %s", felt)
+	}
+	if value.Sign() < 0 || value.BitLen() > size*8 {
+		return nil, fmt.Errorf("felt %s does not fit in %d bytes", felt, size)
+	}
+	return value.FillBytes(make([]byte, size)), nil
+}
+
+// parseSignedFelt parses a signed integer of bits size, negative values are
+// encoded as FeltPrime - |val|
+func parseSignedFelt(data string, bits int) (int64, error) {
+	val, ok := new(big.Int).SetString(data, 0)
+	if !ok || val.Sign() < 0 || val.Cmp(FeltPrime) >= 0 {
+		return 0, ErrInvalidValue
+	}
+	if val.BitLen() >= bits {
+		val.Sub(val, FeltPrime)
+	}
+	if !val.IsInt64() {
+		return 0, ErrInvalidValue
+	}
+	return strconv.ParseInt(val.String(), 10, bits)
+}
+
+// Parsers for primitive types serialized as a single felt
+var StarknetTypeParsers = map[string]func(string, string) (interface{}, error){
+	"core::felt252": func(typeName string, data string) (interface{}, error) {
+		return data, nil
 	},
-	"core::integer::u8": func(typeName string, data string) interface{} {
+	"core::integer::u8": func(typeName string, data string) (interface{}, error) {
 		val, err := strconv.ParseUint(data, 0, 8)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		return val
+		return val, nil
 	},
-	"core::integer::u16": func(typeName string, data string) interface{} {
+	"core::integer::u16": func(typeName string, data string) (interface{}, error) {
 		val, err := strconv.ParseUint(data, 0, 16)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		return val
+		return val, nil
 	},
-	"core::integer::u32": func(typeName string, data string) interface{} {
+	"core::integer::u32": func(typeName string, data string) (interface{}, error) {
 		val, err := strconv.ParseUint(data, 0, 32)
 		if err != nil {
-			fmt.Println(err)
-			return nil
+			return nil, err
 		}
-		return val
+		return val, nil
 	},
-	"core::integer::u64": func(typeName string, data string) interface{} {
+	"core::integer::u64": func(typeName string, data string) (interface{}, error) {
 		val, err := strconv.ParseUint(data, 0, 64)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		return val
+		return val, nil
 	},
-	"core::integer::u128": func(typeName string, data string) interface{} {
-		// TODO: not u128
-		val, err := strconv.ParseUint(data, 0, 64)
-		if err != nil {
-			return nil
+	"core::integer::u128": func(typeName string, data string) (interface{}, error) {
+		val, ok := new(big.Int).SetString(data, 0)
+		if !ok || val.Sign() < 0 || val.BitLen() > 128 {
+			return nil, ErrInvalidValue
 		}
-		return val
+		return NewBigIntValue(val, nil), nil
 	},
-	"core::integer::u256": func(typeName string, data string) interface{} {
-		// TODO
-		val, err := strconv.ParseUint(data, 0, 256)
-		if err != nil {
-			return nil
-		}
-		return val
+	"core::integer::i8": func(typeName string, data string) (interface{}, error) {
+		return parseSignedFelt(data, 8)
 	},
-	"core::integer::i8": func(typeName string, data string) interface{} {
-		val, err := strconv.ParseInt(data, 0, 8)
-		if err != nil {
-			return nil
-		}
-		return val
+	"core::integer::i16": func(typeName string, data string) (interface{}, error) {
+		return parseSignedFelt(data, 16)
 	},
-	"core::integer::i16": func(typeName string, data string) interface{} {
-		val, err := strconv.ParseInt(data, 0, 16)
-		if err != nil {
-			return nil
-		}
-		return val
+	"core::integer::i32": func(typeName string, data string) (interface{}, error) {
+		return parseSignedFelt(data, 32)
 	},
-	"core::integer::i32": func(typeName string, data string) interface{} {
-		val, err := strconv.ParseInt(data, 0, 32)
-		if err != nil {
-			return nil
-		}
-		return val
+	"core::integer::i64": func(typeName string, data string) (interface{}, error) {
+		return parseSignedFelt(data, 64)
 	},
-	"core::integer::i64": func(typeName string, data string) interface{} {
-		val, err := strconv.ParseInt(data, 0, 64)
-		if err != nil {
-			return nil
+	"core::integer::i128": func(typeName string, data string) (interface{}, error) {
+		val, ok := new(big.Int).SetString(data, 0)
+		if !ok || val.Sign() < 0 || val.Cmp(FeltPrime) >= 0 {
+			return nil, ErrInvalidValue
 		}
-		return val
-	},
-	"core::integer::i128": func(typeName string, data string) interface{} {
-		val, err := strconv.ParseInt(data, 0, 128)
-		if err != nil {
-			return nil
+		// Negative values are encoded as FeltPrime - |val|
+		if val.Cmp(i128Max) > 0 {
+			val.Sub(val, FeltPrime)
+			if val.Cmp(i128Min) < 0 {
+				return nil, ErrInvalidValue
+			}
 		}
-		return val
+		return NewBigIntValue(val, i128Bias), nil
 	},
-	"core::bool": func(typeName string, data string) interface{} {
+	"core::bool": func(typeName string, data string) (interface{}, error) {
 		boolUint, err := strconv.ParseUint(data, 0, 8)
 		if err != nil {
-			return nil
+			return nil, err
 		}
 		if boolUint == 0 {
-			return false
+			return false, nil
 		} else {
-			return true
+			return true, nil
 		}
 	},
-	"core::starknet::contract_address::ContractAddress": func(typeName string, data string) interface{} {
-		return data
+	"core::starknet::contract_address::ContractAddress": func(typeName string, data string) (interface{}, error) {
+		return data, nil
 	},
-	"core::starknet::class_hash::ClassHash": func(typeName string, data string) interface{} {
-		return data
+	"core::starknet::class_hash::ClassHash": func(typeName string, data string) (interface{}, error) {
+		return data, nil
 	},
 }
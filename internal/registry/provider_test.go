@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/starknet.go/utils"
+	"github.com/b-j-roberts/foc-engine/internal/fakenode"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+const (
+	testClassHash       = "0xc1"
+	testContractAddress = "0xabc"
+)
+
+var testAbi = []map[string]interface{}{
+	{
+		"type":             "function",
+		"name":             "get_value",
+		"inputs":           []interface{}{},
+		"outputs":          []interface{}{map[string]interface{}{"type": "core::felt252"}},
+		"state_mutability": "view",
+	},
+	{
+		"type":             "function",
+		"name":             "set_value",
+		"inputs":           []interface{}{map[string]interface{}{"name": "value", "type": "core::felt252"}},
+		"outputs":          []interface{}{},
+		"state_mutability": "external",
+	},
+	{
+		"type": "event",
+		"name": "game::Moved",
+		"kind": "struct",
+		"members": []interface{}{
+			map[string]interface{}{"name": "player", "type": "core::felt252", "kind": "key"},
+			map[string]interface{}{"name": "x", "type": "core::integer::u32", "kind": "data"},
+		},
+	},
+	{
+		"type": "event",
+		"name": "game::Event",
+		"kind": "enum",
+		"variants": []interface{}{
+			map[string]interface{}{"name": "Moved", "type": "game::Moved", "kind": "nested"},
+		},
+	},
+}
+
+// testClass returns a sierra class of the abi, as served by starknet_getClass
+func testClass(t *testing.T, abi []map[string]interface{}) json.RawMessage {
+	t.Helper()
+	abiJson, err := json.Marshal(abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	class, err := json.Marshal(map[string]interface{}{"abi": string(abiJson)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return class
+}
+
+// newTestNode starts a fake node with a test contract
+func newTestNode(t *testing.T) *fakenode.Node {
+	t.Helper()
+	node := fakenode.New()
+	t.Cleanup(node.Close)
+	node.SetClass(testClassHash, testClass(t, testAbi))
+	node.DeployContract(testContractAddress, testClassHash)
+	return node
+}
+
+// newTestRegistry creates a registry with its class store in a test directory
+func newTestRegistry(t *testing.T, options RegistryOptions) *Registry {
+	t.Helper()
+	options.Config.ClassStoreDir = t.TempDir()
+	return NewRegistry(options)
+}
+
+func TestRegistryProviderFakeNode(t *testing.T) {
+	node := newTestNode(t)
+	node.AddBlock()
+	node.SetCall(testContractAddress, "get_value", func(calldata []string) ([]string, *provider.RpcError) {
+		return []string{"0x2a"}, nil
+	})
+	focRegistry := newTestRegistry(t, RegistryOptions{Provider: node.Provider()})
+
+	focRegistry.RegisterContract(testContractAddress, "")
+	registeredContract, ok := focRegistry.GetRegisteredContract(testContractAddress)
+	if !ok {
+		t.Fatal("contract not registered")
+	}
+	if registeredContract.ClassHash != NormalizeFelt(testClassHash) {
+		t.Errorf("class hash = %s, want %s", registeredContract.ClassHash, NormalizeFelt(testClassHash))
+	}
+
+	results, err := focRegistry.CallFunctions(context.Background(), []FunctionCall{
+		{ContractAddress: testContractAddress, Function: "get_value"},
+		{ContractAddress: testContractAddress, Function: "set_value", Args: json.RawMessage(`["0x1"]`)},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Error != "" {
+		t.Fatalf("get_value error: %s", results[0].Error)
+	}
+	if results[0].Result != "0x2a" {
+		t.Errorf("get_value = %v, want 0x2a", results[0].Result)
+	}
+	if !strings.Contains(results[1].Error, ErrFunctionNotView.Error()) {
+		t.Errorf("set_value error = %q, want %q", results[1].Error, ErrFunctionNotView)
+	}
+
+	// Headers come from the provider's chain heads
+	header, err := focRegistry.getBlockHeader(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.BlockHash != node.Head().Hash || header.Timestamp != fakenode.GenesisTimestamp+1 {
+		t.Errorf("header = %+v, want block %s", header, node.Head().Hash)
+	}
+}
+
+// memoryClass returns a contract class of the abi, as set on a MemoryProvider
+func memoryClass(t *testing.T, abi []map[string]interface{}) *provider.ContractClass {
+	t.Helper()
+	abiJson, err := json.Marshal(abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedAbi, err := provider.ParseAbi(abiJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &provider.ContractClass{Abi: parsedAbi}
+}
+
+func TestRegistriesOfSeparateProviders(t *testing.T) {
+	// Two networks with the same contracts, indexed in the same process
+	type network struct {
+		provider *provider.MemoryProvider
+		store    *memoryStore
+		registry *Registry
+	}
+	networks := make([]network, 2)
+	for i := range networks {
+		memoryProvider := provider.NewMemoryProvider()
+		memoryProvider.SetClass(testClassHash, memoryClass(t, testAbi))
+		memoryProvider.SetClass(testRegistryClassHash, memoryClass(t, testRegistryAbi))
+		memoryProvider.DeployContract(testContractAddress, testClassHash)
+		memoryProvider.DeployContract(testRegistryAddress, testRegistryClassHash)
+		store := newMemoryStore()
+		focRegistry := newTestRegistry(t, RegistryOptions{Provider: memoryProvider, EventStore: store})
+		err := memoryProvider.StartIndexer(provider.IndexerOptions{
+			ProcessStarknetEventData: focRegistry.ProcessStarknetEventData,
+			ContractResumeBlock:      focRegistry.GetContractResumeBlock,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		focRegistry.AddRegistryAddress(testRegistryAddress)
+		if err := memoryProvider.SubscribeEvents(testRegistryAddress); err != nil {
+			t.Fatal(err)
+		}
+		networks[i] = network{memoryProvider, store, focRegistry}
+	}
+
+	// Only the first network registers the contract
+	registration := networks[0].provider.AddBlock(provider.MemoryEvent{
+		FromAddress: testRegistryAddress,
+		Keys:        []string{ContractRegisteredEvent, testContractAddress},
+		Data:        []string{testClassHash},
+	})
+	for _, network := range networks {
+		network.provider.AddBlock(provider.MemoryEvent{
+			FromAddress: testContractAddress,
+			Keys:        []string{utils.GetSelectorFromNameFelt("Moved").String(), testPlayer},
+			Data:        []string{"0x1"},
+		})
+	}
+
+	if _, ok := networks[1].registry.GetRegisteredContract(testContractAddress); ok {
+		t.Error("contract registered on the second network")
+	}
+	if count := len(networks[1].store.documents("events")); count != 0 {
+		t.Errorf("second network stored %d events, want 0", count)
+	}
+	documents := movedDocuments(networks[0].store)
+	if len(documents) != 1 {
+		t.Fatalf("first network stored %d events, want 1", len(documents))
+	}
+	for _, document := range documents {
+		if document["block_number"] != registration.BlockNumber+1 || document["event_index"] != uint(0) {
+			t.Errorf("first network event = %v", document)
+		}
+	}
+	if lastBlock := networks[0].registry.GetLastCompletedBlock(); lastBlock != registration.BlockNumber {
+		t.Errorf("first network last completed block = %d, want %d", lastBlock, registration.BlockNumber)
+	}
+}
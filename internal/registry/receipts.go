@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+// Transactions kept in the receipt cache, events of a transaction are received together
+const ReceiptCacheSize = 1024
+
+// TransactionDetails are the fields of an event's transaction & receipt stored on its document
+type TransactionDetails struct {
+	SenderAddress   string
+	TransactionType string
+	ExecutionStatus string
+	ActualFee       string
+	FeeUnit         string
+	RevertReason    string
+	Events          []provider.ReceiptEvent
+}
+
+// receiptCache is a fifo cache of transaction details by transaction hash
+type receiptCache struct {
+	mutex   sync.Mutex
+	entries map[string]*TransactionDetails
+	order   []string
+}
+
+func newReceiptCache() *receiptCache {
+	return &receiptCache{
+		entries: make(map[string]*TransactionDetails),
+	}
+}
+
+func (c *receiptCache) get(transactionHash string) (*TransactionDetails, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	details, ok := c.entries[transactionHash]
+	return details, ok
+}
+
+func (c *receiptCache) add(transactionHash string, details *TransactionDetails) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[transactionHash]; ok {
+		return
+	}
+	if len(c.order) >= ReceiptCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[transactionHash] = details
+	c.order = append(c.order, transactionHash)
+}
+
+// clear drops the cached transactions, reverted ones may be included again with another outcome
+func (c *receiptCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]*TransactionDetails)
+	c.order = nil
+}
+
+// GetTransactionDetails returns the details of a transaction, fetching its receipt
+// & transaction once per transaction hash
+func (r *Registry) GetTransactionDetails(ctx context.Context, transactionHash string) (*TransactionDetails, error) {
+	if details, ok := r.transactionDetails.get(transactionHash); ok {
+		return details, nil
+	}
+	transaction, receipt, err := r.provider.TransactionWithReceipt(ctx, transactionHash)
+	if err != nil {
+		return nil, err
+	}
+	details := &TransactionDetails{
+		SenderAddress:   transaction.Sender(receipt),
+		TransactionType: transaction.Type,
+		ExecutionStatus: receipt.ExecutionStatus,
+		ActualFee:       receipt.ActualFee.Amount,
+		FeeUnit:         receipt.ActualFee.Unit,
+		RevertReason:    receipt.RevertReason,
+		Events:          receipt.Events,
+	}
+	r.transactionDetails.add(transactionHash, details)
+	return details, nil
+}
+
+// receiptEventIndex returns the index of an event in its transaction's receipt. Identical
+// events are told apart by the event's index when it points at one of them, otherwise
+// by occurrence, the number of identical events before it ( see StarknetEventData ), so
+// an event gets the same index however many times it is received.
+func (d *TransactionDetails) receiptEventIndex(event StarknetEvent, occurrence uint) (uint, bool) {
+	matches := func(receiptEvent provider.ReceiptEvent) bool {
+		if NormalizeFelt(receiptEvent.FromAddress) != NormalizeFelt(event.FromAddress) ||
+			len(receiptEvent.Keys) != len(event.Keys) || len(receiptEvent.Data) != len(event.Data) {
+			return false
+		}
+		for i := range event.Keys {
+			if NormalizeFelt(receiptEvent.Keys[i]) != NormalizeFelt(event.Keys[i]) {
+				return false
+			}
+		}
+		for i := range event.Data {
+			if NormalizeFelt(receiptEvent.Data[i]) != NormalizeFelt(event.Data[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if event.EventIndex != nil && *event.EventIndex < uint(len(d.Events)) && matches(d.Events[*event.EventIndex]) {
+		return *event.EventIndex, true
+	}
+	for i, receiptEvent := range d.Events {
+		if !matches(receiptEvent) {
+			continue
+		}
+		if occurrence == 0 {
+			return uint(i), true
+		}
+		occurrence--
+	}
+	return 0, false
+}
+
+// EnrichEventDocument attaches the sender, execution status & fee of an event's
+// transaction to its document, when Indexer.EnrichReceipts is set. Documents are
+// stored without them if the receipt can't be fetched. Runs on the notification
+// queue rather than the WebSocket read loop, & reuses the receipt fetched for the
+// event index when the rpc doesn't provide it.
+func (r *Registry) EnrichEventDocument(ctx context.Context, document map[string]interface{}, event StarknetEvent) {
+	if !r.config.EnrichReceipts || event.TransactionHash == "" {
+		return
+	}
+	details, err := r.GetTransactionDetails(ctx, event.TransactionHash)
+	if err != nil {
+		fmt.Println("Error getting transaction receipt:", event.TransactionHash, err)
+		return
+	}
+	if details.SenderAddress != "" {
+		document["sender_address"] = details.SenderAddress
+	}
+	document["transaction_type"] = details.TransactionType
+	document["execution_status"] = details.ExecutionStatus
+	document["actual_fee"] = details.ActualFee
+	document["fee_unit"] = details.FeeUnit
+	if details.RevertReason != "" {
+		document["revert_reason"] = details.RevertReason
+	}
+	// The event index set from the receipt, see setEventIndex
+	if index, ok := details.receiptEventIndex(event, 0); ok {
+		document["receipt_event_index"] = index
+	}
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+)
+
+func TestReceiptEventIndex(t *testing.T) {
+	moved := provider.ReceiptEvent{FromAddress: "0xabc", Keys: []string{"0x1"}, Data: []string{"0x2"}}
+	details := &TransactionDetails{
+		Events: []provider.ReceiptEvent{
+			{FromAddress: "0xdef", Keys: []string{"0x1"}, Data: []string{"0x2"}},
+			moved,
+			{FromAddress: "0xabc", Keys: []string{"0x1"}, Data: []string{"0x3"}},
+			moved,
+		},
+	}
+	event := StarknetEvent{FromAddress: "0x0abc", Keys: []string{"0x01"}, Data: []string{"0x2"}}
+	wrongIndex := uint(2)
+	rightIndex := uint(3)
+	tests := []struct {
+		name       string
+		eventIndex *uint
+		occurrence uint
+		want       uint
+		wantOk     bool
+	}{
+		{"first occurrence", nil, 0, 1, true},
+		{"second occurrence", nil, 1, 3, true},
+		{"past the identical events", nil, 2, 0, false},
+		{"event index of an identical event", &rightIndex, 0, 3, true},
+		{"event index of another event", &wrongIndex, 1, 3, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event.EventIndex = test.eventIndex
+			// Received again, as on a replay
+			for i := 0; i < 2; i++ {
+				index, ok := details.receiptEventIndex(event, test.occurrence)
+				if index != test.want || ok != test.wantOk {
+					t.Errorf("receiptEventIndex = %d, %v, want %d, %v", index, ok, test.want, test.wantOk)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RedecodeFilter limits which stored events are re-decoded, empty fields match all
+type RedecodeFilter struct {
+	ContractAddress string `json:"contractAddress"`
+	EventType       string `json:"eventType"`
+	FromBlock       *uint  `json:"fromBlock"`
+	ToBlock         *uint  `json:"toBlock"`
+}
+
+type RedecodeResult struct {
+	Matched   int `json:"matched"`
+	Redecoded int `json:"redecoded"`
+	// Documents stored before raw felts were kept on events
+	Skipped int      `json:"skipped"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors"`
+}
+
+// Max errors listed on a RedecodeResult
+const maxRedecodeErrors = 100
+
+func (f RedecodeFilter) toMongoFilter() bson.M {
+	filter := bson.M{}
+	if f.ContractAddress != "" {
+		// Addresses are stored as emitted, which may or may not be zero padded
+		addresses := []string{f.ContractAddress, NormalizeFelt(f.ContractAddress)}
+		if padded, ok := padAddress(f.ContractAddress); ok {
+			addresses = append(addresses, padded)
+		}
+		filter["contract_address"] = bson.M{"$in": addresses}
+	}
+	if f.EventType != "" {
+		filter["event_type"] = f.EventType
+	}
+	blockFilter := bson.M{}
+	if f.FromBlock != nil {
+		blockFilter["$gte"] = *f.FromBlock
+	}
+	if f.ToBlock != nil {
+		blockFilter["$lte"] = *f.ToBlock
+	}
+	if len(blockFilter) > 0 {
+		filter["block_number"] = blockFilter
+	}
+	return filter
+}
+
+func padAddress(address string) (string, bool) {
+	normalized := NormalizeFelt(address)
+	if len(normalized) > 66 {
+		return "", false
+	}
+	return fmt.Sprintf("0x%064s", normalized[2:]), true
+}
+
+// RedecodeEvents rebuilds the decoded fields of stored events from their raw felts,
+// using the currently loaded abis. Contracts not loaded in the registry ( ex: when
+// run from the cli ) have their class fetched from the rpc for the job.
+func (r *Registry) RedecodeEvents(ctx context.Context, filter RedecodeFilter) (*RedecodeResult, error) {
+	if filter.FromBlock != nil && filter.ToBlock != nil && *filter.FromBlock > *filter.ToBlock {
+		return nil, fmt.Errorf("invalid block range: %d > %d", *filter.FromBlock, *filter.ToBlock)
+	}
+	collection := mongo.GetFocEngineEventsCollection()
+	res, err := collection.Find(ctx, filter.toMongoFilter())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close(ctx)
+
+	result := &RedecodeResult{
+		Errors: make([]string, 0),
+	}
+	addFailure := func(id interface{}, err error) {
+		result.Failed++
+		if len(result.Errors) < maxRedecodeErrors {
+			result.Errors = append(result.Errors, fmt.Sprintf("%v: %v", id, err))
+		}
+	}
+	// Map: ContractAddress -> decoder, for contracts not in the registry
+	jobDecoders := make(map[string]*ContractDecoder)
+	for res.Next(ctx) {
+		result.Matched++
+		var document bson.M
+		if err := res.Decode(&document); err != nil {
+			return result, err
+		}
+		id := document["_id"]
+		event, ok := storedEvent(document)
+		if !ok {
+			result.Skipped++
+			continue
+		}
+
+		decoder, err := r.getRedecodeDecoder(jobDecoders, event.FromAddress)
+		if err != nil {
+			addFailure(id, err)
+			continue
+		}
+		typeNameJson, err := decodeEventDocument(decoder, event)
+		if err != nil {
+			addFailure(id, err)
+			continue
+		}
+		typeNameJson["contract_address"] = event.FromAddress
+		typeNameJson["_id"] = id
+		// Not derived from the raw event
+		for _, field := range nonDecodedEventFields {
+			if value, ok := document[field]; ok {
+				typeNameJson[field] = value
+			}
+		}
+		_, err = collection.ReplaceOne(ctx, bson.M{"_id": id}, typeNameJson)
+		if err != nil {
+			addFailure(id, err)
+			continue
+		}
+		result.Redecoded++
+	}
+	if err := res.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Fields of stored events kept when re-decoding
+var nonDecodedEventFields = []string{
+	"reorged", "reorged_at", "finality_updated_at",
+	"sender_address", "transaction_type", "execution_status", "actual_fee", "fee_unit", "revert_reason", "receipt_event_index",
+}
+
+// storedEvent rebuilds the raw event of a stored event document
+func storedEvent(document bson.M) (StarknetEvent, bool) {
+	rawKeys, ok := document["raw_keys"].(bson.A)
+	if !ok {
+		return StarknetEvent{}, false
+	}
+	rawData, ok := document["raw_data"].(bson.A)
+	if !ok {
+		return StarknetEvent{}, false
+	}
+	event := StarknetEvent{
+		Keys: make([]string, 0, len(rawKeys)),
+		Data: make([]string, 0, len(rawData)),
+	}
+	event.FromAddress, _ = document["contract_address"].(string)
+	event.TransactionHash, _ = document["transaction_hash"].(string)
+	if blockNumber, ok := bsonUint(document["block_number"]); ok {
+		event.BlockNumber = blockNumber
+	}
+	if eventIndex, ok := bsonUint(document["event_index"]); ok {
+		event.EventIndex = &eventIndex
+	}
+	event.BlockHash, _ = document["block_hash"].(string)
+	event.FinalityStatus, _ = document["finality_status"].(string)
+	if blockTimestamp, ok := bsonUint(document["block_timestamp"]); ok {
+		timestamp := uint64(blockTimestamp)
+		event.BlockTimestamp = &timestamp
+	}
+	for _, key := range rawKeys {
+		keyStr, ok := key.(string)
+		if !ok {
+			return StarknetEvent{}, false
+		}
+		event.Keys = append(event.Keys, keyStr)
+	}
+	for _, data := range rawData {
+		dataStr, ok := data.(string)
+		if !ok {
+			return StarknetEvent{}, false
+		}
+		event.Data = append(event.Data, dataStr)
+	}
+	return event, event.FromAddress != ""
+}
+
+func bsonUint(value interface{}) (uint, bool) {
+	switch v := value.(type) {
+	case int32:
+		return uint(v), v >= 0
+	case int64:
+		return uint(v), v >= 0
+	case float64:
+		return uint(v), v >= 0
+	}
+	return 0, false
+}
+
+func (r *Registry) getRedecodeDecoder(jobDecoders map[string]*ContractDecoder, address string) (*ContractDecoder, error) {
+	if registeredContract, ok := r.GetRegisteredContract(address); ok && registeredContract.Decoder != nil {
+		return registeredContract.Decoder, nil
+	}
+	if decoder, ok := jobDecoders[address]; ok {
+		if decoder == nil {
+			return nil, fmt.Errorf("no abi loaded for contract: %s", address)
+		}
+		return decoder, nil
+	}
+	_, _, decoder, err := r.classStore.GetClassAt(address)
+	if err != nil {
+		// Don't refetch for every event of the contract
+		jobDecoders[address] = nil
+		return nil, err
+	}
+	jobDecoders[address] = decoder
+	return decoder, nil
+}
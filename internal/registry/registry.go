@@ -1,10 +1,14 @@
 package registry
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/NethermindEth/starknet.go/contracts"
 
+	"github.com/b-j-roberts/foc-engine/internal/config"
+	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
 	"github.com/b-j-roberts/foc-engine/internal/provider"
 )
 
@@ -13,6 +17,8 @@ type RegisteredContract struct {
 	ClassHash               string
 	ContractClass           *provider.ContractClass
 	NethermindContractClass *contracts.ContractClass
+	// Compiled from the contract class abi for event lookups & decoding
+	Decoder *ContractDecoder
 }
 
 type RegisteredClass struct {
@@ -22,23 +28,82 @@ type RegisteredClass struct {
 }
 
 type Registry struct {
+	// Guards the maps & LastCompletedBlock, read by the routes while the indexer writes them
+	mutex sync.RWMutex
 	// Map: RegistryAddress -> isRegistered
 	RegistryAddresses  map[string]bool
 	RegistryContracts  map[string]RegisteredContract
 	LastCompletedBlock uint
 	// Map: ContractAddress -> RegisteredContract
 	RegisteredContracts map[string]RegisteredContract
+
+	provider   provider.Provider
+	eventStore EventStore
+	config     config.IndexerConfig
+	classStore *ClassStore
+	// Transactions of the received events, see GetTransactionDetails
+	transactionDetails *receiptCache
+	// Last block an event was processed from, see GetIndexerLag
+	processed processedBlock
+}
+
+// RegistryOptions are the node access, store & config of a registry. Each registry
+// only uses its own, so registries of different networks can index in the same process.
+type RegistryOptions struct {
+	// Node access, provider.Default() if nil
+	Provider provider.Provider
+	// Store of the indexed documents, Mongo ( when connected ) if nil
+	EventStore EventStore
+	Config     config.IndexerConfig
+}
+
+func NewRegistry(options RegistryOptions) *Registry {
+	p := options.Provider
+	if p == nil {
+		p = provider.Default()
+	}
+	return &Registry{
+		RegistryAddresses:   make(map[string]bool),
+		RegistryContracts:   make(map[string]RegisteredContract),
+		RegisteredContracts: make(map[string]RegisteredContract),
+		provider:            p,
+		eventStore:          options.EventStore,
+		config:              options.Config,
+		classStore:          NewClassStore(options.Config.ClassStoreDir, p),
+		transactionDetails:  newReceiptCache(),
+	}
 }
 
-var FocRegistry *Registry
+// Provider returns the node access of the registry
+func (r *Registry) Provider() provider.Provider {
+	return r.provider
+}
 
-func AddRegistryAddress(address string) {
-	if FocRegistry == nil {
-		FocRegistry = &Registry{}
+// EventStore returns the store of the registry, nil if it isn't set & Mongo isn't connected
+func (r *Registry) EventStore() EventStore {
+	if r.eventStore != nil {
+		return r.eventStore
 	}
-	if FocRegistry.RegistryAddresses == nil {
-		FocRegistry.RegistryAddresses = make(map[string]bool)
+	if mongo.Mongo != nil {
+		return mongoEventStore{}
 	}
+	return nil
+}
+
+// ClassStore returns the store of the contract classes loaded by the registry
+func (r *Registry) ClassStore() *ClassStore {
+	return r.classStore
+}
+
+// getBlockHeader returns the header of a block from the provider's chain heads, or the provider
+func (r *Registry) getBlockHeader(ctx context.Context, blockNumber uint) (provider.BlockHeader, error) {
+	if heads := r.provider.ChainHeads(); heads != nil {
+		return heads.GetBlockHeader(ctx, r.provider, blockNumber)
+	}
+	return r.provider.BlockHeader(ctx, blockNumber)
+}
+
+func (r *Registry) AddRegistryAddress(address string) {
 	contractAddress := address
 	fmt.Println("Adding registry address:", contractAddress)
 	if len(contractAddress) != 66 {
@@ -49,30 +114,26 @@ func AddRegistryAddress(address string) {
 		// Pad with leading zeros to 64 characters
 		contractAddress = fmt.Sprintf("0x%064s", contractAddress)
 	}
-	FocRegistry.RegistryAddresses[contractAddress] = true
+	r.mutex.Lock()
+	r.RegistryAddresses[contractAddress] = true
+	r.mutex.Unlock()
 
-	contractClass, err := provider.GetStarknetClassAt(contractAddress)
+	classHash, contractClass, decoder, err := r.classStore.GetClassAt(contractAddress)
 	if err != nil {
 		fmt.Println("Error getting contract class:", err)
 		return
 	}
-	if FocRegistry.RegistryContracts == nil {
-		FocRegistry.RegistryContracts = make(map[string]RegisteredContract)
-	}
-	FocRegistry.RegistryContracts[contractAddress] = RegisteredContract{
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.RegistryContracts[contractAddress] = RegisteredContract{
 		Address:       contractAddress,
-		ClassHash:     "0x0", // TODO
+		ClassHash:     classHash,
 		ContractClass: contractClass,
+		Decoder:       decoder,
 	}
 }
 
-func RegisterContract(address string, classHash string) {
-	if FocRegistry == nil {
-		FocRegistry = &Registry{}
-	}
-	if FocRegistry.RegisteredContracts == nil {
-		FocRegistry.RegisteredContracts = make(map[string]RegisteredContract)
-	}
+func (r *Registry) RegisterContract(address string, classHash string) {
 	contractAddress := address
 	if len(contractAddress) != 66 {
 		// Remove 0x prefix if present
@@ -82,32 +143,154 @@ func RegisterContract(address string, classHash string) {
 		// Pad with leading zeros to 64 characters
 		contractAddress = fmt.Sprintf("0x%064s", contractAddress)
 	}
-	contractClass, err := provider.GetStarknetClassAt(contractAddress)
+	// Class hash from the registration event, or the deployed class if not provided
+	var contractClass *provider.ContractClass
+	var decoder *ContractDecoder
+	var err error
+	if classHash != "" {
+		classHash = NormalizeFelt(classHash)
+		contractClass, decoder, err = r.classStore.GetClass(classHash)
+	} else {
+		classHash, contractClass, decoder, err = r.classStore.GetClassAt(contractAddress)
+	}
 	if err != nil {
 		fmt.Println("Error getting contract class:", err)
 		return
 	}
 
-	FocRegistry.RegisteredContracts[contractAddress] = RegisteredContract{
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.RegisteredContracts[contractAddress] = RegisteredContract{
 		Address:       contractAddress,
 		ClassHash:     classHash,
 		ContractClass: contractClass,
+		Decoder:       decoder,
+	}
+}
+
+// GetRegisteredContract returns the registered or registry contract at address
+func (r *Registry) GetRegisteredContract(address string) (RegisteredContract, bool) {
+	contractAddress := address
+	if len(contractAddress) != 66 {
+		// Remove 0x prefix if present
+		if contractAddress[:2] == "0x" {
+			contractAddress = contractAddress[2:]
+		}
+		// Pad with leading zeros to 64 characters
+		contractAddress = fmt.Sprintf("0x%064s", contractAddress)
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if registeredContract, ok := r.RegisteredContracts[contractAddress]; ok {
+		return registeredContract, true
 	}
+	if registryContract, ok := r.RegistryContracts[contractAddress]; ok {
+		return registryContract, true
+	}
+	return RegisteredContract{}, false
 }
 
-func RegisterClass(address string, name string, version string) {
-	if FocRegistry == nil {
-		FocRegistry = &Registry{}
+// ReloadContractClass reloads the class currently deployed at address, ex: after
+// the contract was upgraded to a new class
+func (r *Registry) ReloadContractClass(address string) error {
+	registeredContract, ok := r.GetRegisteredContract(address)
+	if !ok {
+		return fmt.Errorf("contract not registered: %s", address)
+	}
+	classHash, contractClass, decoder, err := r.classStore.GetClassAt(registeredContract.Address)
+	if err != nil {
+		return err
 	}
+	registeredContract.ClassHash = classHash
+	registeredContract.ContractClass = contractClass
+	registeredContract.Decoder = decoder
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.RegistryContracts[registeredContract.Address]; ok {
+		r.RegistryContracts[registeredContract.Address] = registeredContract
+	} else {
+		r.RegisteredContracts[registeredContract.Address] = registeredContract
+	}
+	return nil
+}
+
+func (r *Registry) RegisterClass(address string, name string, version string) {
 	/*
 	  TODO
-	  if FocRegistry.RegisteredContracts == nil {
-	    FocRegistry.RegisteredContracts = make(map[string]RegisteredContract)
+	  if r.RegisteredContracts == nil {
+	    r.RegisteredContracts = make(map[string]RegisteredContract)
 	  }
-	  FocRegistry.RegisteredContracts[address] = RegisteredContract{
+	  r.RegisteredContracts[address] = RegisteredContract{
 	    Address: address,
 	    Name:    name,
 	    Version: version,
 	  }
 	*/
 }
+
+// GetRegistryAddresses returns the addresses of the registry contracts
+func (r *Registry) GetRegistryAddresses() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	addresses := make([]string, 0, len(r.RegistryAddresses))
+	for address := range r.RegistryAddresses {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// isRegistryAddress reports whether a padded address is a registry contract
+func (r *Registry) isRegistryAddress(contractAddress string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.RegistryAddresses[contractAddress]
+}
+
+// getRegistryContract returns the registry contract at a padded address
+func (r *Registry) getRegistryContract(contractAddress string) (RegisteredContract, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	registryContract, ok := r.RegistryContracts[contractAddress]
+	return registryContract, ok
+}
+
+// getRegisteredContract returns the registered contract at a padded address
+func (r *Registry) getRegisteredContract(contractAddress string) (RegisteredContract, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	registeredContract, ok := r.RegisteredContracts[contractAddress]
+	return registeredContract, ok
+}
+
+// GetLastCompletedBlock returns the last block whose events were all processed
+func (r *Registry) GetLastCompletedBlock() uint {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.LastCompletedBlock
+}
+
+// GetContractResumeBlock returns the block to resume indexing a contract from on restart,
+// the block of its last stored event ( processed again, as its other events may be missing ),
+// or ok false if none is stored
+func (r *Registry) GetContractResumeBlock(address string) (uint, bool) {
+	store := r.EventStore()
+	if store == nil {
+		return 0, false
+	}
+	// Addresses are stored as emitted, which may or may not be zero padded
+	addresses := []string{address, NormalizeFelt(address)}
+	padded, ok := padAddress(address)
+	if ok {
+		addresses = append(addresses, padded)
+	}
+	collectionName, addressField := "events", "contract_address"
+	if ok && r.isRegistryAddress(padded) {
+		collectionName, addressField = "registry", "registry_address"
+	}
+	blockNumber, found, err := store.LastEventBlock(context.TODO(), collectionName, addressField, addresses)
+	if err != nil {
+		fmt.Println("Error getting the last event block of contract:", address, err)
+		return 0, false
+	}
+	return blockNumber, found
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Reorg is a logged chain reorganization & the documents it rolled back
+type Reorg struct {
+	Id                  bson.ObjectID `json:"_id" bson:"_id,omitempty"`
+	StartingBlockNumber uint          `json:"starting_block_number" bson:"starting_block_number"`
+	StartingBlockHash   string        `json:"starting_block_hash" bson:"starting_block_hash"`
+	EndingBlockNumber   uint          `json:"ending_block_number" bson:"ending_block_number"`
+	EndingBlockHash     string        `json:"ending_block_hash" bson:"ending_block_hash"`
+	Source              string        `json:"source" bson:"source"`
+	EventsReorged       int64         `json:"events_reorged" bson:"events_reorged"`
+	RegistryReorged     int64         `json:"registry_reorged" bson:"registry_reorged"`
+	DetectedAt          time.Time     `json:"detected_at" bson:"detected_at"`
+}
+
+// ProcessReorg marks the documents of the reverted blocks as reorged, rolls back
+// LastCompletedBlock to before the fork & logs the reorg. Reorged documents are
+// kept, but hidden from the event routes unless includeReorged is set.
+func (r *Registry) ProcessReorg(reorgData provider.ReorgData) {
+	r.mutex.Lock()
+	if r.LastCompletedBlock >= reorgData.StartingBlockNumber {
+		if reorgData.StartingBlockNumber > 0 {
+			r.LastCompletedBlock = reorgData.StartingBlockNumber - 1
+		} else {
+			r.LastCompletedBlock = 0
+		}
+	}
+	r.mutex.Unlock()
+	r.rollbackProcessedBlock(reorgData.StartingBlockNumber)
+	r.transactionDetails.clear()
+
+	reorg := Reorg{
+		StartingBlockNumber: reorgData.StartingBlockNumber,
+		StartingBlockHash:   reorgData.StartingBlockHash,
+		EndingBlockNumber:   reorgData.EndingBlockNumber,
+		EndingBlockHash:     reorgData.EndingBlockHash,
+		Source:              reorgData.Source,
+		DetectedAt:          time.Now().UTC(),
+	}
+	store := r.EventStore()
+	if store == nil {
+		return
+	}
+	// Events received after the ending block notification are from the new chain
+	count, err := store.MarkReorged(context.TODO(), "events", reorgData.StartingBlockNumber, reorgData.EndingBlockNumber, reorg.DetectedAt)
+	if err != nil {
+		fmt.Println("Error marking reorged events:", err)
+	} else {
+		reorg.EventsReorged = count
+	}
+	count, err = store.MarkReorged(context.TODO(), "registry", reorgData.StartingBlockNumber, reorgData.EndingBlockNumber, reorg.DetectedAt)
+	if err != nil {
+		fmt.Println("Error marking reorged registry events:", err)
+	} else {
+		reorg.RegistryReorged = count
+	}
+	fmt.Printf("Marked %d events & %d registry events as reorged\n", reorg.EventsReorged, reorg.RegistryReorged)
+
+	err = store.InsertReorg(context.TODO(), reorg)
+	if err != nil {
+		fmt.Println("Error inserting reorg into MongoDB:", err)
+	}
+}
+
+// GetReorgs returns a page of logged reorgs ending at or after fromBlock, newest first
+func GetReorgs(ctx context.Context, fromBlock uint, page int, limit int) ([]Reorg, error) {
+	skip := (page - 1) * limit
+	findOptions := options.Find().SetSort(bson.M{
+		"_id": -1,
+	}).SetLimit(int64(limit)).SetSkip(int64(skip))
+	filter := bson.M{
+		"ending_block_number": bson.M{"$gte": fromBlock},
+	}
+	res, err := mongo.GetFocEngineReorgsCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close(ctx)
+
+	reorgs := make([]Reorg, 0)
+	if err := res.All(ctx, &reorgs); err != nil {
+		return nil, err
+	}
+	return reorgs, nil
+}
@@ -0,0 +1,478 @@
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const JsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// EventSchemaField is a field the engine adds to every decoded event document
+type EventSchemaField struct {
+	Name   string
+	Schema map[string]interface{}
+	TsType string
+	// Not set on every document ( ex: events stored before the field was added )
+	Optional bool
+}
+
+// EventDocument holds the fields the engine adds to registered contract event documents,
+// on top of the decoded event members. EventDocumentFields is generated from its tags :
+//   - omitempty fields are optional ( ex: not set on events stored before the field was added )
+//   - schema:"felt" strings ( & string arrays ) are hex felts
+//   - enum:"A,B" strings are one of the listed values
+type EventDocument struct {
+	Id              string `json:"_id"`
+	ContractAddress string `json:"contract_address" schema:"felt"`
+	BlockNumber     uint   `json:"block_number"`
+	TransactionHash string `json:"transaction_hash" schema:"felt"`
+	EventType       string `json:"event_type"`
+	// Set since key & data members are decoded separately
+	KeyFields []string `json:"key_fields,omitempty"`
+	// Set since raw felts are stored
+	RawKeys    []string `json:"raw_keys,omitempty" schema:"felt"`
+	RawData    []string `json:"raw_data,omitempty" schema:"felt"`
+	EventIndex *uint    `json:"event_index,omitempty"`
+	// Set since chain heads are tracked, missing for pre-confirmed events
+	BlockHash      string  `json:"block_hash,omitempty" schema:"felt"`
+	BlockTimestamp *uint64 `json:"block_timestamp,omitempty"`
+	// Set since finality is tracked
+	FinalityStatus    string    `json:"finality_status,omitempty" enum:"PRE_CONFIRMED,ACCEPTED_ON_L2,ACCEPTED_ON_L1"`
+	FinalityUpdatedAt time.Time `json:"finality_updated_at,omitempty"`
+	// Set on events of reverted blocks
+	Reorged   bool      `json:"reorged,omitempty"`
+	ReorgedAt time.Time `json:"reorged_at,omitempty"`
+	// Set when Indexer.EnrichReceipts is enabled
+	SenderAddress     string `json:"sender_address,omitempty" schema:"felt"`
+	TransactionType   string `json:"transaction_type,omitempty" enum:"INVOKE,L1_HANDLER,DECLARE,DEPLOY,DEPLOY_ACCOUNT"`
+	ExecutionStatus   string `json:"execution_status,omitempty" enum:"SUCCEEDED,REVERTED"`
+	ActualFee         string `json:"actual_fee,omitempty" schema:"felt"`
+	FeeUnit           string `json:"fee_unit,omitempty" enum:"WEI,FRI"`
+	RevertReason      string `json:"revert_reason,omitempty"`
+	ReceiptEventIndex *uint  `json:"receipt_event_index,omitempty"`
+}
+
+// Fields added to registered contract event documents, on top of the decoded event members
+var EventDocumentFields = schemaFields(reflect.TypeOf(EventDocument{}))
+
+// schemaFields returns the schema fields of a document struct, see EventDocument for the tags
+func schemaFields(documentType reflect.Type) []EventSchemaField {
+	fields := make([]EventSchemaField, 0, documentType.NumField())
+	for i := 0; i < documentType.NumField(); i++ {
+		structField := documentType.Field(i)
+		name, options, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		field := EventSchemaField{
+			Name:     name,
+			Optional: strings.Contains(","+options+",", ",omitempty,"),
+		}
+		field.Schema, field.TsType = fieldSchema(structField.Type, structField.Tag)
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func fieldSchema(fieldType reflect.Type, tag reflect.StructTag) (map[string]interface{}, string) {
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, "string"
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		if enum := tag.Get("enum"); enum != "" {
+			values := []interface{}{}
+			tsValues := []string{}
+			for _, value := range strings.Split(enum, ",") {
+				values = append(values, value)
+				tsValues = append(tsValues, fmt.Sprintf("%q", value))
+			}
+			return map[string]interface{}{"enum": values}, strings.Join(tsValues, " | ")
+		}
+		if tag.Get("schema") == "felt" {
+			return feltSchema(), "string"
+		}
+		return map[string]interface{}{"type": "string"}, "string"
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, "number"
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, "boolean"
+	case reflect.Slice:
+		items, tsType := fieldSchema(fieldType.Elem(), tag)
+		return map[string]interface{}{"type": "array", "items": items}, tsType + "[]"
+	}
+	panic(fmt.Sprintf("unsupported document field type: %s", fieldType))
+}
+
+// Name of the shared definition for u128 / u256 / i128 values ( see BigIntValue )
+const bigIntSchemaName = "BigIntValue"
+
+func feltSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "string",
+		"pattern": "^0x[0-9a-fA-F]+$",
+	}
+}
+
+// schemaGenerator builds JSON Schema & TypeScript definitions matching the
+// values produced by TypeIndex.DecodeType for the types of an abi
+type schemaGenerator struct {
+	decoder *ContractDecoder
+	// Map: TypeName -> definition name
+	names map[string]string
+	// Definition names in the order they were first used
+	order   []string
+	defs    map[string]map[string]interface{}
+	tsDefs  map[string]string
+	inStack map[string]bool
+}
+
+func newSchemaGenerator(decoder *ContractDecoder) *schemaGenerator {
+	g := &schemaGenerator{
+		decoder: decoder,
+		names:   make(map[string]string),
+		order:   []string{},
+		defs:    make(map[string]map[string]interface{}),
+		tsDefs:  make(map[string]string),
+		inStack: make(map[string]bool),
+	}
+	g.assignNames()
+	return g
+}
+
+var nonIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// shortTypeName returns the last path segment of a type, keeping generic args
+// Example: "core::option::Option::<core::integer::u32>" -> "Option_u32"
+func shortTypeName(typeName string) string {
+	base := typeName
+	generics := ""
+	if idx := strings.Index(typeName, "<"); idx >= 0 {
+		base = strings.TrimSuffix(typeName[:idx], "::")
+		generics = GetGenericInnerType(typeName)
+	}
+	if idx := strings.LastIndex(base, "::"); idx >= 0 {
+		base = base[idx+2:]
+	}
+	name := nonIdentifierChars.ReplaceAllString(base, "_")
+	for _, inner := range splitTypeList(generics) {
+		name += "_" + shortTypeName(inner)
+	}
+	return strings.Trim(name, "_")
+}
+
+// assignNames gives each struct / enum of the abi a definition name, using the
+// short type name unless it collides with another type's
+func (g *schemaGenerator) assignNames() {
+	typeNames := []string{}
+	for _, abiEntry := range g.decoder.Abi {
+		entry, ok := abiEntry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if entry["type"] != "struct" && entry["type"] != "enum" && entry["type"] != "event" {
+			continue
+		}
+		name, ok := entry["name"].(string)
+		if !ok {
+			continue
+		}
+		if _, ok := g.names[name]; ok {
+			continue
+		}
+		g.names[name] = ""
+		typeNames = append(typeNames, name)
+	}
+	shortNameCounts := map[string]int{bigIntSchemaName: 1}
+	for _, name := range typeNames {
+		shortNameCounts[shortTypeName(name)]++
+	}
+	for _, name := range typeNames {
+		shortName := shortTypeName(name)
+		if shortNameCounts[shortName] > 1 {
+			shortName = strings.Trim(nonIdentifierChars.ReplaceAllString(name, "_"), "_")
+		}
+		g.names[name] = shortName
+	}
+}
+
+func (g *schemaGenerator) defName(typeName string) string {
+	if name, ok := g.names[typeName]; ok && name != "" {
+		return name
+	}
+	name := strings.Trim(nonIdentifierChars.ReplaceAllString(typeName, "_"), "_")
+	g.names[typeName] = name
+	return name
+}
+
+func (g *schemaGenerator) addDef(name string, schema map[string]interface{}, tsDef string) {
+	if _, ok := g.defs[name]; !ok {
+		g.order = append(g.order, name)
+	}
+	g.defs[name] = schema
+	g.tsDefs[name] = tsDef
+}
+
+func (g *schemaGenerator) useBigInt() {
+	if _, ok := g.defs[bigIntSchemaName]; ok {
+		return
+	}
+	g.addDef(bigIntSchemaName, map[string]interface{}{
+		"type":        "object",
+		"description": "Decimal value & fixed width hex sort key of a u128 / u256 / i128",
+		"properties": map[string]interface{}{
+			"value":    map[string]interface{}{"type": "string", "pattern": "^-?[0-9]+$"},
+			"sort_key": map[string]interface{}{"type": "string", "pattern": "^0x[0-9a-f]{64}$"},
+		},
+		"required":             []string{"value", "sort_key"},
+		"additionalProperties": false,
+	}, "export interface BigIntValue {\n  value: string;\n  sort_key: string;\n}\n")
+}
+
+func refSchema(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/$defs/" + name}
+}
+
+// typeSchema returns the JSON Schema & TypeScript type of a decoded typeName,
+// adding named definitions for the structs & enums it references
+func (g *schemaGenerator) typeSchema(typeName string) (map[string]interface{}, string) {
+	if IsPrimitiveType(typeName) {
+		switch typeName {
+		case "core::integer::u128", "core::integer::u256", "core::integer::i128":
+			g.useBigInt()
+			return refSchema(bigIntSchemaName), bigIntSchemaName
+		case "core::integer::u8", "core::integer::u16", "core::integer::u32", "core::integer::u64",
+			"core::integer::i8", "core::integer::i16", "core::integer::i32", "core::integer::i64":
+			return map[string]interface{}{"type": "integer"}, "number"
+		case "core::bool":
+			return map[string]interface{}{"type": "boolean"}, "boolean"
+		case "core::byte_array::ByteArray":
+			return map[string]interface{}{"type": "string"}, "string"
+		default:
+			return feltSchema(), "string"
+		}
+	} else if IsUnitType(typeName) {
+		return map[string]interface{}{"type": "null"}, "null"
+	} else if IsArrayType(typeName) {
+		itemSchema, itemTs := g.typeSchema(GetArrayInnerType(typeName))
+		return map[string]interface{}{
+			"type":  "array",
+			"items": itemSchema,
+		}, tsArrayType(itemTs)
+	} else if IsTupleType(typeName) {
+		tupleTypes := GetTupleInnerTypes(typeName)
+		itemSchemas := make([]interface{}, 0, len(tupleTypes))
+		itemTs := make([]string, 0, len(tupleTypes))
+		for _, tupleType := range tupleTypes {
+			itemSchema, ts := g.typeSchema(tupleType)
+			itemSchemas = append(itemSchemas, itemSchema)
+			itemTs = append(itemTs, ts)
+		}
+		return map[string]interface{}{
+			"type":        "array",
+			"prefixItems": itemSchemas,
+			"minItems":    len(tupleTypes),
+			"maxItems":    len(tupleTypes),
+		}, "[" + strings.Join(itemTs, ", ") + "]"
+	} else if IsFixedArrayType(typeName) {
+		arrayType, arrayLen, err := GetFixedArrayInfo(typeName)
+		if err != nil {
+			return map[string]interface{}{}, "unknown"
+		}
+		itemSchema, itemTs := g.typeSchema(arrayType)
+		return map[string]interface{}{
+			"type":     "array",
+			"items":    itemSchema,
+			"minItems": arrayLen,
+			"maxItems": arrayLen,
+		}, tsArrayType(itemTs)
+	} else if g.decoder.IsEnumType(typeName) {
+		if g.decoder.Lookup(typeName) == nil {
+			// Core enums missing from the abi are inlined
+			schema, tsVariants := g.enumSchema(typeName)
+			return schema, tsUnion(tsVariants, " | ")
+		}
+		name := g.defName(typeName)
+		if _, ok := g.defs[name]; !ok && !g.inStack[name] {
+			g.inStack[name] = true
+			schema, tsVariants := g.enumSchema(typeName)
+			g.addDef(name, schema, fmt.Sprintf("export type %s =\n  | %s;\n", name, tsUnion(tsVariants, "\n  | ")))
+			delete(g.inStack, name)
+		}
+		return refSchema(name), name
+	} else if IsStructType(typeName) && g.decoder.Lookup(typeName) != nil {
+		name := g.defName(typeName)
+		if _, ok := g.defs[name]; !ok && !g.inStack[name] {
+			g.inStack[name] = true
+			members := g.decoder.getEventMembers(typeName)
+			schema, ts := g.objectSchema(members, nil)
+			g.addDef(name, schema, fmt.Sprintf("export interface %s %s\n", name, ts))
+			delete(g.inStack, name)
+		}
+		return refSchema(name), name
+	}
+	return map[string]interface{}{}, "unknown"
+}
+
+func tsArrayType(itemTs string) string {
+	if strings.ContainsAny(itemTs, " |") {
+		return "Array<" + itemTs + ">"
+	}
+	return itemTs + "[]"
+}
+
+// enumSchema matches the { variant, value } objects enums are decoded into
+func (g *schemaGenerator) enumSchema(typeName string) (map[string]interface{}, []string) {
+	variants := g.decoder.GetEnumVariants(typeName)
+	oneOf := make([]interface{}, 0, len(variants))
+	tsVariants := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		valueSchema := map[string]interface{}{"type": "null"}
+		valueTs := "null"
+		if !IsUnitType(variant.Type) {
+			valueSchema, valueTs = g.typeSchema(variant.Type)
+		}
+		oneOf = append(oneOf, map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"variant": map[string]interface{}{"const": variant.Name},
+				"value":   valueSchema,
+			},
+			"required":             []string{"variant", "value"},
+			"additionalProperties": false,
+		})
+		tsVariants = append(tsVariants, fmt.Sprintf("{ variant: %q; value: %s }", variant.Name, valueTs))
+	}
+	return map[string]interface{}{"oneOf": oneOf}, tsVariants
+}
+
+func tsUnion(tsTypes []string, separator string) string {
+	if len(tsTypes) == 0 {
+		return "never"
+	}
+	return strings.Join(tsTypes, separator)
+}
+
+// objectSchema builds an object schema from struct members followed by extra fields
+func (g *schemaGenerator) objectSchema(members []EventMember, extraFields []EventSchemaField) (map[string]interface{}, string) {
+	properties := map[string]interface{}{}
+	required := []string{}
+	tsFields := []string{}
+	for _, member := range members {
+		memberSchema, memberTs := g.typeSchema(member.Type)
+		if member.Kind == "key" {
+			memberSchema = withDescription(memberSchema, "Event key")
+		}
+		properties[member.Name] = memberSchema
+		required = append(required, member.Name)
+		tsFields = append(tsFields, fmt.Sprintf("  %s: %s;", tsFieldName(member.Name), memberTs))
+	}
+	for _, field := range extraFields {
+		if _, ok := properties[field.Name]; ok {
+			continue
+		}
+		properties[field.Name] = field.Schema
+		if field.Optional {
+			tsFields = append(tsFields, fmt.Sprintf("  %s?: %s;", tsFieldName(field.Name), field.TsType))
+			continue
+		}
+		required = append(required, field.Name)
+		tsFields = append(tsFields, fmt.Sprintf("  %s: %s;", tsFieldName(field.Name), field.TsType))
+	}
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	if len(tsFields) == 0 {
+		return schema, "{}"
+	}
+	return schema, "{\n" + strings.Join(tsFields, "\n") + "\n}"
+}
+
+func withDescription(schema map[string]interface{}, description string) map[string]interface{} {
+	described := make(map[string]interface{}, len(schema)+1)
+	for key, value := range schema {
+		described[key] = value
+	}
+	described["description"] = description
+	return described
+}
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func tsFieldName(name string) string {
+	if tsIdentifier.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf("%q", name)
+}
+
+// eventDefs adds a definition for each event document & returns their names
+func (g *schemaGenerator) eventDefs() []string {
+	eventNames := []string{}
+	events := append([]*EventDefinition{}, g.decoder.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].TypeName < events[j].TypeName
+	})
+	for _, event := range events {
+		name := g.defName(event.TypeName)
+		extraFields := make([]EventSchemaField, 0, len(EventDocumentFields))
+		for _, field := range EventDocumentFields {
+			if field.Name == "event_type" {
+				field.Schema = map[string]interface{}{"const": event.TypeName}
+				field.TsType = fmt.Sprintf("%q", event.TypeName)
+			}
+			extraFields = append(extraFields, field)
+		}
+		schema, ts := g.objectSchema(event.Members, extraFields)
+		schema["title"] = event.TypeName
+		g.addDef(name, schema, fmt.Sprintf("export interface %s %s\n", name, ts))
+		eventNames = append(eventNames, name)
+	}
+	return eventNames
+}
+
+// GetEventJsonSchema returns a JSON Schema for the event documents of the contract,
+// with a definition per event type under "$defs"
+func (d *ContractDecoder) GetEventJsonSchema(title string) map[string]interface{} {
+	g := newSchemaGenerator(d)
+	eventNames := g.eventDefs()
+	oneOf := make([]interface{}, 0, len(eventNames))
+	for _, name := range eventNames {
+		oneOf = append(oneOf, refSchema(name))
+	}
+	defs := make(map[string]interface{}, len(g.defs))
+	for name, def := range g.defs {
+		defs[name] = def
+	}
+	return map[string]interface{}{
+		"$schema": JsonSchemaDraft,
+		"title":   title,
+		"oneOf":   oneOf,
+		"$defs":   defs,
+	}
+}
+
+// GetEventTypescript returns TypeScript definitions for the event documents of
+// the contract, with a ContractEvent union of all event types
+func (d *ContractDecoder) GetEventTypescript(title string) string {
+	g := newSchemaGenerator(d)
+	eventNames := g.eventDefs()
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("// Event types for %s\n// Generated by foc-engine, do not edit\n\n", title))
+	for _, name := range g.order {
+		builder.WriteString(g.tsDefs[name])
+		builder.WriteString("\n")
+	}
+	builder.WriteString("export type ContractEvent =\n  | " + tsUnion(eventNames, "\n  | ") + ";\n")
+	return builder.String()
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongodriver "go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EventStore stores the documents written by the indexer, Mongo by default
+type EventStore interface {
+	// UpsertEvent replaces the stored document, not reorged, with the fields of identity
+	// or inserts document, in a single operation. The stored finality is never downgraded.
+	UpsertEvent(ctx context.Context, collectionName string, identity map[string]interface{}, document map[string]interface{}) error
+	// FinalityBlocks returns the block numbers of the documents, not reorged, with a finality in statuses
+	FinalityBlocks(ctx context.Context, collectionName string, statuses []string) ([]uint, error)
+	// PromoteFinality moves the documents, not reorged, with a finality in fromStatuses up to
+	// throughBlock to toStatus, returning how many were updated
+	PromoteFinality(ctx context.Context, collectionName string, fromStatuses []string, throughBlock uint, toStatus string, updatedAt time.Time) (int64, error)
+	// LastEventBlock returns the block of the last document, not reorged, whose addressField
+	// is one of addresses, ok false if there is none
+	LastEventBlock(ctx context.Context, collectionName string, addressField string, addresses []string) (uint, bool, error)
+	// MarkReorged marks the documents of blocks [fromBlock, toBlock] as reorged, returning how many were marked
+	MarkReorged(ctx context.Context, collectionName string, fromBlock uint, toBlock uint, reorgedAt time.Time) (int64, error)
+	InsertReorg(ctx context.Context, reorg Reorg) error
+	InsertDeadLetter(ctx context.Context, deadLetter DeadLetter) error
+}
+
+var ErrNoEventStore = errors.New("event store not connected")
+
+// mongoEventStore stores the documents in the foc_engine database
+type mongoEventStore struct{}
+
+// Unique index of the event documents of each collection, per address, transaction & event index.
+// Reorged documents keep their reorged_at in the index, so a transaction included again
+// after a reorg is stored as a new document.
+var eventIndexKeys = map[string]bson.D{
+	"events":   {{Key: "contract_address", Value: 1}, {Key: "transaction_hash", Value: 1}, {Key: "event_index", Value: 1}, {Key: "reorged_at", Value: 1}},
+	"registry": {{Key: "registry_address", Value: 1}, {Key: "transaction_hash", Value: 1}, {Key: "event_index", Value: 1}, {Key: "reorged_at", Value: 1}},
+}
+
+// CreateEventIndexes creates the unique indexes of the event documents, called at startup
+// Documents without an event index ( receipts not enriched ) aren't covered
+func CreateEventIndexes(ctx context.Context) error {
+	for collectionName, keys := range eventIndexKeys {
+		_, err := mongo.Mongo.Client.Database("foc_engine").Collection(collectionName).Indexes().CreateOne(ctx, mongodriver.IndexModel{
+			Keys: keys,
+			Options: options.Index().
+				SetName("event_identity").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"event_index": bson.M{"$exists": true}}),
+		})
+		if err != nil {
+			return fmt.Errorf("creating %s index: %w", collectionName, err)
+		}
+	}
+	return nil
+}
+
+func (mongoEventStore) UpsertEvent(ctx context.Context, collectionName string, identity map[string]interface{}, document map[string]interface{}) error {
+	filter := bson.M{
+		"reorged": bson.M{"$ne": true},
+	}
+	for field, value := range identity {
+		filter[field] = value
+	}
+	set := bson.M{}
+	for field, value := range document {
+		if field != "_id" && field != "finality_status" {
+			set[field] = value
+		}
+	}
+	update := bson.M{"$set": set}
+	// Finality statuses sort from most to least final ( ACCEPTED_ON_L1 < ACCEPTED_ON_L2 < PRE_CONFIRMED ),
+	// so $min keeps the stored finality when it is more final
+	if finality, ok := document["finality_status"]; ok {
+		update["$min"] = bson.M{"finality_status": finality}
+	}
+	collection := mongo.Mongo.Client.Database("foc_engine").Collection(collectionName)
+	_, err := collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongodriver.IsDuplicateKeyError(err) {
+		// Inserted concurrently, update the inserted document
+		_, err = collection.UpdateOne(ctx, filter, update)
+	}
+	return err
+}
+
+func (mongoEventStore) FinalityBlocks(ctx context.Context, collectionName string, statuses []string) ([]uint, error) {
+	filter := bson.M{
+		"finality_status": bson.M{"$in": statuses},
+		"reorged":         bson.M{"$ne": true},
+	}
+	var blockNumbers []uint
+	err := mongo.Mongo.Client.Database("foc_engine").Collection(collectionName).Distinct(ctx, "block_number", filter).Decode(&blockNumbers)
+	if err != nil {
+		return nil, err
+	}
+	return blockNumbers, nil
+}
+
+func (mongoEventStore) PromoteFinality(ctx context.Context, collectionName string, fromStatuses []string, throughBlock uint, toStatus string, updatedAt time.Time) (int64, error) {
+	filter := bson.M{
+		"finality_status": bson.M{"$in": fromStatuses},
+		"reorged":         bson.M{"$ne": true},
+		"block_number":    bson.M{"$lte": throughBlock},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"finality_status":     toStatus,
+			"finality_updated_at": updatedAt,
+		},
+	}
+	res, err := mongo.Mongo.Client.Database("foc_engine").Collection(collectionName).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (mongoEventStore) LastEventBlock(ctx context.Context, collectionName string, addressField string, addresses []string) (uint, bool, error) {
+	filter := bson.M{
+		addressField: bson.M{"$in": addresses},
+		"reorged":    bson.M{"$ne": true},
+	}
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "block_number", Value: -1}}).
+		SetProjection(bson.M{"block_number": 1})
+	var last struct {
+		BlockNumber uint `bson:"block_number"`
+	}
+	err := mongo.Mongo.Client.Database("foc_engine").Collection(collectionName).FindOne(ctx, filter, opts).Decode(&last)
+	if errors.Is(err, mongodriver.ErrNoDocuments) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return last.BlockNumber, true, nil
+}
+
+func (mongoEventStore) MarkReorged(ctx context.Context, collectionName string, fromBlock uint, toBlock uint, reorgedAt time.Time) (int64, error) {
+	filter := bson.M{
+		"block_number": bson.M{
+			"$gte": fromBlock,
+			"$lte": toBlock,
+		},
+		"reorged": bson.M{"$ne": true},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"reorged":    true,
+			"reorged_at": reorgedAt,
+		},
+	}
+	res, err := mongo.Mongo.Client.Database("foc_engine").Collection(collectionName).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (mongoEventStore) InsertReorg(ctx context.Context, reorg Reorg) error {
+	_, err := mongo.GetFocEngineReorgsCollection().InsertOne(ctx, reorg)
+	return err
+}
+
+func (mongoEventStore) InsertDeadLetter(ctx context.Context, deadLetter DeadLetter) error {
+	_, err := mongo.GetFocEngineDeadLettersCollection().InsertOne(ctx, deadLetter)
+	return err
+}
@@ -8,14 +8,14 @@ import (
 
 	"github.com/b-j-roberts/foc-engine/internal/accounts"
 	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
-	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/b-j-roberts/foc-engine/internal/devnet"
 	"github.com/b-j-roberts/foc-engine/internal/registry"
 	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-func InitAccountsRoutes() {
-	http.HandleFunc("/accounts/add-accounts-contract", AddAccountsContract)
+func InitAccountsRoutes(reg *registry.Registry) {
+	http.HandleFunc("/accounts/add-accounts-contract", AddAccountsContract(reg))
 	http.HandleFunc("/accounts/get-accounts-contracts", GetAccountsContracts)
 
 	http.HandleFunc("/accounts/get-account", GetFocAccount)
@@ -41,57 +41,59 @@ func readFeltString(data string) (string, error) {
 	return feltString, nil
 }
 
-func AddAccountsContract(w http.ResponseWriter, r *http.Request) {
-	if routeutils.AdminMiddleware(w, r) {
-		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can add accounts contracts")
-		return
-	}
-	jsonBody, err := routeutils.ReadJsonBody[map[string]string](r)
-	if err != nil {
-		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
-		return
-	}
-	accountsContractAddress, ok := (*jsonBody)["address"]
-	if !ok {
-		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'address' field in JSON body")
-		return
-	}
-
-	subscribeEvents, ok := (*jsonBody)["subscribeEvents"]
-	if !ok {
-		subscribeEvents = "false" // Default to false if not provided
-	}
-	if subscribeEvents != "true" && subscribeEvents != "false" {
-		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid 'subscribeEvents' field in JSON body, must be 'true' or 'false'")
-		return
-	}
-
-	// Remove leading 0x & all 0s after 0x
-	if len(accountsContractAddress) > 2 && accountsContractAddress[:2] == "0x" {
-		accountsContractAddress = accountsContractAddress[2:]
-	}
-	for len(accountsContractAddress) > 0 && accountsContractAddress[0] == '0' {
-		accountsContractAddress = accountsContractAddress[1:]
-	}
-	accountsContractAddress = "0x" + accountsContractAddress
-
-	if subscribeEvents == "true" {
-		accountsClassHash, ok := (*jsonBody)["class_hash"]
+func AddAccountsContract(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can add accounts contracts")
+			return
+		}
+		jsonBody, err := routeutils.ReadJsonBody[map[string]string](r)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+		accountsContractAddress, ok := (*jsonBody)["address"]
 		if !ok {
-			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'class_hash' field in JSON body")
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'address' field in JSON body")
 			return
 		}
 
-		err = provider.SubscribeEvents(accountsContractAddress)
-		if err != nil {
-			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to subscribe to events")
+		subscribeEvents, ok := (*jsonBody)["subscribeEvents"]
+		if !ok {
+			subscribeEvents = "false" // Default to false if not provided
+		}
+		if subscribeEvents != "true" && subscribeEvents != "false" {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid 'subscribeEvents' field in JSON body, must be 'true' or 'false'")
 			return
 		}
-		registry.RegisterContract(accountsContractAddress, accountsClassHash)
-	}
-	accounts.AddAccountsContract(accountsContractAddress)
 
-	routeutils.WriteResultJson(w, "Accounts contract added successfully")
+		// Remove leading 0x & all 0s after 0x
+		if len(accountsContractAddress) > 2 && accountsContractAddress[:2] == "0x" {
+			accountsContractAddress = accountsContractAddress[2:]
+		}
+		for len(accountsContractAddress) > 0 && accountsContractAddress[0] == '0' {
+			accountsContractAddress = accountsContractAddress[1:]
+		}
+		accountsContractAddress = "0x" + accountsContractAddress
+
+		if subscribeEvents == "true" {
+			accountsClassHash, ok := (*jsonBody)["class_hash"]
+			if !ok {
+				routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'class_hash' field in JSON body")
+				return
+			}
+
+			err = reg.Provider().SubscribeEvents(accountsContractAddress)
+			if err != nil {
+				routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to subscribe to events")
+				return
+			}
+			reg.RegisterContract(accountsContractAddress, accountsClassHash)
+		}
+		accounts.AddAccountsContract(accountsContractAddress)
+
+		routeutils.WriteResultJson(w, "Accounts contract added successfully")
+	}
 }
 
 func GetAccountsContracts(w http.ResponseWriter, r *http.Request) {
@@ -252,12 +254,16 @@ func GetFocAccounts(w http.ResponseWriter, r *http.Request) {
 	routeutils.WriteDataJson(w, string(resultJsonBytes))
 }
 
+// MintFunds funds an account on devnet, also served at /devnet/mint
 func MintFunds(w http.ResponseWriter, r *http.Request) {
 	// curl -X POST http://127.0.0.1:5050/mint -d '{"address":"0x2a15f812c97fbca1bd061ad074ee198877721aba36e09548e43b53b90c77c74","amount":50000000000000000000,"unit":"FRI"}' -H "Content-Type:application/json"
 	if routeutils.AdminMiddleware(w, r) {
 		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can mint funds")
 		return
 	}
+	if devnetUnavailable(w, r) {
+		return
+	}
 
 	jsonBody, err := routeutils.ReadJsonBody[map[string]interface{}](r)
 	if err != nil {
@@ -282,11 +288,14 @@ func MintFunds(w http.ResponseWriter, r *http.Request) {
 
 	unit, ok := (*jsonBody)["unit"].(string)
 	if !ok || unit == "" {
-		unit = "FRI" // Default to FRI if not provided
+		unit = devnet.UnitFri // Default to FRI if not provided
 	}
 
-	// TODO: Check valid inputs
-	provider.Mint(address, amount, unit)
+	_, err = devnet.Mint(r.Context(), address, amount, unit)
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
 
 	routeutils.WriteResultJson(w, "Funds minted successfully")
 }
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/b-j-roberts/foc-engine/internal/registry"
+	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
+)
+
+// Max calls in a single /contracts/call multicall
+const MaxContractCalls = 100
+
+func InitContractsRoutes(reg *registry.Registry) {
+	http.HandleFunc("/contracts/call", CallContract(reg))
+	http.HandleFunc("/contracts/get-functions", GetContractFunctions(reg))
+}
+
+type CallContractRequest struct {
+	registry.FunctionCall
+	// Multicall, used instead of the single call fields when set
+	Calls []registry.FunctionCall `json:"calls"`
+	// Optional, latest block if not set
+	BlockNumber *uint `json:"blockNumber"`
+}
+
+// CallContract runs read-only calls of registered contracts' functions, encoding the
+// named json args & decoding the results with the contract abi
+// Body: {"contractAddress", "function", "args", "blockNumber"} or {"calls": [...], "blockNumber"}
+func CallContract(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonBody, err := routeutils.ReadJsonBody[CallContractRequest](r)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+		multicall := len(jsonBody.Calls) > 0
+		calls := jsonBody.Calls
+		if !multicall {
+			calls = []registry.FunctionCall{jsonBody.FunctionCall}
+		}
+		if len(calls) > MaxContractCalls {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, fmt.Sprintf("Too many calls, max %d", MaxContractCalls))
+			return
+		}
+		for _, call := range calls {
+			if call.ContractAddress == "" || call.Function == "" {
+				routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'contractAddress' or 'function' field in JSON body")
+				return
+			}
+		}
+
+		results, err := reg.CallFunctions(r.Context(), calls, jsonBody.BlockNumber)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusBadGateway, "Failed to call contract: "+err.Error())
+			return
+		}
+		var resultJson interface{}
+		if multicall {
+			resultJson = map[string]interface{}{
+				"results": results,
+			}
+		} else {
+			if results[0].Error != "" {
+				routeutils.WriteErrorJson(w, http.StatusBadRequest, results[0].Error)
+				return
+			}
+			resultJson = results[0]
+		}
+		resultJsonBytes, err := json.Marshal(resultJson)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
+	}
+}
+
+// GetContractFunctions returns the functions of a registered contract & their argument types
+func GetContractFunctions(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contractAddress := r.URL.Query().Get("contractAddress")
+		if contractAddress == "" {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'contractAddress' query parameter")
+			return
+		}
+		registeredContract, ok := reg.GetRegisteredContract(contractAddress)
+		if !ok || registeredContract.Decoder == nil {
+			routeutils.WriteErrorJson(w, http.StatusNotFound, "Contract not registered")
+			return
+		}
+		resultJson := map[string]interface{}{
+			"contract_address": registeredContract.Address,
+			"functions":        registeredContract.Decoder.GetFunctions(),
+		}
+		resultJsonBytes, err := json.Marshal(resultJson)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
+	}
+}
@@ -0,0 +1,267 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/b-j-roberts/foc-engine/internal/devnet"
+	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
+)
+
+func InitDevnetRoutes() {
+	http.HandleFunc("/devnet/mint", MintFunds)
+	http.HandleFunc("/devnet/increase-time", IncreaseDevnetTime)
+	http.HandleFunc("/devnet/set-time", SetDevnetTime)
+	http.HandleFunc("/devnet/create-block", CreateDevnetBlock)
+	http.HandleFunc("/devnet/set-gas-price", SetDevnetGasPrice)
+	http.HandleFunc("/devnet/dump", DumpDevnet)
+	http.HandleFunc("/devnet/load", LoadDevnet)
+	http.HandleFunc("/devnet/get-predeployed-accounts", GetPredeployedAccounts)
+	http.HandleFunc("/devnet/get-config", GetDevnetConfig)
+}
+
+// devnetUnavailable writes an error & returns true if the rpc node isn't a starknet-devnet
+func devnetUnavailable(w http.ResponseWriter, r *http.Request) bool {
+	if !devnet.IsDevnet(r.Context()) {
+		routeutils.WriteErrorJson(w, http.StatusNotImplemented, "Route is only available on devnet")
+		return true
+	}
+	return false
+}
+
+func writeDevnetError(w http.ResponseWriter, err error) {
+	if errors.Is(err, devnet.ErrInvalidInput) {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	routeutils.WriteErrorJson(w, http.StatusBadGateway, "Devnet request failed: "+err.Error())
+}
+
+func writeDevnetResult(w http.ResponseWriter, result interface{}) {
+	resultJsonBytes, err := json.Marshal(result)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+		return
+	}
+	routeutils.WriteDataJson(w, string(resultJsonBytes))
+}
+
+// parseDevnetAmount parses a decimal amount string, nil if empty
+func parseDevnetAmount(value string) (*big.Int, bool) {
+	if value == "" {
+		return nil, true
+	}
+	return new(big.Int).SetString(value, 10)
+}
+
+type IncreaseDevnetTimeRequest struct {
+	// Seconds
+	Time uint64 `json:"time"`
+}
+
+func IncreaseDevnetTime(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can increase devnet time")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	jsonBody, err := routeutils.ReadJsonBody[IncreaseDevnetTimeRequest](r)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	result, err := devnet.IncreaseTime(r.Context(), jsonBody.Time)
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	writeDevnetResult(w, result)
+}
+
+type SetDevnetTimeRequest struct {
+	// Unix timestamp
+	Time          uint64 `json:"time"`
+	GenerateBlock bool   `json:"generateBlock"`
+}
+
+func SetDevnetTime(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can set devnet time")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	jsonBody, err := routeutils.ReadJsonBody[SetDevnetTimeRequest](r)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	result, err := devnet.SetTime(r.Context(), jsonBody.Time, jsonBody.GenerateBlock)
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	writeDevnetResult(w, result)
+}
+
+func CreateDevnetBlock(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can create devnet blocks")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	blockHash, err := devnet.CreateBlock(r.Context())
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	writeDevnetResult(w, map[string]interface{}{
+		"block_hash": blockHash,
+	})
+}
+
+// Decimal strings, unset prices are left unchanged
+type SetDevnetGasPriceRequest struct {
+	GasPriceWei     string `json:"gasPriceWei"`
+	GasPriceFri     string `json:"gasPriceFri"`
+	DataGasPriceWei string `json:"dataGasPriceWei"`
+	DataGasPriceFri string `json:"dataGasPriceFri"`
+	L2GasPriceWei   string `json:"l2GasPriceWei"`
+	L2GasPriceFri   string `json:"l2GasPriceFri"`
+	GenerateBlock   bool   `json:"generateBlock"`
+}
+
+func SetDevnetGasPrice(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can set devnet gas prices")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	jsonBody, err := routeutils.ReadJsonBody[SetDevnetGasPriceRequest](r)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	prices := devnet.GasPrices{}
+	for _, price := range []struct {
+		name  string
+		value string
+		price **big.Int
+	}{
+		{"gasPriceWei", jsonBody.GasPriceWei, &prices.GasPriceWei},
+		{"gasPriceFri", jsonBody.GasPriceFri, &prices.GasPriceFri},
+		{"dataGasPriceWei", jsonBody.DataGasPriceWei, &prices.DataGasPriceWei},
+		{"dataGasPriceFri", jsonBody.DataGasPriceFri, &prices.DataGasPriceFri},
+		{"l2GasPriceWei", jsonBody.L2GasPriceWei, &prices.L2GasPriceWei},
+		{"l2GasPriceFri", jsonBody.L2GasPriceFri, &prices.L2GasPriceFri},
+	} {
+		amount, ok := parseDevnetAmount(price.value)
+		if !ok {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid '"+price.name+"' field in JSON body")
+			return
+		}
+		*price.price = amount
+	}
+	result, err := devnet.SetGasPrice(r.Context(), prices, jsonBody.GenerateBlock)
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	routeutils.WriteDataJson(w, string(result))
+}
+
+type DevnetStateRequest struct {
+	// Path on the devnet host
+	Path string `json:"path"`
+}
+
+// DumpDevnet saves the devnet state to path, or returns it if path is empty
+func DumpDevnet(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can dump devnet state")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	jsonBody, err := routeutils.ReadJsonBody[DevnetStateRequest](r)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	dump, err := devnet.Dump(r.Context(), jsonBody.Path)
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	if jsonBody.Path != "" {
+		routeutils.WriteResultJson(w, "Devnet state dumped successfully")
+		return
+	}
+	routeutils.WriteDataJson(w, string(dump))
+}
+
+func LoadDevnet(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can load devnet state")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	jsonBody, err := routeutils.ReadJsonBody[DevnetStateRequest](r)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if err := devnet.Load(r.Context(), jsonBody.Path); err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	routeutils.WriteResultJson(w, "Devnet state loaded successfully")
+}
+
+// GetPredeployedAccounts returns the devnet's funded accounts & their keys
+func GetPredeployedAccounts(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can get predeployed accounts")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	withBalance := r.URL.Query().Get("withBalance") == "true"
+	accounts, err := devnet.GetPredeployedAccounts(r.Context(), withBalance)
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	writeDevnetResult(w, map[string]interface{}{
+		"accounts": accounts,
+	})
+}
+
+func GetDevnetConfig(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can get devnet config")
+		return
+	}
+	if devnetUnavailable(w, r) {
+		return
+	}
+	devnetConfig, err := devnet.GetConfig(r.Context())
+	if err != nil {
+		writeDevnetError(w, err)
+		return
+	}
+	routeutils.WriteDataJson(w, string(devnetConfig))
+}
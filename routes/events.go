@@ -6,12 +6,13 @@ import (
 	"strconv"
 
 	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
+	"github.com/b-j-roberts/foc-engine/internal/registry"
 	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-func InitEventsRoutes() {
+func InitEventsRoutes(reg *registry.Registry) {
 	http.HandleFunc("/events/get-block-events", GetBlockEvents)
 	http.HandleFunc("/events/get-latest-event", GetLatestEvent)
 	http.HandleFunc("/events/get-latest-with", GetLatestWith)
@@ -19,6 +20,33 @@ func InitEventsRoutes() {
 	http.HandleFunc("/events/get-unique-ordered", GetUniqueOrdered)
 	http.HandleFunc("/events/get-unique-with", GetUniqueWith)
 	http.HandleFunc("/events/count-events-with", CountEventsWith)
+	http.HandleFunc("/events/get-reorgs", GetReorgs)
+
+	http.HandleFunc("/events/get-dead-letters", GetDeadLetters)
+	http.HandleFunc("/events/retry-dead-letters", RetryDeadLetters(reg))
+	http.HandleFunc("/events/redecode-events", RedecodeEvents(reg))
+}
+
+// withEventFilters adds the filters shared by the event query routes, writing an
+// error & returning false if their query parameters are invalid
+// - includeReorged: "true" to include events of reorged blocks, marked "reorged": true
+// - minFinality: PRE_CONFIRMED, ACCEPTED_ON_L2 or ACCEPTED_ON_L1, all events if empty
+// Filters already set by the caller's body aren't overridden
+func withEventFilters(w http.ResponseWriter, r *http.Request, filters map[string]interface{}) bool {
+	if _, ok := filters["reorged"]; !ok && r.URL.Query().Get("includeReorged") != "true" {
+		filters["reorged"] = bson.M{"$ne": true}
+	}
+	if minFinality := r.URL.Query().Get("minFinality"); minFinality != "" {
+		finalityFilter, err := registry.FinalityFilter(minFinality)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid minFinality parameter")
+			return false
+		}
+		if _, ok := filters["finality_status"]; !ok {
+			filters["finality_status"] = finalityFilter
+		}
+	}
+	return true
 }
 
 func GetBlockEvents(w http.ResponseWriter, r *http.Request) {
@@ -33,9 +61,13 @@ func GetBlockEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := mongo.GetFocEngineEventsCollection().Find(r.Context(), map[string]interface{}{
+	filters := map[string]interface{}{
 		"block_number": blockNumber,
-	})
+	}
+	if !withEventFilters(w, r, filters) {
+		return
+	}
+	res, err := mongo.GetFocEngineEventsCollection().Find(r.Context(), filters)
 	if err != nil {
 		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to query events")
 		return
@@ -87,10 +119,14 @@ func GetLatestEvent(w http.ResponseWriter, r *http.Request) {
 	findOptions := options.Find().SetSort(map[string]interface{}{
 		"_id": -1,
 	}).SetLimit(1)
-	res, err := mongo.GetFocEngineEventsCollection().Find(r.Context(), map[string]interface{}{
+	filters := map[string]interface{}{
 		"contract_address": contractAddress,
 		"event_type":       eventType,
-	}, findOptions)
+	}
+	if !withEventFilters(w, r, filters) {
+		return
+	}
+	res, err := mongo.GetFocEngineEventsCollection().Find(r.Context(), filters, findOptions)
 	if err != nil {
 		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to query events")
 		return
@@ -152,6 +188,9 @@ func GetLatestWith(w http.ResponseWriter, r *http.Request) {
 	// Add contract address and event type to the filters
 	filters["contract_address"] = contractAddress
 	filters["event_type"] = eventType
+	if !withEventFilters(w, r, filters) {
+		return
+	}
 
 	findOptions := options.Find().SetSort(map[string]interface{}{
 		"_id": -1,
@@ -253,6 +292,9 @@ func GetEventsOrdered(w http.ResponseWriter, r *http.Request) {
 	// Add contract address and event type to the filters
 	filters["contract_address"] = contractAddress
 	filters["event_type"] = eventType
+	if !withEventFilters(w, r, filters) {
+		return
+	}
 
 	res, err := mongo.GetFocEngineEventsCollection().Find(r.Context(), filters, findOptions)
 	if err != nil {
@@ -336,12 +378,16 @@ func GetUniqueOrdered(w http.ResponseWriter, r *http.Request) {
 		orderKey = "_id" // Default to _id if not provided
 	}
 
+	filters := bson.M{
+		"contract_address": contractAddress,
+		"event_type":       eventType,
+	}
+	if !withEventFilters(w, r, filters) {
+		return
+	}
 	pipeline := []bson.M{
 		{
-			"$match": bson.M{
-				"contract_address": contractAddress,
-				"event_type":       eventType,
-			},
+			"$match": filters,
 		},
 		{
 			"$group": bson.M{
@@ -463,6 +509,9 @@ func GetUniqueWith(w http.ResponseWriter, r *http.Request) {
 	// Add contract address and event type to the filters
 	filters["contract_address"] = contractAddress
 	filters["event_type"] = eventType
+	if !withEventFilters(w, r, filters) {
+		return
+	}
 	filters[uniqueKey] = bson.M{"$exists": true}
 
 	pipeline := []bson.M{
@@ -554,6 +603,9 @@ func CountEventsWith(w http.ResponseWriter, r *http.Request) {
 	}
 	filters["contract_address"] = contractAddress
 	filters["event_type"] = eventType
+	if !withEventFilters(w, r, filters) {
+		return
+	}
 
 	count, err := mongo.GetFocEngineEventsCollection().CountDocuments(r.Context(), filters)
 	if err != nil {
@@ -572,3 +624,192 @@ func CountEventsWith(w http.ResponseWriter, r *http.Request) {
 
 	routeutils.WriteDataJson(w, string(responseJson))
 }
+
+// GetReorgs returns the chain reorgs which rolled back events, newest first
+// Clients can poll with fromBlock set to their last synced block to detect rollbacks
+func GetReorgs(w http.ResponseWriter, r *http.Request) {
+	// TODO: Max limit
+	defaultPage := 1
+	defaultLimit := 10
+	pageStr := r.URL.Query().Get("page")
+	if pageStr == "" {
+		pageStr = strconv.Itoa(defaultPage)
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid page parameter")
+		return
+	}
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		limitStr = strconv.Itoa(defaultLimit)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid limit parameter")
+		return
+	}
+	fromBlock := 0
+	if fromBlockStr := r.URL.Query().Get("fromBlock"); fromBlockStr != "" {
+		fromBlock, err = strconv.Atoi(fromBlockStr)
+		if err != nil || fromBlock < 0 {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid fromBlock parameter")
+			return
+		}
+	}
+
+	reorgs, err := registry.GetReorgs(r.Context(), uint(fromBlock), page, limit)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to query reorgs")
+		return
+	}
+	reorgsJson, err := json.Marshal(reorgs)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal reorgs to JSON")
+		return
+	}
+	routeutils.WriteDataJson(w, string(reorgsJson))
+}
+
+func GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if routeutils.AdminMiddleware(w, r) {
+		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can view dead letters")
+		return
+	}
+
+	// TODO: Max limit
+	defaultPage := 1
+	defaultLimit := 10
+	pageStr := r.URL.Query().Get("page")
+	if pageStr == "" {
+		pageStr = strconv.Itoa(defaultPage)
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid page parameter")
+		return
+	}
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		limitStr = strconv.Itoa(defaultLimit)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid limit parameter")
+		return
+	}
+
+	filter := bson.M{}
+	if contractAddress := r.URL.Query().Get("contractAddress"); contractAddress != "" {
+		filter["contract_address"] = contractAddress
+	}
+	if collection := r.URL.Query().Get("collection"); collection != "" {
+		filter["collection"] = collection
+	}
+
+	deadLetters, err := registry.GetDeadLetters(r.Context(), filter, page, limit)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to query dead letters")
+		return
+	}
+
+	deadLettersJson, err := json.Marshal(deadLetters)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal dead letters to JSON")
+		return
+	}
+	routeutils.WriteDataJson(w, string(deadLettersJson))
+}
+
+type RetryDeadLettersRequest struct {
+	// Dead letter ids to retry, all matching dead letters if empty
+	Ids             []string `json:"ids"`
+	ContractAddress string   `json:"contractAddress"`
+	// Refetch the contract class before retrying, requires contractAddress
+	RefreshAbi bool `json:"refreshAbi"`
+}
+
+func RetryDeadLetters(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can retry dead letters")
+			return
+		}
+
+		jsonBody, err := routeutils.ReadJsonBody[RetryDeadLettersRequest](r)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+
+		filter := bson.M{}
+		if len(jsonBody.Ids) > 0 {
+			ids := make([]bson.ObjectID, 0, len(jsonBody.Ids))
+			for _, id := range jsonBody.Ids {
+				objectId, err := bson.ObjectIDFromHex(id)
+				if err != nil {
+					routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid id in 'ids' field")
+					return
+				}
+				ids = append(ids, objectId)
+			}
+			filter["_id"] = bson.M{"$in": ids}
+		}
+		if jsonBody.ContractAddress != "" {
+			filter["contract_address"] = jsonBody.ContractAddress
+		}
+
+		if jsonBody.RefreshAbi {
+			if jsonBody.ContractAddress == "" {
+				routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'contractAddress' field required by 'refreshAbi'")
+				return
+			}
+			err = reg.ReloadContractClass(jsonBody.ContractAddress)
+			if err != nil {
+				routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to refresh contract abi")
+				return
+			}
+		}
+
+		result, err := reg.RetryDeadLetters(r.Context(), filter)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to retry dead letters")
+			return
+		}
+
+		resultJson, err := json.Marshal(result)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal result to JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJson))
+	}
+}
+
+func RedecodeEvents(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can redecode events")
+			return
+		}
+
+		jsonBody, err := routeutils.ReadJsonBody[registry.RedecodeFilter](r)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+
+		result, err := reg.RedecodeEvents(r.Context(), *jsonBody)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to redecode events")
+			return
+		}
+
+		resultJson, err := json.Marshal(result)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal result to JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJson))
+	}
+}
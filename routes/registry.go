@@ -5,74 +5,74 @@ import (
 	"net/http"
 
 	"github.com/b-j-roberts/foc-engine/internal/db/mongo"
-	"github.com/b-j-roberts/foc-engine/internal/provider"
 	"github.com/b-j-roberts/foc-engine/internal/registry"
 	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-func InitRegistryRoutes() {
-	http.HandleFunc("/registry/add-registry-contract", AddRegistryContract)
-	http.HandleFunc("/registry/get-registry-contracts", GetRegistryContracts)
+func InitRegistryRoutes(reg *registry.Registry) {
+	http.HandleFunc("/registry/add-registry-contract", AddRegistryContract(reg))
+	http.HandleFunc("/registry/get-registry-contracts", GetRegistryContracts(reg))
 
 	http.HandleFunc("/registry/get-registered-contract", GetRegisteredContract)
+	http.HandleFunc("/registry/get-contract-events", GetContractEvents(reg))
+	http.HandleFunc("/registry/get-event-schemas", GetEventSchemas(reg))
 }
 
-func AddRegistryContract(w http.ResponseWriter, r *http.Request) {
-	if routeutils.AdminMiddleware(w, r) {
-		routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can add registry contracts")
-		return
-	}
+func AddRegistryContract(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can add registry contracts")
+			return
+		}
 
-	jsonBody, err := routeutils.ReadJsonBody[map[string]string](r)
-	if err != nil {
-		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
-		return
-	}
-	registryContractAddress, ok := (*jsonBody)["address"]
-	if !ok {
-		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'address' field in JSON body")
-		return
-	}
+		jsonBody, err := routeutils.ReadJsonBody[map[string]string](r)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+		registryContractAddress, ok := (*jsonBody)["address"]
+		if !ok {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'address' field in JSON body")
+			return
+		}
 
-	subscribeEvents, ok := (*jsonBody)["subscribeEvents"]
-	if !ok {
-		subscribeEvents = "false" // Default to false if not provided
-	}
-	if subscribeEvents != "true" && subscribeEvents != "false" {
-		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid 'subscribeEvents' field in JSON body, must be 'true' or 'false'")
-		return
+		subscribeEvents, ok := (*jsonBody)["subscribeEvents"]
+		if !ok {
+			subscribeEvents = "false" // Default to false if not provided
+		}
+		if subscribeEvents != "true" && subscribeEvents != "false" {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid 'subscribeEvents' field in JSON body, must be 'true' or 'false'")
+			return
+		}
+
+		if subscribeEvents == "true" {
+			err = reg.Provider().SubscribeEvents(registryContractAddress)
+			if err != nil {
+				routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to subscribe to events")
+				return
+			}
+		}
+		reg.AddRegistryAddress(registryContractAddress)
+
+		routeutils.WriteResultJson(w, "Registry contract added successfully")
 	}
+}
 
-	if subscribeEvents == "true" {
-		err = provider.SubscribeEvents(registryContractAddress)
+func GetRegistryContracts(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		registeredContracts := reg.GetRegistryAddresses()
+		resultJson := map[string]interface{}{
+			"registry_contracts": registeredContracts,
+		}
+		resultJsonBytes, err := json.Marshal(resultJson)
 		if err != nil {
-			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to subscribe to events")
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
 			return
 		}
-	}
-	registry.AddRegistryAddress(registryContractAddress)
-
-	routeutils.WriteResultJson(w, "Registry contract added successfully")
-}
 
-func GetRegistryContracts(w http.ResponseWriter, r *http.Request) {
-	// RegistryAddresses  map[string]bool
-	registeredContractsMap := registry.FocRegistry.RegistryAddresses
-	registeredContracts := make([]string, 0, len(registeredContractsMap))
-	for address := range registeredContractsMap {
-		registeredContracts = append(registeredContracts, address)
-	}
-	resultJson := map[string]interface{}{
-		"registry_contracts": registeredContracts,
-	}
-	resultJsonBytes, err := json.Marshal(resultJson)
-	if err != nil {
-		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
-		return
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
 	}
-
-	routeutils.WriteDataJson(w, string(resultJsonBytes))
 }
 
 func GetRegisteredContract(w http.ResponseWriter, r *http.Request) {
@@ -120,3 +120,66 @@ func GetRegisteredContract(w http.ResponseWriter, r *http.Request) {
 	}
 	routeutils.WriteDataJson(w, string(resultJsonBytes))
 }
+
+func GetContractEvents(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contractAddress := r.URL.Query().Get("contractAddress")
+		if contractAddress == "" {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'contractAddress' query parameter")
+			return
+		}
+		registeredContract, ok := reg.GetRegisteredContract(contractAddress)
+		if !ok || registeredContract.Decoder == nil {
+			routeutils.WriteErrorJson(w, http.StatusNotFound, "Contract not registered")
+			return
+		}
+		resultJson := map[string]interface{}{
+			"contract_address": registeredContract.Address,
+			"events":           registeredContract.Decoder.Events,
+		}
+		resultJsonBytes, err := json.Marshal(resultJson)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
+	}
+}
+
+// GetEventSchemas returns the JSON Schema ( default ) or TypeScript definitions
+// of the event documents stored for a registered contract
+func GetEventSchemas(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contractAddress := r.URL.Query().Get("contractAddress")
+		if contractAddress == "" {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'contractAddress' query parameter")
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json" // Default to JSON Schema if not provided
+		}
+		if format != "json" && format != "typescript" {
+			routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid 'format' query parameter, must be 'json' or 'typescript'")
+			return
+		}
+		registeredContract, ok := reg.GetRegisteredContract(contractAddress)
+		if !ok || registeredContract.Decoder == nil {
+			routeutils.WriteErrorJson(w, http.StatusNotFound, "Contract not registered")
+			return
+		}
+
+		var result interface{}
+		if format == "typescript" {
+			result = registeredContract.Decoder.GetEventTypescript(registeredContract.Address)
+		} else {
+			result = registeredContract.Decoder.GetEventJsonSchema(registeredContract.Address)
+		}
+		resultJsonBytes, err := json.Marshal(result)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/b-j-roberts/foc-engine/internal/config"
+	"github.com/b-j-roberts/foc-engine/internal/registry"
 	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
 )
 
@@ -15,24 +16,31 @@ func InitBaseRoutes() {
 	})
 }
 
-func InitRoutes() {
+// InitRoutes registers the routes of a registry & its provider
+func InitRoutes(reg *registry.Registry) {
 	InitBaseRoutes()
+	InitStatusRoutes(reg)
+	InitSubscriptionsRoutes(reg.Provider())
 	if config.ModuleEnabled(config.ModuleRegistry) {
-		InitRegistryRoutes()
+		InitRegistryRoutes(reg)
+		InitContractsRoutes(reg)
 	}
 	if config.ModuleEnabled(config.ModuleAccounts) {
-		InitAccountsRoutes()
+		InitAccountsRoutes(reg)
 	}
 	if config.ModuleEnabled(config.ModuleEvents) {
-		InitEventsRoutes()
+		InitEventsRoutes(reg)
 	}
 	if config.ModuleEnabled(config.ModulePaymaster) {
 		InitPaymasterRoutes()
 	}
+	if config.ModuleEnabled(config.ModuleDevnet) {
+		InitDevnetRoutes()
+	}
 }
 
-func StartServer(host string, port int) {
-	InitRoutes()
+func StartServer(host string, port int, reg *registry.Registry) {
+	InitRoutes(reg)
 	addr := fmt.Sprintf(":%d", port)
 	fmt.Printf("Starting server on %s\n", addr)
 	go func() {
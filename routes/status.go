@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	"github.com/b-j-roberts/foc-engine/internal/registry"
+	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
+)
+
+func InitStatusRoutes(reg *registry.Registry) {
+	http.HandleFunc("/status/get-rpc-endpoints", GetRpcEndpoints(reg.Provider()))
+	http.HandleFunc("/status/get-websocket", GetWebSocketStatus(reg.Provider()))
+	http.HandleFunc("/status/get-chain-head", GetChainHead(reg.Provider()))
+	http.HandleFunc("/status/get-indexer-lag", GetIndexerLag(reg))
+}
+
+// GetRpcEndpoints returns the health of each rpc endpoint & their current ranking
+func GetRpcEndpoints(p provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoints := p.RpcEndpoints()
+		if endpoints == nil {
+			routeutils.WriteErrorJson(w, http.StatusServiceUnavailable, "Provider has no rpc endpoints")
+			return
+		}
+		var wsUrl string
+		if p.Indexing() {
+			wsUrl = p.GetWebSocketStatus().Url
+		}
+		statuses := endpoints.Status()
+		for i := range statuses {
+			statuses[i].WebSocketActive = wsUrl != "" && statuses[i].WsUrl == wsUrl
+		}
+		rankedUrls := make([]string, 0, len(statuses))
+		for _, endpoint := range endpoints.Ranked() {
+			rankedUrls = append(rankedUrls, endpoint.Url)
+		}
+		resultJson := map[string]interface{}{
+			"endpoints": statuses,
+			"ranked":    rankedUrls,
+		}
+		resultJsonBytes, err := json.Marshal(resultJson)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
+	}
+}
+
+// GetWebSocketStatus returns the state of the indexer WebSocket connection
+func GetWebSocketStatus(p provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.Indexing() {
+			routeutils.WriteErrorJson(w, http.StatusServiceUnavailable, "WebSocket not initialized")
+			return
+		}
+		status := p.GetWebSocketStatus()
+		statusJson, err := json.Marshal(status)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(statusJson))
+	}
+}
+
+// GetChainHead returns the latest block header & the window of recent headers
+func GetChainHead(p provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		heads := p.ChainHeads()
+		if heads == nil {
+			routeutils.WriteErrorJson(w, http.StatusServiceUnavailable, "Provider doesn't track chain heads")
+			return
+		}
+		head, receivedAt, ok := heads.Head()
+		if !ok {
+			routeutils.WriteErrorJson(w, http.StatusServiceUnavailable, "No chain head received yet")
+			return
+		}
+		resultJson := map[string]interface{}{
+			"head":        head,
+			"received_at": receivedAt,
+			"window":      heads.Window(),
+		}
+		resultJsonBytes, err := json.Marshal(resultJson)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
+	}
+}
+
+// GetIndexerLag returns how far the indexed events are behind the chain head
+func GetIndexerLag(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lag, err := reg.GetIndexerLag()
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		lagJson, err := json.Marshal(lag)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(lagJson))
+	}
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/b-j-roberts/foc-engine/internal/provider"
+	routeutils "github.com/b-j-roberts/foc-engine/routes/utils"
+)
+
+func InitSubscriptionsRoutes(p provider.Provider) {
+	http.HandleFunc("/subscriptions/get-subscriptions", GetSubscriptions(p))
+	http.HandleFunc("/subscriptions/pause", PauseSubscription(p))
+	http.HandleFunc("/subscriptions/resume", ResumeSubscription(p))
+	http.HandleFunc("/subscriptions/remove", RemoveSubscription(p))
+}
+
+type SubscriptionRequest struct {
+	ContractAddress string `json:"contractAddress"`
+}
+
+// GetSubscriptions returns the event subscription of each indexed contract
+func GetSubscriptions(p provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can get subscriptions")
+			return
+		}
+		if !p.Indexing() {
+			routeutils.WriteErrorJson(w, http.StatusServiceUnavailable, "Provider not initialized")
+			return
+		}
+		resultJson := map[string]interface{}{
+			"subscriptions": p.GetSubscriptions(),
+		}
+		resultJsonBytes, err := json.Marshal(resultJson)
+		if err != nil {
+			routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to marshal JSON")
+			return
+		}
+		routeutils.WriteDataJson(w, string(resultJsonBytes))
+	}
+}
+
+// PauseSubscription unsubscribes from a contract's events until resumed
+func PauseSubscription(p provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can pause subscriptions")
+			return
+		}
+		updateSubscription(w, r, p.PauseSubscription, "Subscription paused")
+	}
+}
+
+// ResumeSubscription backfills the events missed while paused & subscribes again
+func ResumeSubscription(p provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can resume subscriptions")
+			return
+		}
+		updateSubscription(w, r, p.ResumeSubscription, "Subscription resumed")
+	}
+}
+
+// RemoveSubscription stops indexing a contract until it is subscribed again ( ex: on restart )
+func RemoveSubscription(p provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if routeutils.AdminMiddleware(w, r) {
+			routeutils.WriteErrorJson(w, http.StatusUnauthorized, "Only the admin can remove subscriptions")
+			return
+		}
+		updateSubscription(w, r, p.RemoveSubscription, "Subscription removed")
+	}
+}
+
+func updateSubscription(w http.ResponseWriter, r *http.Request, update func(address string) error, result string) {
+	jsonBody, err := routeutils.ReadJsonBody[SubscriptionRequest](r)
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if jsonBody.ContractAddress == "" {
+		routeutils.WriteErrorJson(w, http.StatusBadRequest, "Missing 'contractAddress' field in JSON body")
+		return
+	}
+	err = update(jsonBody.ContractAddress)
+	if errors.Is(err, provider.ErrSubscriptionNotFound) {
+		routeutils.WriteErrorJson(w, http.StatusNotFound, "Subscription not found")
+		return
+	}
+	if errors.Is(err, provider.ErrNotIndexing) {
+		routeutils.WriteErrorJson(w, http.StatusServiceUnavailable, "Provider not initialized")
+		return
+	}
+	if err != nil {
+		routeutils.WriteErrorJson(w, http.StatusInternalServerError, "Failed to update subscription: "+err.Error())
+		return
+	}
+	routeutils.WriteResultJson(w, result)
+}